@@ -0,0 +1,364 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	database "github.com/ad/go-githublistener/db"
+	logging "github.com/ad/go-githublistener/logging"
+	telegram "github.com/ad/go-githublistener/telegram"
+	tracing "github.com/ad/go-githublistener/tracing"
+
+	tgbotapi "gopkg.in/telegram-bot-api.v4"
+)
+
+// pageAdminUsers is the pager action of /users
+const pageAdminUsers = "au"
+
+// broadcastPause keeps broadcasts under telegram limits
+const broadcastPause = 50 * time.Millisecond
+
+func registerAdminCommands(router *telegram.Router) {
+	router.Handle(telegram.Handler{
+		Name:        "stats",
+		Description: "show bot statistics",
+		Auth:        telegram.AuthAdmin,
+		Hidden:      true,
+		Handle:      statsCommand,
+	})
+
+	router.Handle(telegram.Handler{
+		Name:        "users",
+		Description: "list github users",
+		Auth:        telegram.AuthAdmin,
+		Hidden:      true,
+		Handle:      usersCommand,
+	})
+
+	router.Handle(telegram.Handler{
+		Name:        "broadcast",
+		Description: "send a message to every user",
+		Usage:       "text",
+		Args:        telegram.RawArg,
+		Auth:        telegram.AuthAdmin,
+		Hidden:      true,
+		Handle:      broadcastCommand,
+	})
+
+	router.Handle(telegram.Handler{
+		Name:        "pollnow",
+		Description: "check a repo for new commits right away",
+		Usage:       "owner/repo",
+		Args:        telegram.RepoArg,
+		Auth:        telegram.AuthAdmin,
+		Hidden:      true,
+		Handle:      pollNowCommand,
+	})
+
+	router.Handle(telegram.Handler{
+		Name:        "ban",
+		Description: "ignore a telegram user",
+		Usage:       "telegram_id",
+		Args:        telegram.Fields,
+		Auth:        telegram.AuthAdmin,
+		Hidden:      true,
+		Handle:      banCommand,
+	})
+
+	router.Handle(telegram.Handler{
+		Name:        "unban",
+		Description: "stop ignoring a telegram user",
+		Usage:       "telegram_id",
+		Args:        telegram.Fields,
+		Auth:        telegram.AuthAdmin,
+		Hidden:      true,
+		Handle:      unbanCommand,
+	})
+
+	router.HandleCallback(telegram.Handler{
+		Name:   pageAdminUsers,
+		Auth:   telegram.AuthAdmin,
+		Handle: usersPageCallback,
+	})
+}
+
+// parseAdmins reads comma separated telegram ids
+func parseAdmins(list string) (map[int]bool, error) {
+	admins := make(map[int]bool)
+	for _, field := range strings.Split(list, ",") {
+		if field = strings.TrimSpace(field); field == "" {
+			continue
+		}
+
+		id, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, fmt.Errorf("wrong admin id %q", field)
+		}
+		admins[id] = true
+	}
+
+	return admins, nil
+}
+
+func statsCommand(c *telegram.Context) error {
+	stats, err := database.GetStats(db)
+	if err != nil {
+		return err
+	}
+
+	lines := []string{
+		fmt.Sprintf("Users: %d github accounts of %d telegram users, %d banned", stats.GithubUsers, stats.TelegramUsers, stats.Banned),
+		fmt.Sprintf("Repos: %d", stats.Repos),
+		fmt.Sprintf("Subscriptions: %d, %d of them in %d chats", stats.Subscriptions, stats.ChatSubscriptions, stats.Chats),
+		fmt.Sprintf("Pending notifications: %d", stats.Pending),
+		fmt.Sprintf("Stored messages: %d", stats.Messages),
+	}
+
+	if tick := repoPoller.LastTick(); !tick.Started.IsZero() {
+		lines = append(lines, fmt.Sprintf("Last poll: %s ago, %d subscriptions in %s", time.Since(tick.Started).Round(time.Second), tick.Subscriptions, tick.Duration.Round(time.Millisecond)))
+	} else {
+		lines = append(lines, "Last poll: not yet")
+	}
+
+	limits := client.RateLimits()
+	if len(limits) > 0 {
+		users, err := database.GetUsers(c.Context(), db)
+		if err != nil {
+			return err
+		}
+
+		logins := make(map[string]string)
+		for _, user := range users {
+			logins[user.Token] = user.UserName
+		}
+
+		var quota []string
+		for token, limit := range limits {
+			login, ok := logins[token]
+			if !ok {
+				login = "unknown token"
+			}
+			quota = append(quota, fmt.Sprintf("%s: %d of %d left, resets %s", login, limit.Remaining, limit.Limit, limit.Reset.UTC().Format("15:04")))
+		}
+		sort.Strings(quota)
+
+		lines = append(lines, "API quota:")
+		lines = append(lines, quota...)
+	}
+
+	return c.Reply(strings.Join(lines, "\n"))
+}
+
+func usersCommand(c *telegram.Context) error {
+	return usersPage(c, 0)
+}
+
+func usersPageCallback(c *telegram.Context) error {
+	page, err := strconv.Atoi(c.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	return usersPage(c, page)
+}
+
+func usersPage(c *telegram.Context, page int) error {
+	users, err := database.GetUsers(c.Context(), db)
+	if err != nil {
+		return err
+	}
+
+	if len(users) == 0 {
+		return c.Reply("No users yet")
+	}
+
+	counts, err := database.CountUserSubscriptions(db)
+	if err != nil {
+		return err
+	}
+
+	r := c.Bot.Renderer
+
+	lines := make([]string, len(users))
+	for i, user := range users {
+		lines[i] = r.Escape(fmt.Sprintf("%s tg:%s, %d subscriptions, since %s", user.UserName, user.TelegramUserID, counts[user.ID], user.CreatedAt.Format("2006-01-02")))
+	}
+
+	return replyPage(c, r.Escape(fmt.Sprintf("%d users:", len(users))), lines, page, pageAdminUsers)
+}
+
+func broadcastCommand(c *telegram.Context) error {
+	text := strings.TrimSpace(c.Arg(0))
+	if text == "" {
+		return c.Reply("usage: /broadcast text")
+	}
+
+	if !broadcasting.CompareAndSwap(false, true) {
+		return c.Reply("A broadcast is already running")
+	}
+
+	chatIDs, err := broadcastChats(c.Context())
+	if err != nil {
+		broadcasting.Store(false)
+		return err
+	}
+
+	// sending is paced, run it apart from the update loop and report when done
+	bg, span := c.Background("broadcast", tracing.Int("chats", int64(len(chatIDs))))
+	go func() {
+		defer broadcasting.Store(false)
+		defer span.End()
+
+		sent, failed := broadcast(bg, chatIDs, text)
+		span.SetAttr(tracing.Int("sent", int64(sent)), tracing.Int("failed", int64(failed)))
+
+		slog.InfoContext(bg.Context(), "broadcast sent", "sent", sent, "failed", failed)
+
+		if err := bg.Reply(fmt.Sprintf("Sent to %d users, %d failed", sent, failed)); err != nil {
+			slog.ErrorContext(bg.Context(), "failed to report broadcast", logging.Err(err))
+		}
+	}()
+
+	return c.Reply(fmt.Sprintf("Sending to %d users, I will report when it is done", len(chatIDs)))
+}
+
+// broadcasting is set while a broadcast is being sent
+var broadcasting atomic.Bool
+
+// broadcastChats returns private chats of every telegram user who is not
+// banned, once per user
+func broadcastChats(ctx context.Context) ([]int64, error) {
+	users, err := database.GetUsers(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var chatIDs []int64
+	for _, user := range users {
+		if seen[user.TelegramUserID] {
+			continue
+		}
+		seen[user.TelegramUserID] = true
+
+		if banned, err := database.IsBanned(db, user.TelegramUserID); err != nil || banned {
+			continue
+		}
+
+		chatID, err := strconv.ParseInt(user.TelegramUserID, 10, 64)
+		if err != nil {
+			slog.ErrorContext(ctx, "wrong telegram user id", logging.KeyTelegramUser, user.TelegramUserID, logging.Err(err))
+			continue
+		}
+		chatIDs = append(chatIDs, chatID)
+	}
+
+	return chatIDs, nil
+}
+
+// broadcast sends text to chats pausing between messages
+func broadcast(c *telegram.Context, chatIDs []int64, text string) (sent, failed int) {
+	for _, chatID := range chatIDs {
+		if err := c.Send(tgbotapi.NewMessage(chatID, text)); err != nil {
+			slog.ErrorContext(c.Context(), "failed to send broadcast", "to", chatID, logging.Err(err))
+			failed++
+		} else {
+			sent++
+		}
+
+		time.Sleep(broadcastPause)
+	}
+
+	return sent, failed
+}
+
+func pollNowCommand(c *telegram.Context) error {
+	ghrepo, err := database.GetGithubRepoByNameFromDB(db, c.Arg(0))
+	if err != nil {
+		return c.Reply(c.Arg(0) + " not found")
+	}
+
+	if !pollingNow.CompareAndSwap(false, true) {
+		return c.Reply("A poll is already running")
+	}
+
+	// polling waits on github, run it apart from the update loop and report
+	// when done
+	bg, span := c.Background("pollnow", tracing.String("repo", ghrepo.RepoName))
+	go func() {
+		defer pollingNow.Store(false)
+		defer span.End()
+
+		var text string
+		n, err := repoPoller.PollNow(bg.Context(), ghrepo.ID)
+		if err != nil {
+			span.SetError(err)
+			slog.ErrorContext(bg.Context(), "failed to poll", logging.Err(err))
+			text = fmt.Sprintf("Failed to poll %s: %s", ghrepo.RepoName, err)
+		} else {
+			text = fmt.Sprintf("%s polled for %d subscriptions", ghrepo.RepoName, n)
+		}
+
+		if err := bg.Reply(text); err != nil {
+			slog.ErrorContext(bg.Context(), "failed to report poll", logging.Err(err))
+		}
+	}()
+
+	return c.Reply(fmt.Sprintf("Polling %s, I will report when it is done", ghrepo.RepoName))
+}
+
+// pollingNow is set while /pollnow is running
+var pollingNow atomic.Bool
+
+// adminTarget returns telegram id argument of /ban and /unban
+func adminTarget(c *telegram.Context) (string, error) {
+	id, err := strconv.Atoi(c.Arg(0))
+	if err != nil {
+		return "", fmt.Errorf("usage: /%s telegram_id", c.Command)
+	}
+
+	return strconv.Itoa(id), nil
+}
+
+func banCommand(c *telegram.Context) error {
+	id, err := adminTarget(c)
+	if err != nil {
+		return c.Reply(err.Error())
+	}
+
+	if target, _ := strconv.Atoi(id); c.Router.Admins[target] {
+		return c.Reply("admins can not be banned")
+	}
+
+	if err := database.BanTelegramUser(db, id); err != nil {
+		return err
+	}
+
+	slog.InfoContext(c.Context(), "telegram user banned", "banned", id)
+
+	return c.Reply(id + " banned, their commands and buttons are ignored")
+}
+
+func unbanCommand(c *telegram.Context) error {
+	id, err := adminTarget(c)
+	if err != nil {
+		return c.Reply(err.Error())
+	}
+
+	n, err := database.UnbanTelegramUser(db, id)
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return c.Reply(id + " is not banned")
+	}
+
+	return c.Reply(id + " unbanned")
+}
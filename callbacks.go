@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	database "github.com/ad/go-githublistener/db"
+	logging "github.com/ad/go-githublistener/logging"
+	poller "github.com/ad/go-githublistener/poller"
+	telegram "github.com/ad/go-githublistener/telegram"
+)
+
+const muteFor = time.Hour
+
+// Callback actions of list pagers
+const (
+	pageUserRepos = "rp"
+	pageChatRepos = "cp"
+)
+
+// actionForget confirms /forget
+const actionForget = "fg"
+
+func registerCallbacks(router *telegram.Router) {
+	router.HandleCallback(telegram.Handler{
+		Name:   poller.ActionMute,
+		Handle: muteCallback,
+	})
+
+	router.HandleCallback(telegram.Handler{
+		Name:   poller.ActionUnwatch,
+		Handle: unwatchCallback,
+	})
+
+	router.HandleCallback(telegram.Handler{
+		Name:   poller.ActionDiff,
+		Handle: diffCallback,
+	})
+
+	router.HandleCallback(telegram.Handler{
+		Name:   pageUserRepos,
+		Auth:   telegram.AuthUser,
+		Handle: userReposPageCallback,
+	})
+
+	router.HandleCallback(telegram.Handler{
+		Name:   pageChatRepos,
+		Handle: chatReposPageCallback,
+	})
+
+	router.HandleCallback(telegram.Handler{
+		Name:   actionForget,
+		Handle: forgetCallback,
+	})
+}
+
+// callbackSubscription loads subscription from button args and checks
+// that the user pressing the button may manage it
+func callbackSubscription(c *telegram.Context) (*database.UsersReposResult, error) {
+	id, err := strconv.ParseInt(c.Arg(0), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	item, err := database.GetUserRepoByID(db, id)
+	if err != nil {
+		return nil, fmt.Errorf("subscription not found")
+	}
+
+	if item.ChatID != 0 {
+		if admin, err := telegram.IsChatAdmin(c.Bot, item.ChatID, c.UserID()); err != nil || !admin {
+			return nil, fmt.Errorf("only chat admins can do that")
+		}
+	} else if item.TelegramUserID != strconv.Itoa(c.UserID()) {
+		return nil, fmt.Errorf("this is not your subscription")
+	}
+
+	return item, nil
+}
+
+func muteCallback(c *telegram.Context) error {
+	item, err := callbackSubscription(c)
+	if err != nil {
+		return c.Answer(err.Error())
+	}
+
+	if err := database.MuteUserRepoLink(db, item.ID, time.Now().Add(muteFor)); err != nil {
+		return err
+	}
+
+	slog.InfoContext(c.Context(), "repo muted", logging.KeyRepo, item.RepoName, "subscription", item.ID)
+
+	return c.Answer(item.RepoName + " muted for 1h")
+}
+
+func unwatchCallback(c *telegram.Context) error {
+	item, err := callbackSubscription(c)
+	if err != nil {
+		return c.Answer(err.Error())
+	}
+
+	if err := database.DeleteUserRepoLink(c.Context(), db, item); err != nil {
+		return err
+	}
+
+	slog.InfoContext(c.Context(), "repo removed", logging.KeyRepo, item.RepoName, "subscription", item.ID)
+
+	return c.Answer(item.RepoName + " removed")
+}
+
+func diffCallback(c *telegram.Context) error {
+	item, err := callbackSubscription(c)
+	if err != nil {
+		return c.Answer(err.Error())
+	}
+
+	commit, err := client.GetGithubCommit(c.Context(), item.Token, item.RepoName, c.Arg(1))
+	if err != nil {
+		_ = c.Answer("could not load commit")
+		return err
+	}
+
+	text := fmt.Sprintf("%s %s: %d files changed, +%d -%d\n", item.RepoName, c.Arg(1), len(commit.Files), commit.Stats.Additions, commit.Stats.Deletions)
+	for _, file := range commit.Files {
+		text += fmt.Sprintf("%s +%d -%d %s\n", file.Status, file.Additions, file.Deletions, file.Filename)
+	}
+
+	if err := c.Answer(""); err != nil {
+		slog.ErrorContext(c.Context(), "failed to answer callback", logging.Err(err))
+	}
+
+	return c.Reply(text)
+}
+
+func userReposPageCallback(c *telegram.Context) error {
+	if c.Arg(0) != c.User.TelegramUserID {
+		return c.Answer("this is not your list")
+	}
+
+	page, err := strconv.Atoi(c.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	return userReposPage(c, c.User, page)
+}
+
+func chatReposPageCallback(c *telegram.Context) error {
+	page, err := strconv.Atoi(c.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	return chatReposPage(c, c.Message.Chat.ID, page)
+}
+
+func forgetCallback(c *telegram.Context) error {
+	telegramUserID := strconv.Itoa(c.UserID())
+	if c.Arg(0) != telegramUserID {
+		return c.Answer("this is not your button")
+	}
+
+	accounts, err := database.GetGithubAccounts(db, telegramUserID)
+	if err != nil {
+		return err
+	}
+
+	if err := database.ForgetTelegramUser(db, telegramUserID); err != nil {
+		_ = c.Answer("could not delete your data")
+		return err
+	}
+
+	for _, account := range accounts {
+		client.ForgetToken(account.Token)
+	}
+
+	slog.InfoContext(c.Context(), "user data deleted")
+
+	if err := c.Answer(""); err != nil {
+		slog.ErrorContext(c.Context(), "failed to answer callback", logging.Err(err))
+	}
+
+	return c.Edit(c.Bot.Renderer.Escape("Everything stored about you was deleted, use /start to begin again"), nil)
+}
@@ -0,0 +1,1347 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	database "github.com/ad/go-githublistener/db"
+	logging "github.com/ad/go-githublistener/logging"
+	poller "github.com/ad/go-githublistener/poller"
+	telegram "github.com/ad/go-githublistener/telegram"
+	templates "github.com/ad/go-githublistener/templates"
+
+	tgbotapi "gopkg.in/telegram-bot-api.v4"
+)
+
+const reposPerPage = 20
+
+func registerCommands(router *telegram.Router) {
+	router.Handle(telegram.Handler{
+		Name:        "start",
+		Description: "link github account and show watched repos",
+		Aliases:     []string{"startgroup"},
+		Args:        telegram.RawArg,
+		Handle:      startCommand,
+	})
+
+	router.Handle(telegram.Handler{
+		Name:        "repos",
+		Description: "show watched repos",
+		Handle:      startCommand,
+	})
+
+	router.Handle(telegram.Handler{
+		Name:        "me",
+		Description: "show linked github account",
+		Auth:        telegram.AuthUser,
+		Handle:      meCommand,
+	})
+
+	router.Handle(telegram.Handler{
+		Name:        "add",
+		Description: "watch repo here or in a channel you admin",
+		Usage:       "owner/repo [@channel]",
+		Aliases:     []string{"link"},
+		Args:        telegram.RepoArg,
+		Auth:        telegram.AuthChatAdmin,
+		Handle:      addCommand,
+	})
+
+	router.Handle(telegram.Handler{
+		Name:        "delete",
+		Description: "stop watching repo here or in a channel you admin",
+		Usage:       "owner/repo [@channel]",
+		Aliases:     []string{"unlink"},
+		Args:        telegram.RepoArg,
+		Auth:        telegram.AuthChatAdmin,
+		Handle:      deleteCommand,
+	})
+
+	router.Handle(telegram.Handler{
+		Name:        "format",
+		Description: "choose notification format",
+		Usage:       "[compact|detailed]",
+		Args:        telegram.Fields,
+		Handle:      formatCommand,
+	})
+
+	router.Handle(telegram.Handler{
+		Name:        "preview",
+		Description: "show how notifications look",
+		Usage:       "[commit|release|pr|repo_removed] [compact|detailed]",
+		Args:        telegram.Fields,
+		Handle:      previewCommand,
+	})
+
+	router.Handle(telegram.Handler{
+		Name:        "delivery",
+		Description: "send commits at once, grouped per push or as a digest",
+		Usage:       "[owner/repo] immediate|push|hourly|daily [HH:MM]",
+		Args:        deliveryArgs,
+		Auth:        telegram.AuthChatAdmin,
+		Handle:      deliveryCommand,
+	})
+
+	router.Handle(telegram.Handler{
+		Name:        "quiet",
+		Description: "hold notifications during quiet hours",
+		Usage:       "HH:MM-HH:MM [time zone] | off",
+		Args:        telegram.Fields,
+		Handle:      quietCommand,
+	})
+
+	router.Handle(telegram.Handler{
+		Name:        "timezone",
+		Description: "set time zone used in messages",
+		Usage:       "Europe/Berlin",
+		Args:        telegram.Fields,
+		Handle:      timezoneCommand,
+	})
+
+	router.Handle(telegram.Handler{
+		Name:        "mute",
+		Description: "stop notifications of a repo for a while",
+		Usage:       "owner/repo [30m|2h|1d|1w] [summary]",
+		Args:        telegram.RepoArg,
+		Auth:        telegram.AuthChatAdmin,
+		Handle:      muteCommand,
+	})
+
+	router.Handle(telegram.Handler{
+		Name:        "pause",
+		Description: "stop all notifications for a while",
+		Usage:       "[30m|2h|1d|1w] [summary]",
+		Args:        telegram.Fields,
+		Auth:        telegram.AuthChatAdmin,
+		Handle:      pauseCommand,
+	})
+
+	router.Handle(telegram.Handler{
+		Name:        "resume",
+		Description: "resume muted or paused notifications",
+		Usage:       "[owner/repo]",
+		Args:        telegram.Fields,
+		Auth:        telegram.AuthChatAdmin,
+		Handle:      resumeCommand,
+	})
+
+	router.Handle(telegram.Handler{
+		Name:        "filter",
+		Description: "filter commits by author, path or message",
+		Usage:       "owner/repo [include|exclude author|path|message pattern] [remove id] [clear]",
+		Args:        filterArgs,
+		Auth:        telegram.AuthChatAdmin,
+		Handle:      filterCommand,
+	})
+
+	router.Handle(telegram.Handler{
+		Name:        "alert",
+		Description: "get alerted about a keyword in watched repos",
+		Usage:       "[keyword|@me]",
+		Args:        telegram.RawArg,
+		Auth:        telegram.AuthUser,
+		Handle:      alertCommand,
+	})
+
+	router.Handle(telegram.Handler{
+		Name:        "unalert",
+		Description: "remove keyword alert",
+		Usage:       "keyword|all",
+		Args:        telegram.RawArg,
+		Auth:        telegram.AuthUser,
+		Handle:      unalertCommand,
+	})
+
+	router.Handle(telegram.Handler{
+		Name:        "accounts",
+		Description: "list, add, switch and unlink github accounts",
+		Usage:       "[add] [default login] [use login owner/repo] [unlink login]",
+		Args:        telegram.Fields,
+		Auth:        telegram.AuthUser,
+		Handle:      accountsCommand,
+	})
+
+	router.Handle(telegram.Handler{
+		Name:        "forget",
+		Description: "delete everything stored about you",
+		Handle:      forgetCommand,
+	})
+
+	router.Handle(telegram.Handler{
+		Name:        "export",
+		Description: "get everything stored about you as a JSON file",
+		Handle:      exportCommand,
+	})
+
+	router.Handle(telegram.Handler{
+		Name:        "sources",
+		Description: "choose github repos watched automatically",
+		Usage:       "[watched] [starred] [owned] [orgs] | manual",
+		Args:        telegram.Fields,
+		Auth:        telegram.AuthUser,
+		Handle:      sourcesCommand,
+	})
+
+	router.Handle(telegram.Handler{
+		Name:        "addorg",
+		Description: "watch every repo of an organization",
+		Usage:       "org [name pattern]",
+		Args:        telegram.OwnerArg,
+		Auth:        telegram.AuthChatAdmin,
+		Handle:      ownerCommand(database.OwnerOrg),
+	})
+
+	router.Handle(telegram.Handler{
+		Name:        "adduser",
+		Description: "watch every public repo of a github user",
+		Usage:       "login [name pattern]",
+		Args:        telegram.OwnerArg,
+		Auth:        telegram.AuthChatAdmin,
+		Handle:      ownerCommand(database.OwnerUser),
+	})
+
+	router.Handle(telegram.Handler{
+		Name:        "delowner",
+		Description: "stop watching repos of an organization or user",
+		Usage:       "[owner]",
+		Args:        telegram.Fields,
+		Auth:        telegram.AuthChatAdmin,
+		Handle:      delOwnerCommand,
+	})
+}
+
+func startCommand(c *telegram.Context) error {
+	ghuser := &database.GithubUser{
+		TelegramUserID: strconv.Itoa(c.UserID()),
+	}
+
+	r := c.Bot.Renderer
+
+	greeting := ""
+	if token := c.Arg(0); c.Command != "repos" && token != "" {
+		if user, err := client.GetGithubUser(c.Context(), token); err == nil {
+			if user.Name != "" {
+				greeting = "Hi, " + user.Name
+			} else {
+				greeting = "Hi, " + user.UserName
+			}
+
+			ghuser.Name = user.Name
+			ghuser.UserName = user.UserName
+			ghuser.Token = token
+
+			previous, err2 := database.UpsertGithubUser(db, ghuser)
+			if err2 == nil {
+				// reload to get stored settings like sources
+				ghuser, err2 = database.GetGithubUserByID(db, ghuser.ID)
+			}
+			if err2 != nil {
+				return c.Reply(greeting + "\nError on save your token, try /start again\n" + err2.Error())
+			}
+
+			if previous != "" {
+				notifyAccountMoved(c, previous, ghuser.UserName)
+			}
+
+			// the account just authorized becomes the default one
+			if err := database.SetDefaultAccount(db, ghuser.TelegramUserID, ghuser.ID); err != nil {
+				slog.ErrorContext(c.Context(), "failed to set default account", logging.Err(err))
+			}
+		}
+	} else if c.Command == "repos" && telegram.IsGroup(c.Message.Chat) {
+		return chatReposCommand(c, c.Message.Chat.ID)
+	} else if c.User != nil {
+		ghuser = c.User
+	}
+
+	if ghuser.ID != 0 {
+		_, _, err := repoPoller.SyncUser(c.Context(), ghuser)
+		if err == nil {
+			if greeting != "" {
+				if err := c.Reply(greeting); err != nil {
+					slog.ErrorContext(c.Context(), "failed to send greeting", logging.Err(err))
+				}
+			}
+
+			return userReposPage(c, ghuser, 0)
+		}
+
+		slog.ErrorContext(c.Context(), "failed to sync repos", logging.Err(err))
+	}
+
+	return c.ReplyFormatted(r.Link("Click here to authorize bot in github", authorizeURL()) + r.Escape(", and then press START again"))
+}
+
+// notifyAccountMoved tells the previous owner that a github account was
+// linked to another telegram user
+func notifyAccountMoved(c *telegram.Context, previous, login string) {
+	chatID, err := strconv.ParseInt(previous, 10, 64)
+	if err != nil {
+		slog.ErrorContext(c.Context(), "wrong telegram user id", logging.Err(err))
+		return
+	}
+
+	slog.InfoContext(c.Context(), "github account moved", "github_user", login, "previous_telegram_user", previous)
+
+	text := "Github account " + login + " was linked to another Telegram account, its subscriptions are sent there now. " +
+		"If it was not you, revoke access of the bot in Github settings and /start again."
+	if err := c.Send(tgbotapi.NewMessage(chatID, text)); err != nil {
+		slog.ErrorContext(c.Context(), "failed to notify previous telegram user", logging.Err(err))
+	}
+}
+
+// authorizeURL returns github page linking an account to the bot
+func authorizeURL() string {
+	link := "https://github.com/login/oauth/authorize?client_id=" + url.QueryEscape(clientID) + "&redirect_uri=" + url.QueryEscape(httpRedirectURI)
+	if syncWatching {
+		link += "&scope=notifications"
+	}
+
+	return link
+}
+
+func meCommand(c *telegram.Context) error {
+	if c.User.Name != "" {
+		return c.Reply("Hi, " + c.User.Name)
+	}
+
+	return c.Reply("Hi, " + c.User.UserName)
+}
+
+func chatReposCommand(c *telegram.Context, chatID int64) error {
+	return chatReposPage(c, chatID, 0)
+}
+
+func userReposPage(c *telegram.Context, ghuser *database.GithubUser, page int) error {
+	items, err := database.GetUserSubscriptions(db, ghuser.ID)
+	if err != nil {
+		return err
+	}
+
+	if len(items) == 0 {
+		return c.Reply("You are not watching any repos, try /add owner/repo")
+	}
+
+	r := c.Bot.Renderer
+
+	now := time.Now()
+
+	var lines []string
+	for _, item := range items {
+		loc := item.Settings().Location()
+		line := r.RepoLink(item.RepoName) + r.Escape(" updated at: "+item.UpdatedAt.In(loc).Format("2006-01-02 15:04:05"))
+		if item.MutedUntil.After(now) {
+			if item.MutedUntil.Before(database.Forever) {
+				line += r.Escape(", muted until " + item.MutedUntil.In(loc).Format("2006-01-02 15:04"))
+			} else {
+				line += r.Escape(", muted")
+			}
+		}
+		lines = append(lines, line)
+	}
+
+	return replyPage(c, r.Escape("You are watching:"), lines, page, pageUserRepos, ghuser.TelegramUserID)
+}
+
+func chatReposPage(c *telegram.Context, chatID int64, page int) error {
+	repos, err := database.GetChatRepos(db, chatID)
+	if err != nil {
+		return err
+	}
+
+	if len(repos) == 0 {
+		return c.Reply("No repos linked to this chat, admins can /add owner/repo")
+	}
+
+	r := c.Bot.Renderer
+
+	var lines []string
+	for _, repo := range repos {
+		lines = append(lines, r.RepoLink(repo.RepoName))
+	}
+
+	return replyPage(c, r.Escape("This chat is watching:"), lines, page, pageChatRepos)
+}
+
+// replyPage sends a page of a long list, or replaces the list when a
+// Prev/Next button was pressed
+func replyPage(c *telegram.Context, header string, lines []string, page int, action string, args ...string) error {
+	pages := telegram.Paginate(lines, reposPerPage)
+	if page >= len(pages) {
+		page = len(pages) - 1
+	}
+
+	text := header
+	if len(pages) > 1 {
+		text += c.Bot.Renderer.Escape(fmt.Sprintf(" (page %d of %d)", page+1, len(pages)))
+	}
+	if page >= 0 {
+		text += "\n" + strings.Join(pages[page], "\n")
+	}
+
+	keyboard, err := c.Router.Pager(page, len(pages), action, args...)
+	if err != nil {
+		return err
+	}
+
+	if c.Callback != nil {
+		return c.Edit(text, keyboard)
+	}
+
+	msg := c.Bot.Renderer.Message(c.Message.Chat.ID, text)
+	msg.ReplyToMessageID = c.Message.MessageID
+	if keyboard != nil {
+		msg.ReplyMarkup = keyboard
+	}
+
+	return c.Send(msg)
+}
+
+// subscriptionChat returns group or channel a subscription command applies
+// to, nil means private chat of the user
+func subscriptionChat(c *telegram.Context) (*database.Chat, error) {
+	chat := c.Message.Chat
+
+	if ref := c.Arg(1); ref != "" {
+		target, err := telegram.ResolveChat(c.Bot, ref)
+		if err != nil {
+			return nil, err
+		}
+
+		if target.IsPrivate() {
+			return nil, fmt.Errorf("%s is not a group or channel", ref)
+		}
+
+		admin, err := telegram.IsChatAdmin(c.Bot, target.ID, c.UserID())
+		if err != nil || !admin {
+			return nil, fmt.Errorf("you must be an admin of %s", ref)
+		}
+
+		if target.IsChannel() {
+			if admin, err := telegram.IsChatAdmin(c.Bot, target.ID, c.Bot.Self.ID); err != nil || !admin {
+				return nil, fmt.Errorf("add bot as an admin of %s first", ref)
+			}
+		}
+
+		chat = &target
+	} else if !telegram.IsGroup(chat) {
+		return nil, nil
+	}
+
+	return database.AddChatIfNotExist(db, &database.Chat{
+		ChatID: chat.ID,
+		Type:   chat.Type,
+		Title:  chat.Title,
+	})
+}
+
+func deleteCommand(c *telegram.Context) error {
+	ghrepo, err := database.GetGithubRepoByNameFromDB(db, c.Arg(0))
+	if err != nil {
+		return c.Reply(err.Error())
+	}
+
+	chat, err := subscriptionChat(c)
+	if err != nil {
+		return c.Reply(err.Error())
+	}
+
+	if chat != nil {
+		if err := database.DeleteChatRepoLinkDB(db, chat.ChatID, ghrepo); err != nil {
+			return c.Reply(err.Error())
+		}
+
+		slog.InfoContext(c.Context(), "repo removed", logging.KeyRepo, ghrepo.RepoName)
+
+		return c.Reply(ghrepo.RepoName + " removed from " + chat.Title)
+	}
+
+	unwatched, err := unsubscribe(c.Context(), c.User, ghrepo)
+	if err != nil {
+		return c.Reply(err.Error())
+	}
+
+	slog.InfoContext(c.Context(), "repo removed", logging.KeyRepo, ghrepo.RepoName)
+
+	if unwatched {
+		return c.Reply(ghrepo.RepoName + " removed and unwatched on Github")
+	}
+
+	return c.Reply(ghrepo.RepoName + " removed")
+}
+
+// unsubscribe removes a private subscription and keeps repo sync from
+// linking it again while it is still watched, starred, owned or in a
+// watched org. With syncWatching the repo is unwatched on github as well
+func unsubscribe(ctx context.Context, user *database.GithubUser, ghrepo *database.GithubRepo) (unwatched bool, err error) {
+	if err := database.DeleteRepoUserLinkDB(db, user, ghrepo); err != nil {
+		return false, err
+	}
+
+	if err := database.AddRemovedRepo(db, user.ID, ghrepo.ID); err != nil {
+		return false, err
+	}
+
+	if !syncWatching {
+		return false, nil
+	}
+
+	if err := client.SetGithubSubscription(ctx, user.Token, ghrepo.RepoName, false); err != nil {
+		slog.ErrorContext(ctx, "failed to unwatch repo on github", logging.KeyRepo, ghrepo.RepoName, logging.Err(err))
+		return false, nil
+	}
+
+	return true, nil
+}
+
+func addCommand(c *telegram.Context) error {
+	chat, err := subscriptionChat(c)
+	if err != nil {
+		return c.Reply(err.Error())
+	}
+
+	var chatID int64
+	suffix := " added"
+	if chat != nil {
+		chatID = chat.ChatID
+		suffix += " to " + chat.Title
+	}
+
+	if ghrepo, err := database.GetGithubRepoByNameFromDB(db, c.Arg(0)); err == nil {
+		if err2 := database.AddChatRepoLinkIfNotExist(db, c.User, ghrepo, chatID, time.Now()); err2 != nil && err2.Error() != database.AlreadyExists {
+			return err2
+		}
+
+		if chat == nil {
+			return watchRepo(c, ghrepo, suffix)
+		}
+
+		return c.Reply(ghrepo.RepoName + suffix)
+	}
+
+	repo, err := client.GetGithubRepo(c.Context(), c.User.Token, c.Arg(0))
+	if err != nil || repo.FullName == "" {
+		return c.Reply(c.Arg(0) + " not found")
+	}
+
+	ghrepo := &database.GithubRepo{
+		Name:     repo.Name,
+		RepoName: repo.FullName,
+	}
+
+	dbrepo, err := database.AddRepoIfNotExist(c.Context(), db, ghrepo)
+	if err != nil && err.Error() != database.AlreadyExists {
+		return err
+	}
+
+	if err := database.AddChatRepoLinkIfNotExist(db, c.User, dbrepo, chatID, repo.UpdatedAt); err != nil && err.Error() != database.AlreadyExists {
+		return err
+	}
+
+	if chat == nil {
+		return watchRepo(c, dbrepo, suffix)
+	}
+
+	return c.Reply(ghrepo.RepoName + suffix)
+}
+
+// watchRepo undoes an earlier /delete of a privately added repo and watches
+// it on github when watch sync is enabled
+func watchRepo(c *telegram.Context, ghrepo *database.GithubRepo, suffix string) error {
+	if err := database.DeleteRemovedRepo(c.Context(), db, c.User.ID, ghrepo.ID); err != nil {
+		return err
+	}
+
+	if syncWatching {
+		if err := client.SetGithubSubscription(c.Context(), c.User.Token, ghrepo.RepoName, true); err != nil {
+			slog.ErrorContext(c.Context(), "failed to watch repo on github", logging.KeyRepo, ghrepo.RepoName, logging.Err(err))
+			return c.Reply(ghrepo.RepoName + suffix + ", could not watch it on Github: " + err.Error())
+		}
+		suffix += " and watched on Github"
+	}
+
+	return c.Reply(ghrepo.RepoName + suffix)
+}
+
+func formatCommand(c *telegram.Context) error {
+	telegramUserID := strconv.Itoa(c.UserID())
+
+	format := c.Arg(0)
+	if format == "" {
+		settings, err := database.GetTelegramUser(db, telegramUserID)
+		if err != nil {
+			return err
+		}
+
+		current := settings.Format
+		if current == "" {
+			current = templates.DefaultPreset
+		}
+
+		return c.Reply("Notification format: " + current + "\nChoose one of: /format " + strings.Join(templates.Presets, ", /format "))
+	}
+
+	if !templates.IsPreset(format) {
+		return c.Reply("Unknown format " + format + ", choose one of: " + strings.Join(templates.Presets, ", "))
+	}
+
+	if err := database.SetTelegramUserFormat(db, telegramUserID, format); err != nil {
+		return err
+	}
+
+	return c.Reply("Notification format set to " + format + ", see /preview")
+}
+
+func previewCommand(c *telegram.Context) error {
+	event, format := templates.EventCommit, c.Arg(1)
+
+	if arg := c.Arg(0); templates.IsPreset(arg) {
+		format = arg
+	} else if arg != "" {
+		event = arg
+	}
+
+	if !templates.IsEvent(event) {
+		return c.Reply("Unknown event " + event + ", choose one of: " + strings.Join(templates.Events, ", "))
+	}
+
+	if format == "" {
+		settings, err := database.GetTelegramUser(db, strconv.Itoa(c.UserID()))
+		if err != nil {
+			return err
+		}
+		format = settings.Format
+	}
+
+	if format == "" {
+		format = templates.DefaultPreset
+	}
+
+	text, err := notifications.Render(event, format, templates.Sample(event))
+	if err != nil {
+		return c.Reply("Template error: " + err.Error())
+	}
+
+	return c.ReplyFormatted(text)
+}
+
+// deliveryArgs returns repo (empty for every repo), delivery mode and digest time
+func deliveryArgs(raw string) ([]string, error) {
+	args := strings.Fields(raw)
+	if len(args) > 0 && !telegram.IsRepoName(args[0]) {
+		args = append([]string{""}, args...)
+	}
+
+	if len(args) < 2 || len(args) > 3 || !poller.IsDelivery(args[1]) {
+		return nil, fmt.Errorf("choose one of: %s", strings.Join(poller.Deliveries, ", "))
+	}
+
+	if len(args) == 2 {
+		args = append(args, "")
+	}
+
+	if _, err := poller.DigestSchedule(args[1], args[2], ""); err != nil {
+		return nil, err
+	}
+
+	if t, err := time.Parse("15:04", args[2]); err == nil {
+		args[2] = t.Format("15:04")
+	}
+
+	return args, nil
+}
+
+func deliveryCommand(c *telegram.Context) error {
+	var repoID int64
+	if repoName := c.Arg(0); repoName != "" {
+		ghrepo, err := database.GetGithubRepoByNameFromDB(db, repoName)
+		if err != nil {
+			return c.Reply(repoName + " not found")
+		}
+		repoID = ghrepo.ID
+	}
+
+	delivery, at := c.Arg(1), c.Arg(2)
+	if delivery == poller.DeliveryImmediate {
+		delivery = ""
+	}
+	if at == "" && (delivery == poller.DeliveryHourly || delivery == poller.DeliveryDaily) {
+		at = poller.DefaultDigestTime
+	}
+
+	n, err := database.SetDelivery(db, c.User.ID, commandChatID(c), repoID, delivery, at)
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return c.Reply("No subscriptions found, try /add owner/repo")
+	}
+
+	settings, err := database.GetTelegramUser(db, strconv.Itoa(c.UserID()))
+	if err != nil {
+		return err
+	}
+
+	text := fmt.Sprintf("Delivery set to %s for %d repos", c.Arg(1), n)
+	switch delivery {
+	case poller.DeliveryHourly:
+		text += fmt.Sprintf(", digest at :%s every hour", at[3:])
+	case poller.DeliveryDaily:
+		text += ", digest at " + at + " " + settings.Location().String()
+	}
+
+	return c.Reply(text)
+}
+
+func quietCommand(c *telegram.Context) error {
+	telegramUserID := strconv.Itoa(c.UserID())
+
+	settings, err := database.GetTelegramUser(db, telegramUserID)
+	if err != nil {
+		return err
+	}
+
+	switch window := c.Arg(0); window {
+	case "":
+		if settings.QuietStart == "" {
+			return c.Reply("Quiet hours are off, try /quiet 23:00-08:00 Europe/Berlin")
+		}
+
+		return c.Reply("Quiet hours: " + settings.QuietStart + "-" + settings.QuietEnd + " " + settings.Location().String())
+	case "off":
+		if err := database.SetTelegramUserQuiet(db, telegramUserID, "", ""); err != nil {
+			return err
+		}
+
+		return c.Reply("Quiet hours are off")
+	}
+
+	parts := strings.Split(c.Arg(0), "-")
+	if len(parts) != 2 {
+		return c.Reply("wrong quiet hours, try /quiet 23:00-08:00 Europe/Berlin")
+	}
+
+	for i, part := range parts {
+		t, err := time.Parse("15:04", part)
+		if err != nil {
+			return c.Reply("wrong time " + part + ", use HH:MM")
+		}
+		parts[i] = t.Format("15:04")
+	}
+
+	if parts[0] == parts[1] {
+		return c.Reply("quiet hours must not start and end at the same time")
+	}
+
+	if zone := c.Arg(1); zone != "" {
+		loc, err := time.LoadLocation(zone)
+		if err != nil {
+			return c.Reply("unknown time zone " + zone)
+		}
+
+		if err := database.SetTelegramUserTimezone(db, telegramUserID, loc.String()); err != nil {
+			return err
+		}
+		settings.Timezone = loc.String()
+	}
+
+	if err := database.SetTelegramUserQuiet(db, telegramUserID, parts[0], parts[1]); err != nil {
+		return err
+	}
+
+	return c.Reply("Quiet hours set to " + parts[0] + "-" + parts[1] + " " + settings.Location().String() + ", notifications will be sent as a summary afterwards")
+}
+
+func timezoneCommand(c *telegram.Context) error {
+	telegramUserID := strconv.Itoa(c.UserID())
+
+	zone := c.Arg(0)
+	if zone == "" {
+		settings, err := database.GetTelegramUser(db, telegramUserID)
+		if err != nil {
+			return err
+		}
+
+		return c.Reply("Time zone: " + settings.Location().String())
+	}
+
+	loc, err := time.LoadLocation(zone)
+	if err != nil {
+		return c.Reply("unknown time zone " + zone)
+	}
+
+	if err := database.SetTelegramUserTimezone(db, telegramUserID, loc.String()); err != nil {
+		return err
+	}
+
+	return c.Reply("Time zone set to " + loc.String())
+}
+
+// parseMuteArgs reads optional duration and summary flag, no duration
+// mutes until /resume
+func parseMuteArgs(args []string) (until time.Time, summary bool, err error) {
+	until = database.Forever
+
+	for _, arg := range args {
+		if arg == "summary" {
+			summary = true
+			continue
+		}
+
+		d, err := parseDuration(arg)
+		if err != nil || d <= 0 {
+			return until, summary, fmt.Errorf("wrong duration %s, try 30m, 2h, 1d or 1w", arg)
+		}
+		until = time.Now().Add(d)
+	}
+
+	return until, summary, nil
+}
+
+// parseDuration extends time.ParseDuration with days and weeks
+func parseDuration(s string) (time.Duration, error) {
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if n, err := strconv.Atoi(strings.TrimSuffix(s, suffix)); strings.HasSuffix(s, suffix) && err == nil {
+			return time.Duration(n) * unit, nil
+		}
+	}
+
+	return time.ParseDuration(s)
+}
+
+// muteReply describes mute result
+func muteReply(c *telegram.Context, what string, until time.Time, summary bool) error {
+	text := what + " muted until /resume"
+	if until.Before(database.Forever) {
+		settings, err := database.GetTelegramUser(db, strconv.Itoa(c.UserID()))
+		if err != nil {
+			return err
+		}
+
+		text = what + " muted until " + until.In(settings.Location()).Format("2006-01-02 15:04 MST")
+	}
+
+	if summary {
+		text += ", you will get a summary of missed commits"
+	}
+
+	return c.Reply(text)
+}
+
+// commandChatID returns chat whose subscriptions a command changes, 0 for
+// private subscriptions
+func commandChatID(c *telegram.Context) int64 {
+	if telegram.IsGroup(c.Message.Chat) {
+		return c.Message.Chat.ID
+	}
+
+	return 0
+}
+
+func muteCommand(c *telegram.Context) error {
+	ghrepo, err := database.GetGithubRepoByNameFromDB(db, c.Arg(0))
+	if err != nil {
+		return c.Reply(c.Arg(0) + " not found")
+	}
+
+	until, summary, err := parseMuteArgs(c.Args[1:])
+	if err != nil {
+		return c.Reply(err.Error())
+	}
+
+	n, err := database.MuteSubscriptions(db, c.User.ID, commandChatID(c), ghrepo.ID, until, summary)
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return c.Reply("You are not watching " + ghrepo.RepoName)
+	}
+
+	slog.InfoContext(c.Context(), "repo muted", logging.KeyRepo, ghrepo.RepoName, "until", until)
+
+	return muteReply(c, ghrepo.RepoName, until, summary)
+}
+
+func pauseCommand(c *telegram.Context) error {
+	until, summary, err := parseMuteArgs(c.Args)
+	if err != nil {
+		return c.Reply(err.Error())
+	}
+
+	n, err := database.MuteSubscriptions(db, c.User.ID, commandChatID(c), 0, until, summary)
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return c.Reply("No subscriptions found, try /add owner/repo")
+	}
+
+	slog.InfoContext(c.Context(), "repos paused", "count", n, "until", until)
+
+	return muteReply(c, fmt.Sprintf("%d repos", n), until, summary)
+}
+
+func resumeCommand(c *telegram.Context) error {
+	var repoID int64
+	if repoName := c.Arg(0); repoName != "" {
+		ghrepo, err := database.GetGithubRepoByNameFromDB(db, repoName)
+		if err != nil {
+			return c.Reply(repoName + " not found")
+		}
+		repoID = ghrepo.ID
+	}
+
+	n, err := database.MuteSubscriptions(db, c.User.ID, commandChatID(c), repoID, time.Time{}, false)
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return c.Reply("No subscriptions found, try /add owner/repo")
+	}
+
+	return c.Reply(fmt.Sprintf("Notifications resumed for %d repos", n))
+}
+
+var filterArgsRe = regexp.MustCompile(`^\s*(\S+)(?:\s+(\S+))?(?:\s+(\S+))?(?:\s+(.+?))?\s*$`)
+
+// filterArgs splits repo, action, kind and pattern which may contain spaces
+func filterArgs(raw string) ([]string, error) {
+	m := filterArgsRe.FindStringSubmatch(raw)
+	if m == nil || !telegram.IsRepoName(m[1]) {
+		return nil, fmt.Errorf("wrong repo format, try username/reponame instead")
+	}
+
+	return m[1:], nil
+}
+
+func filterCommand(c *telegram.Context) error {
+	ghrepo, err := database.GetGithubRepoByNameFromDB(db, c.Arg(0))
+	if err != nil {
+		return c.Reply(c.Arg(0) + " not found")
+	}
+
+	chatID := commandChatID(c)
+
+	switch action := c.Arg(1); action {
+	case "":
+	case "clear", "remove":
+		var id int64
+		if action == "remove" {
+			if id, err = strconv.ParseInt(strings.TrimPrefix(c.Arg(2), "#"), 10, 64); err != nil {
+				return c.Reply("usage: /filter owner/repo remove id")
+			}
+		}
+
+		n, err := database.DeleteFilters(db, c.User.ID, chatID, ghrepo.ID, id)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return c.Reply("No filters removed")
+		}
+	case database.FilterInclude, database.FilterExclude:
+		kind, pattern := c.Arg(2), c.Arg(3)
+		if pattern == "" {
+			return c.Reply("usage: /filter owner/repo " + action + " author|path|message pattern")
+		}
+
+		if _, err := poller.CompileFilter(kind, pattern); err != nil {
+			return c.Reply(err.Error())
+		}
+
+		if err := database.AddFilter(db, &database.Filter{
+			UserID:  c.User.ID,
+			ChatID:  chatID,
+			RepoID:  ghrepo.ID,
+			Kind:    kind,
+			Action:  action,
+			Pattern: pattern,
+		}); err != nil {
+			return err
+		}
+
+		slog.InfoContext(c.Context(), "filter added", logging.KeyRepo, ghrepo.RepoName, "action", action, "kind", kind, "pattern", pattern)
+	default:
+		return c.Reply("unknown action " + action + ", use include, exclude, remove or clear")
+	}
+
+	filters, err := database.GetFilters(c.Context(), db, c.User.ID, chatID, ghrepo.ID)
+	if err != nil {
+		return err
+	}
+
+	if len(filters) == 0 {
+		return c.Reply("No filters for " + ghrepo.RepoName + ", try /filter " + ghrepo.RepoName + " exclude author dependabot*")
+	}
+
+	lines := []string{"Filters of " + ghrepo.RepoName + ":"}
+	for _, filter := range filters {
+		lines = append(lines, fmt.Sprintf("#%d %s %s %s", filter.ID, filter.Action, filter.Kind, filter.Pattern))
+	}
+
+	return c.Reply(strings.Join(lines, "\n"))
+}
+
+// alertsBypass tells that alerts are not held like commit notifications
+const alertsBypass = "Alerts are sent right away, also during quiet hours and for muted or paused repos"
+
+func alertCommand(c *telegram.Context) error {
+	if keyword := strings.TrimSpace(c.Arg(0)); keyword != "" {
+		if err := database.AddAlert(db, c.User.ID, keyword); err != nil {
+			return err
+		}
+
+		slog.InfoContext(c.Context(), "alert added", "keyword", keyword)
+	}
+
+	alerts, err := database.GetUserAlerts(db, c.User.ID)
+	if err != nil {
+		return err
+	}
+
+	if len(alerts) == 0 {
+		return c.Reply("No alerts, try /alert CVE or /alert @me\n" + alertsBypass)
+	}
+
+	lines := []string{"You are alerted about commits, pull requests and releases of watched repos mentioning:"}
+	for _, alert := range alerts {
+		lines = append(lines, poller.AlertKeyword(alert.Pattern, c.User.UserName))
+	}
+	lines = append(lines, alertsBypass)
+
+	return c.Reply(strings.Join(lines, "\n"))
+}
+
+func unalertCommand(c *telegram.Context) error {
+	keyword := strings.TrimSpace(c.Arg(0))
+	if keyword == "" {
+		return c.Reply("usage: /unalert keyword|all")
+	}
+
+	if keyword == "all" {
+		keyword = ""
+	}
+
+	n, err := database.DeleteAlert(db, c.User.ID, keyword)
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return c.Reply("No such alert, see /alert")
+	}
+
+	return c.Reply(fmt.Sprintf("%d alerts removed", n))
+}
+
+// ownerChat returns chat an owner watch is added to, 0 for private chat
+func ownerChat(c *telegram.Context) (int64, error) {
+	chatID := commandChatID(c)
+	if chatID == 0 {
+		return 0, nil
+	}
+
+	chat, err := database.AddChatIfNotExist(db, &database.Chat{
+		ChatID: chatID,
+		Type:   c.Message.Chat.Type,
+		Title:  c.Message.Chat.Title,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return chat.ChatID, nil
+}
+
+func ownerCommand(kind string) telegram.HandlerFunc {
+	return func(c *telegram.Context) error {
+		owner, pattern := c.Arg(0), c.Arg(1)
+		if pattern != "" {
+			if _, err := poller.CompileFilter(database.FilterAuthor, pattern); err != nil {
+				return c.Reply(err.Error())
+			}
+		}
+
+		chatID, err := ownerChat(c)
+		if err != nil {
+			return err
+		}
+
+		watch := &database.OwnerWatch{
+			UserID:         c.User.ID,
+			ChatID:         chatID,
+			Owner:          owner,
+			Kind:           kind,
+			Pattern:        pattern,
+			Name:           c.User.Name,
+			TelegramUserID: c.User.TelegramUserID,
+			Token:          c.User.Token,
+		}
+
+		previous, err := ownerWatch(c.User.ID, chatID, owner)
+		if err != nil {
+			return err
+		}
+
+		// save the watch first so links made by the sync always belong to it
+		if err := database.AddOwnerWatch(db, watch); err != nil {
+			return err
+		}
+
+		added, removed, err := repoPoller.SyncOwner(c.Context(), watch)
+		if err != nil {
+			if previous != nil {
+				if err2 := database.AddOwnerWatch(db, previous); err2 != nil {
+					slog.ErrorContext(c.Context(), "failed to restore owner watch", logging.Err(err2))
+				}
+			} else if err2 := database.DeleteOwnerWatch(db, watch); err2 != nil {
+				slog.ErrorContext(c.Context(), "failed to delete owner watch", logging.Err(err2))
+			}
+			return c.Reply(err.Error())
+		}
+
+		slog.InfoContext(c.Context(), "owner watched", "kind", kind, "owner", owner, "pattern", pattern)
+
+		return c.ReplyFormatted(repoPoller.OwnerReport(owner, added, removed))
+	}
+}
+
+// ownerWatch returns the watch of owner added by the user to a chat, nil if
+// there is none
+func ownerWatch(userID, chatID int64, owner string) (*database.OwnerWatch, error) {
+	watches, err := database.GetUserOwnerWatches(db, userID, chatID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, watch := range watches {
+		if watch.UserID == userID && strings.EqualFold(watch.Owner, owner) {
+			return watch, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func delOwnerCommand(c *telegram.Context) error {
+	chatID := commandChatID(c)
+
+	watches, err := database.GetUserOwnerWatches(db, c.User.ID, chatID)
+	if err != nil {
+		return err
+	}
+
+	owner := strings.TrimPrefix(c.Arg(0), "@")
+	if owner == "" {
+		if len(watches) == 0 {
+			return c.Reply("No watched owners, try /addorg org or /adduser login")
+		}
+
+		lines := []string{"Watched owners:"}
+		for _, watch := range watches {
+			line := watch.Kind + " " + watch.Owner
+			if watch.Pattern != "" {
+				line += " " + watch.Pattern
+			}
+			lines = append(lines, line)
+		}
+
+		return c.Reply(strings.Join(lines, "\n"))
+	}
+
+	for _, watch := range watches {
+		if !strings.EqualFold(watch.Owner, owner) {
+			continue
+		}
+
+		if err := database.DeleteOwnerWatch(db, watch); err != nil {
+			return err
+		}
+
+		slog.InfoContext(c.Context(), "owner unwatched", "owner", watch.Owner)
+
+		return c.Reply("Repos of " + watch.Owner + " are not watched anymore")
+	}
+
+	return c.Reply(owner + " is not watched, see /delowner")
+}
+
+func sourcesCommand(c *telegram.Context) error {
+	if len(c.Args) > 0 {
+		var sources []string
+		seen := make(map[string]bool)
+		for _, arg := range c.Args {
+			source := strings.ToLower(arg)
+			if source == database.SourceManual {
+				sources = nil
+				break
+			}
+
+			if !database.IsUserSource(source) {
+				return c.Reply("unknown source " + arg + ", use " + strings.Join(database.UserSources, ", ") + " or manual")
+			}
+
+			if !seen[source] {
+				seen[source] = true
+				sources = append(sources, source)
+			}
+		}
+
+		if err := database.SetUserSources(db, c.User.ID, sources); err != nil {
+			return err
+		}
+		c.User.Sources = strings.Join(sources, ",")
+
+		slog.InfoContext(c.Context(), "sources changed", "sources", c.User.Sources)
+
+		added, removed, err := repoPoller.SyncUser(c.Context(), c.User)
+		if err != nil {
+			return c.Reply(err.Error())
+		}
+
+		if len(added) > 0 || len(removed) > 0 {
+			return c.ReplyFormatted(repoPoller.SourcesReport(added, removed))
+		}
+	}
+
+	sources := c.User.SourceList()
+	if len(sources) == 0 {
+		return c.Reply("Only repos added with /add are watched, try /sources watched starred")
+	}
+
+	return c.Reply("Repos are watched automatically from: " + strings.Join(sources, ", "))
+}
+
+func accountsCommand(c *telegram.Context) error {
+	r := c.Bot.Renderer
+
+	accounts, err := database.GetGithubAccounts(db, c.User.TelegramUserID)
+	if err != nil {
+		return err
+	}
+
+	var account *database.GithubUser
+	if login := c.Arg(1); login != "" {
+		for _, a := range accounts {
+			if strings.EqualFold(a.UserName, strings.TrimPrefix(login, "@")) {
+				account = a
+			}
+		}
+
+		if account == nil {
+			return c.Reply(login + " is not linked, see /accounts")
+		}
+	}
+
+	switch action := c.Arg(0); action {
+	case "":
+	case "add":
+		return c.ReplyFormatted(r.Link("Authorize another github account", authorizeURL()) + r.Escape(", it becomes the default one"))
+	case "default", "use", "unlink":
+		if account == nil {
+			return c.Reply("usage: /accounts " + action + " login")
+		}
+
+		switch action {
+		case "default":
+			if err := database.SetDefaultAccount(db, c.User.TelegramUserID, account.ID); err != nil {
+				return err
+			}
+			c.User = account
+		case "use":
+			ghrepo, err := database.GetGithubRepoByNameFromDB(db, c.Arg(2))
+			if err != nil {
+				return c.Reply("usage: /accounts use login owner/repo")
+			}
+
+			n, err := database.MoveSubscriptions(db, c.User.ID, commandChatID(c), ghrepo.ID, account.ID)
+			if err != nil {
+				return err
+			}
+			if n == 0 {
+				return c.Reply("You are not watching " + ghrepo.RepoName)
+			}
+
+			return c.Reply(ghrepo.RepoName + " is checked with token of " + account.UserName)
+		case "unlink":
+			if err := database.DeleteGithubUser(db, account.ID); err != nil {
+				return err
+			}
+			client.ForgetToken(account.Token)
+
+			slog.InfoContext(c.Context(), "github account unlinked", "account", account.UserName)
+
+			if accounts, err = database.GetGithubAccounts(db, c.User.TelegramUserID); err != nil {
+				return err
+			}
+			if len(accounts) == 0 {
+				return c.Reply(account.UserName + " unlinked, use /start to link an account again")
+			}
+			if account.ID == c.User.ID {
+				c.User = accounts[0]
+			}
+		}
+	default:
+		return c.Reply("unknown action " + action + ", use add, default, use or unlink")
+	}
+
+	lines := []string{"Linked github accounts:"}
+	for _, a := range accounts {
+		line := a.UserName
+		if a.ID == c.User.ID {
+			line += " (default)"
+		}
+		lines = append(lines, line)
+	}
+
+	return c.Reply(strings.Join(lines, "\n"))
+}
+
+func forgetCommand(c *telegram.Context) error {
+	if telegram.IsGroup(c.Message.Chat) {
+		return c.Reply("Use /forget in a private chat with the bot")
+	}
+
+	button, err := c.Router.Button("Delete everything", actionForget, strconv.Itoa(c.UserID()))
+	if err != nil {
+		return err
+	}
+
+	msg := tgbotapi.NewMessage(c.Message.Chat.ID, "This deletes your github tokens, subscriptions including ones you added to chats, filters, alerts, settings and message log. Get a copy with /export first.")
+	msg.ReplyToMessageID = c.Message.MessageID
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(button))
+
+	return c.Send(msg)
+}
+
+func exportCommand(c *telegram.Context) error {
+	if telegram.IsGroup(c.Message.Chat) {
+		return c.Reply("Use /export in a private chat with the bot")
+	}
+
+	export, err := database.ExportTelegramUser(db, strconv.Itoa(c.UserID()))
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(export, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	doc := tgbotapi.NewDocumentUpload(c.Message.Chat.ID, tgbotapi.FileBytes{Name: "githublistener-export.json", Bytes: data})
+	doc.ReplyToMessageID = c.Message.MessageID
+
+	return c.Send(doc)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	database "github.com/ad/go-githublistener/db"
+	ghapi "github.com/ad/go-githublistener/ghapi"
+)
+
+// roundTripFunc answers requests of the github client in tests
+type roundTripFunc func(r *http.Request) *http.Response
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r), nil
+}
+
+// useTestDB points the db global to a fresh database
+func useTestDB(t *testing.T) {
+	t.Helper()
+
+	testDB, err := database.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	previous := db
+	db = testDB
+	t.Cleanup(func() {
+		db = previous
+		testDB.Close()
+	})
+}
+
+// useTestGithub answers github api calls with status
+func useTestGithub(t *testing.T, status int, requests *[]string) {
+	t.Helper()
+
+	previous := client
+	client = ghapi.NewClient("id", "secret")
+	client.HTTPClient.Transport = roundTripFunc(func(r *http.Request) *http.Response {
+		*requests = append(*requests, r.Method+" "+r.URL.Path)
+		return &http.Response{StatusCode: status, Status: http.StatusText(status), Header: http.Header{}, Body: io.NopCloser(strings.NewReader(`{}`))}
+	})
+	t.Cleanup(func() { client = previous })
+}
+
+func TestUnsubscribeRemembersRemovedRepo(t *testing.T) {
+	tests := []struct {
+		name          string
+		syncWatching  bool
+		status        int
+		wantUnwatched bool
+		wantRequests  int
+	}{
+		{"local only", false, http.StatusNoContent, false, 0},
+		{"unwatched on github", true, http.StatusNoContent, true, 1},
+		{"github fails", true, http.StatusBadGateway, false, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestDB(t)
+
+			var requests []string
+			useTestGithub(t, tt.status, &requests)
+
+			previous := syncWatching
+			syncWatching = tt.syncWatching
+			t.Cleanup(func() { syncWatching = previous })
+
+			if _, err := db.Exec(`INSERT INTO github_users (id, name, user_name, token, telegram_user_id) VALUES (1, "Octo Cat", "octocat", "token", 42)`); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := db.Exec(`INSERT INTO github_repos (id, name, repo_name) VALUES (7, "hello", "octo/hello")`); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := db.Exec(`INSERT INTO users_repos (user_id, repo_id, source) VALUES (1, 7, "starred")`); err != nil {
+				t.Fatal(err)
+			}
+
+			user := &database.GithubUser{ID: 1, Token: "token"}
+			unwatched, err := unsubscribe(context.Background(), user, &database.GithubRepo{ID: 7, RepoName: "octo/hello"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if unwatched != tt.wantUnwatched || len(requests) != tt.wantRequests {
+				t.Errorf("unwatched %t with requests %v, want %t with %d requests", unwatched, requests, tt.wantUnwatched, tt.wantRequests)
+			}
+
+			var links int
+			if err := db.QueryRow(`SELECT COUNT(*) FROM users_repos`).Scan(&links); err != nil {
+				t.Fatal(err)
+			}
+			if links != 0 {
+				t.Errorf("%d subscriptions left, want none", links)
+			}
+
+			removed, err := database.GetRemovedRepos(context.Background(), db, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(removed) != 1 || removed[0].RepoName != "octo/hello" {
+				t.Errorf("removed repos %+v, want octo/hello so repo sync does not link it again", removed)
+			}
+		})
+	}
+}
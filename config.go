@@ -0,0 +1,362 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	logging "github.com/ad/go-githublistener/logging"
+	telegram "github.com/ad/go-githublistener/telegram"
+
+	cron "github.com/robfig/cron/v3"
+	yaml "gopkg.in/yaml.v3"
+)
+
+// configEnv names the config file when -config is not given
+const configEnv = "GO_GITHUB_LISTENER_CONFIG"
+
+// fileSuffix marks an env variable or config key holding the path of a
+// file with the value, e.g. docker secrets
+const fileSuffix = "_FILE"
+
+// setting binds a flag to its env variable
+type setting struct {
+	flag   string
+	env    string
+	secret bool
+}
+
+// settings are layered from lowest to highest priority: flag defaults,
+// the config file, env variables and command line flags
+var settings = []setting{
+	{flag: "client_id", env: "GO_GITHUB_LISTENER_CLIENT_ID"},
+	{flag: "client_secret", env: "GO_GITHUB_LISTENER_CLIENT_SECRET", secret: true},
+	{flag: "http_port", env: "GO_GITHUB_LISTENER_PORT"},
+	{flag: "http_redirect_uri", env: "GO_GITHUB_LISTENER_HTTP_REDIRECT_URI"},
+	{flag: "telegram_token", env: "GO_GITHUB_LISTENER_TELEGRAM_TOKEN", secret: true},
+	{flag: "telegram_proxy_host", env: "GO_GITHUB_LISTENER_TELEGRAM_PROXY_HOST"},
+	{flag: "telegram_proxy_port", env: "GO_GITHUB_LISTENER_TELEGRAM_PROXY_PORT"},
+	{flag: "telegram_proxy_user", env: "GO_GITHUB_LISTENER_TELEGRAM_PROXY_USER"},
+	{flag: "telegram_proxy_password", env: "GO_GITHUB_LISTENER_TELEGRAM_PROXY_PASSWORD", secret: true},
+	{flag: "telegram_debug", env: "GO_GITHUB_LISTENER_TELEGRAM_DEBUG"},
+	{flag: "telegram_parse_mode", env: "GO_GITHUB_LISTENER_TELEGRAM_PARSE_MODE"},
+	{flag: "templates_file", env: "GO_GITHUB_LISTENER_TEMPLATES_FILE"},
+	{flag: "callback_secret", env: "GO_GITHUB_LISTENER_CALLBACK_SECRET", secret: true},
+	{flag: "check_repos_every", env: "GO_GITHUB_LISTENER_CHECK_REPOS_EVERY"},
+	{flag: "check_commits_every", env: "GO_GITHUB_LISTENER_CHECK_COMMITS_EVERY"},
+	{flag: "sync_watching", env: "GO_GITHUB_LISTENER_SYNC_WATCHING"},
+	{flag: "admins", env: "GO_GITHUB_LISTENER_ADMINS"},
+	{flag: "log_messages", env: "GO_GITHUB_LISTENER_LOG_MESSAGES"},
+	{flag: "messages_retention", env: "GO_GITHUB_LISTENER_MESSAGES_RETENTION"},
+	{flag: "commands_per_minute", env: "GO_GITHUB_LISTENER_COMMANDS_PER_MINUTE"},
+	{flag: "ready_tick_age", env: "GO_GITHUB_LISTENER_READY_TICK_AGE"},
+	{flag: "log_level", env: "GO_GITHUB_LISTENER_LOG_LEVEL"},
+	{flag: "log_format", env: "GO_GITHUB_LISTENER_LOG_FORMAT"},
+	{flag: "metrics_addr", env: "GO_GITHUB_LISTENER_METRICS_ADDR"},
+	{flag: "metrics_labels", env: "GO_GITHUB_LISTENER_METRICS_LABELS"},
+}
+
+// Sources of a setting value, shown by -print-config
+const (
+	sourceDefault = "default"
+	sourceFile    = "file"
+	sourceEnv     = "env"
+	sourceFlag    = "flag"
+)
+
+// loadConfig sets flags missing on the command line from env variables
+// and the config file at path, an invalid value is an error instead of
+// falling back to the default. It returns where each value came from
+func loadConfig(fs *flag.FlagSet, path string) (map[string]string, error) {
+	sources := make(map[string]string, len(settings))
+	fs.Visit(func(f *flag.Flag) {
+		sources[f.Name] = sourceFlag
+	})
+
+	file, err := readConfigFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var errs []error
+	for _, s := range settings {
+		if sources[s.flag] != "" {
+			continue
+		}
+
+		value, source, err := s.lookup(file)
+		switch {
+		case err != nil:
+			errs = append(errs, err)
+			continue
+		case source == "":
+			sources[s.flag] = sourceDefault
+			continue
+		}
+
+		if err := fs.Set(s.flag, value); err != nil {
+			name := s.env
+			if source == sourceFile {
+				name = s.flag + " in " + path
+			}
+			errs = append(errs, fmt.Errorf("%s: wrong value %s", name, s.display(value)))
+			continue
+		}
+		sources[s.flag] = source
+	}
+
+	return sources, errors.Join(errs...)
+}
+
+// lookup returns value of the setting from env variables or the config
+// file, an empty source means it is not set. Empty env variables count as
+// unset, docker compose passes them for every missing .env entry
+func (s setting) lookup(file map[string]string) (value, source string, err error) {
+	value = os.Getenv(s.env)
+	path := os.Getenv(s.env + fileSuffix)
+	ok, fromFile := value != "", path != ""
+	switch {
+	case ok && fromFile:
+		return "", "", fmt.Errorf("%s and %s are both set", s.env, s.env+fileSuffix)
+	case ok:
+		return value, sourceEnv, nil
+	case fromFile:
+		value, err = readSecret(path)
+		if err != nil {
+			return "", "", fmt.Errorf("%s: %w", s.env+fileSuffix, err)
+		}
+		return value, sourceEnv, nil
+	}
+
+	value, ok = file[s.flag]
+	path, fromFile = file[s.flag+strings.ToLower(fileSuffix)]
+	switch {
+	case ok && fromFile:
+		return "", "", fmt.Errorf("%s and %s are both set in config file", s.flag, s.flag+strings.ToLower(fileSuffix))
+	case ok:
+		return value, sourceFile, nil
+	case fromFile:
+		value, err = readSecret(path)
+		if err != nil {
+			return "", "", fmt.Errorf("%s: %w", s.flag+strings.ToLower(fileSuffix), err)
+		}
+		return value, sourceFile, nil
+	}
+
+	return "", "", nil
+}
+
+// display returns value for messages, secrets are masked
+func (s setting) display(value string) string {
+	if s.secret && value != "" {
+		return logging.Redacted
+	}
+
+	return strconv.Quote(value)
+}
+
+// readSecret reads a value from file dropping the trailing newline
+func readSecret(path string) (string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
+
+// readConfigFile reads a flat YAML mapping of flag names to values, lists
+// are joined with commas. Unknown keys are an error so typos don't go
+// unnoticed
+func readConfigFile(path string) (map[string]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc map[string]yaml.Node
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	known := make(map[string]bool, 2*len(settings))
+	for _, s := range settings {
+		known[s.flag] = true
+		known[s.flag+strings.ToLower(fileSuffix)] = true
+	}
+
+	keys := make([]string, 0, len(doc))
+	for key := range doc {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return doc[keys[i]].Line < doc[keys[j]].Line })
+
+	values := make(map[string]string, len(doc))
+	var errs []error
+	for _, key := range keys {
+		node := doc[key]
+		if !known[key] {
+			errs = append(errs, fmt.Errorf("%s: unknown setting %q", path, key))
+			continue
+		}
+
+		value, err := nodeValue(&node)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %s at line %d: %w", path, key, node.Line, err))
+			continue
+		}
+		if value != nil {
+			values[key] = *value
+		}
+	}
+
+	return values, errors.Join(errs...)
+}
+
+// nodeValue returns text of a scalar or a list of scalars, nil for null
+func nodeValue(node *yaml.Node) (*string, error) {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		if node.Tag == "!!null" {
+			return nil, nil
+		}
+		return &node.Value, nil
+	case yaml.SequenceNode:
+		items := make([]string, 0, len(node.Content))
+		for _, item := range node.Content {
+			if item.Kind != yaml.ScalarNode {
+				return nil, errors.New("list items must be plain values")
+			}
+			items = append(items, item.Value)
+		}
+		value := strings.Join(items, ",")
+		return &value, nil
+	}
+
+	return nil, errors.New("value must be a plain value or a list")
+}
+
+// validateConfig checks settings that would otherwise fail late or be
+// silently ignored
+func validateConfig() error {
+	var errs []error
+	check := func(name string, err error) {
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+
+	required := map[string]string{
+		"client_id":      clientID,
+		"client_secret":  clientSecret,
+		"telegram_token": telegramToken,
+	}
+	for _, s := range settings {
+		if value, ok := required[s.flag]; ok && value == "" {
+			errs = append(errs, fmt.Errorf("%s: required, set -%s or %s", s.flag, s.flag, s.env))
+		}
+	}
+
+	if httpPort < 1 || httpPort > 65535 {
+		check("http_port", fmt.Errorf("%d is not a port", httpPort))
+	}
+	check("http_redirect_uri", validateURL(httpRedirectURI))
+
+	if telegramProxyHost != "" {
+		if port, err := strconv.Atoi(telegramProxyPort); err != nil || port < 1 || port > 65535 {
+			check("telegram_proxy_port", fmt.Errorf("%q is not a port", telegramProxyPort))
+		}
+	}
+
+	_, err := telegram.ParseMode(parseMode)
+	check("telegram_parse_mode", err)
+
+	_, err = cron.ParseStandard(checkReposEvery)
+	check("check_repos_every", err)
+	_, err = cron.ParseStandard(checkCommitsEvery)
+	check("check_commits_every", err)
+
+	_, err = parseAdmins(adminIDs)
+	check("admins", err)
+
+	if messagesRetention < 0 {
+		check("messages_retention", errors.New("must not be negative"))
+	}
+	if commandsPerMinute < 1 {
+		check("commands_per_minute", errors.New("must be positive"))
+	}
+	if readyTickAge <= 0 {
+		check("ready_tick_age", errors.New("must be positive"))
+	}
+
+	if metricsAddr != "" {
+		_, _, err = net.SplitHostPort(metricsAddr)
+		check("metrics_addr", err)
+	}
+
+	_, err = logging.New(io.Discard, logLevel, logFormat)
+	check("log_level, log_format", err)
+
+	return errors.Join(errs...)
+}
+
+// validateURL accepts absolute http and https urls
+func validateURL(s string) error {
+	u, err := url.Parse(s)
+	if err != nil {
+		return err
+	}
+
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%q is not an absolute http url", s)
+	}
+
+	return nil
+}
+
+// printConfig writes the effective settings as a config file, secrets are
+// masked and comments tell where each value came from
+func printConfig(w io.Writer, fs *flag.FlagSet, sources map[string]string) error {
+	doc := &yaml.Node{Kind: yaml.MappingNode}
+
+	for _, s := range settings {
+		value := fs.Lookup(s.flag).Value.String()
+		if s.secret && value != "" {
+			value = logging.Redacted
+		}
+
+		// an empty value is quoted, bare it reads back as unset
+		node := &yaml.Node{Kind: yaml.ScalarNode, Value: value, LineComment: sources[s.flag]}
+		if value == "" {
+			node.Style = yaml.DoubleQuotedStyle
+		}
+
+		doc.Content = append(doc.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: s.flag}, node)
+	}
+
+	e := yaml.NewEncoder(w)
+	e.SetIndent(2)
+	if err := e.Encode(doc); err != nil {
+		return err
+	}
+
+	return e.Close()
+}
+
+// configError reports wrong settings and exits with the status flag uses
+// for usage errors
+func configError(err error) {
+	fmt.Fprintf(os.Stderr, "wrong configuration:\n%v\n", err)
+	os.Exit(2)
+}
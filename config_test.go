@@ -0,0 +1,292 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newFlagSet resets settings to their defaults and clears env variables
+// that would override them
+func newFlagSet(t *testing.T) *flag.FlagSet {
+	t.Helper()
+
+	for _, s := range settings {
+		t.Setenv(s.env, "")
+		t.Setenv(s.env+fileSuffix, "")
+	}
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	registerFlags(fs)
+
+	return fs
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestLoadConfigLayers(t *testing.T) {
+	fs := newFlagSet(t)
+
+	secret := writeFile(t, "telegram_token", "123:secret\n")
+	config := writeFile(t, "config.yaml", `client_id: from-file
+client_secret: file-secret
+http_port: 8000
+telegram_token_file: `+secret+`
+admins: [12345, 67890]
+log_level: debug
+templates_file: ~
+`)
+
+	t.Setenv("GO_GITHUB_LISTENER_PORT", "9000")
+	t.Setenv("GO_GITHUB_LISTENER_LOG_LEVEL", "warn")
+	if err := fs.Parse([]string{"-log_level=error"}); err != nil {
+		t.Fatal(err)
+	}
+
+	sources, err := loadConfig(fs, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		flag   string
+		got    interface{}
+		want   interface{}
+		source string
+	}{
+		{"client_id", clientID, "from-file", sourceFile},
+		{"http_port", httpPort, 9000, sourceEnv},
+		{"telegram_token", telegramToken, "123:secret", sourceFile},
+		{"admins", adminIDs, "12345,67890", sourceFile},
+		{"log_level", logLevel, "error", sourceFlag},
+		{"log_format", logFormat, "text", sourceDefault},
+		{"templates_file", templatesFile, "", sourceDefault},
+	}
+
+	for _, tt := range tests {
+		if tt.got != tt.want || sources[tt.flag] != tt.source {
+			t.Errorf("%s = %v from %s, want %v from %s", tt.flag, tt.got, sources[tt.flag], tt.want, tt.source)
+		}
+	}
+}
+
+func TestLoadConfigSecretFromEnvFile(t *testing.T) {
+	fs := newFlagSet(t)
+
+	t.Setenv("GO_GITHUB_LISTENER_CLIENT_SECRET_FILE", writeFile(t, "secret", "s3cret\r\n"))
+
+	sources, err := loadConfig(fs, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if clientSecret != "s3cret" || sources["client_secret"] != sourceEnv {
+		t.Errorf("client_secret = %q from %s, want s3cret from env", clientSecret, sources["client_secret"])
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		env    map[string]string
+		config string
+		want   []string
+	}{
+		{
+			name: "wrong env value",
+			env:  map[string]string{"GO_GITHUB_LISTENER_PORT": "eighty"},
+			want: []string{`GO_GITHUB_LISTENER_PORT: wrong value "eighty"`},
+		},
+		{
+			name: "wrong bool",
+			env:  map[string]string{"GO_GITHUB_LISTENER_LOG_MESSAGES": "maybe"},
+			want: []string{`GO_GITHUB_LISTENER_LOG_MESSAGES: wrong value "maybe"`},
+		},
+		{
+			name: "env and file both set",
+			env:  map[string]string{"GO_GITHUB_LISTENER_TELEGRAM_TOKEN": "a", "GO_GITHUB_LISTENER_TELEGRAM_TOKEN_FILE": "/run/secrets/token"},
+			want: []string{"GO_GITHUB_LISTENER_TELEGRAM_TOKEN and GO_GITHUB_LISTENER_TELEGRAM_TOKEN_FILE are both set"},
+		},
+		{
+			name: "missing secret file",
+			env:  map[string]string{"GO_GITHUB_LISTENER_CLIENT_SECRET_FILE": "/nonexistent/secret"},
+			want: []string{"GO_GITHUB_LISTENER_CLIENT_SECRET_FILE:"},
+		},
+		{
+			name:   "unknown and wrong keys",
+			config: "clientid: x\nlog_level: debug\nadmins: [{a: 1}]\n",
+			want:   []string{`unknown setting "clientid"`, "admins at line 3"},
+		},
+		{
+			name:   "wrong file value",
+			config: "messages_retention: 30 days\n",
+			want:   []string{`messages_retention in `, `wrong value "30 days"`},
+		},
+		{
+			name:   "value and file in config",
+			config: "client_secret: a\nclient_secret_file: /run/secrets/b\n",
+			want:   []string{"client_secret and client_secret_file are both set in config file"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := newFlagSet(t)
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+
+			path := ""
+			if tt.config != "" {
+				path = writeFile(t, "config.yaml", tt.config)
+			}
+
+			_, err := loadConfig(fs, path)
+			if err == nil {
+				t.Fatal("no error")
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error %q does not mention %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestSettingDisplay(t *testing.T) {
+	tests := []struct {
+		setting setting
+		value   string
+		want    string
+	}{
+		{setting{flag: "http_port"}, "eighty", `"eighty"`},
+		{setting{flag: "client_secret", secret: true}, "hunter2", "[redacted]"},
+		{setting{flag: "client_secret", secret: true}, "", `""`},
+	}
+
+	for _, tt := range tests {
+		if got := tt.setting.display(tt.value); got != tt.want {
+			t.Errorf("%s display(%q) = %q, want %q", tt.setting.flag, tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{name: "valid"},
+		{
+			name: "missing required",
+			args: []string{"-client_id=", "-telegram_token="},
+			want: []string{"client_id: required", "telegram_token: required"},
+		},
+		{
+			name: "wrong values",
+			args: []string{
+				"-http_port=0",
+				"-http_redirect_uri=/oauth/redirect",
+				"-telegram_parse_mode=markdown",
+				"-check_commits_every=every minute",
+				"-admins=1,me",
+				"-commands_per_minute=0",
+				"-metrics_addr=9090",
+				"-log_format=xml",
+			},
+			want: []string{"http_port", "http_redirect_uri", "telegram_parse_mode", "check_commits_every", "admins", "commands_per_minute", "metrics_addr", "log_format"},
+		},
+		{
+			name: "proxy port checked only with a proxy",
+			args: []string{"-telegram_proxy_host=proxy", "-telegram_proxy_port=socks"},
+			want: []string{"telegram_proxy_port"},
+		},
+		{
+			name: "metrics off",
+			args: []string{"-metrics_addr="},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := newFlagSet(t)
+			args := append([]string{"-client_id=id", "-client_secret=secret", "-telegram_token=123:abc"}, tt.args...)
+			if err := fs.Parse(args); err != nil {
+				t.Fatal(err)
+			}
+
+			err := validateConfig()
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("no error")
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error %q does not mention %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestPrintConfig(t *testing.T) {
+	fs := newFlagSet(t)
+	if err := fs.Parse([]string{"-telegram_token=123:secret", "-client_id=id"}); err != nil {
+		t.Fatal(err)
+	}
+
+	sources, err := loadConfig(fs, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var b bytes.Buffer
+	if err := printConfig(&b, fs, sources); err != nil {
+		t.Fatal(err)
+	}
+	out := b.String()
+
+	for _, want := range []string{
+		"client_id: id # flag\n",
+		"telegram_token: '[redacted]' # flag\n",
+		"client_secret: \"\" # default\n",
+		"log_level: info # default\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output does not contain %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "123:secret") {
+		t.Errorf("output leaks the token:\n%s", out)
+	}
+
+	// printed config loads back with the same values
+	printed := writeFile(t, "printed.yaml", strings.Replace(out, "metrics_addr: 127.0.0.1:9090", `metrics_addr: ""`, 1))
+	fs = newFlagSet(t)
+	if _, err := loadConfig(fs, printed); err != nil {
+		t.Fatalf("printed config does not load: %v", err)
+	}
+	if clientID != "id" || clientSecret != "" || metricsAddr != "" || checkReposEvery != "*/15 * * * *" {
+		t.Errorf("printed config loaded client_id %q, client_secret %q, metrics_addr %q, check_repos_every %q", clientID, clientSecret, metricsAddr, checkReposEvery)
+	}
+}
@@ -0,0 +1,159 @@
+package db
+
+import (
+	s "database/sql"
+	"fmt"
+	"time"
+
+	sql "github.com/lazada/sqle"
+)
+
+// accountsOf matches column against every github account linked to the
+// same telegram user as the account id passed as argument
+func accountsOf(column string) string {
+	return column + ` IN (SELECT id FROM github_users WHERE telegram_user_id = (SELECT telegram_user_id FROM github_users WHERE id = ?))`
+}
+
+// UpsertGithubUser adds a github account or updates name, token and
+// telegram user of an existing one, previous is the telegram user who owned
+// the account when ownership moves
+func UpsertGithubUser(db *sql.DB, user *GithubUser) (previous string, err error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return "", err
+	}
+
+	var id int64
+	err = tx.QueryRow(`SELECT id, telegram_user_id FROM github_users WHERE user_name = ?;`, user.UserName).Scan(&id, &previous)
+	switch {
+	case err == s.ErrNoRows:
+		var res s.Result
+		res, err = tx.Exec(
+			"INSERT INTO github_users (name, user_name, token, telegram_user_id) VALUES (?, ?, ?, ?);",
+			user.Name,
+			user.UserName,
+			user.Token,
+			user.TelegramUserID)
+		if err == nil {
+			id, err = res.LastInsertId()
+			user.CreatedAt = time.Now()
+		}
+		previous = ""
+	case err == nil:
+		_, err = tx.Exec(
+			"UPDATE github_users SET name = ?, token = ?, telegram_user_id = ? WHERE id = ?;",
+			user.Name,
+			user.Token,
+			user.TelegramUserID,
+			id)
+		if err == nil && previous != user.TelegramUserID {
+			_, err = tx.Exec("UPDATE telegram_users SET github_user_id = 0 WHERE telegram_user_id = ? AND github_user_id = ?;", previous, id)
+		} else {
+			previous = ""
+		}
+	}
+	if err != nil {
+		_ = tx.Rollback()
+		return "", err
+	}
+
+	user.ID = id
+
+	return previous, tx.Commit()
+}
+
+// GetGithubUserByID ...
+func GetGithubUserByID(db *sql.DB, id int64) (*GithubUser, error) {
+	var returnModel GithubUser
+
+	result, err := QuerySQLObject(db, returnModel, `SELECT * FROM github_users WHERE id = ?;`, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if returnModel, ok := result.Interface().(*GithubUser); ok && returnModel.UserName != "" {
+		return returnModel, nil
+	}
+
+	return nil, fmt.Errorf(UserNotFound)
+}
+
+// GetGithubAccounts returns github accounts linked to a telegram user
+func GetGithubAccounts(db *sql.DB, telegramUserID string) (users []*GithubUser, err error) {
+	var returnModel GithubUser
+
+	result, err := QuerySQLList(db, returnModel, `SELECT * FROM github_users WHERE telegram_user_id = ? ORDER BY id;`, telegramUserID)
+	if err != nil {
+		return users, err
+	}
+	for _, item := range result {
+		if returnModel, ok := item.Interface().(*GithubUser); ok {
+			users = append(users, returnModel)
+		}
+	}
+
+	return users, err
+}
+
+// SetDefaultAccount chooses github account used by commands of a telegram user
+func SetDefaultAccount(db *sql.DB, telegramUserID string, userID int64) error {
+	_, err := db.Exec(
+		`INSERT INTO telegram_users (telegram_user_id, github_user_id) VALUES (?, ?)
+		ON CONFLICT (telegram_user_id) DO UPDATE SET github_user_id = excluded.github_user_id;`,
+		telegramUserID,
+		userID)
+
+	return err
+}
+
+// MoveSubscriptions makes subscriptions to a repo, private ones or of a chat
+// if chatID is set, use token of another account of the same telegram user
+func MoveSubscriptions(db *sql.DB, userID, chatID, repoID, toUserID int64) (int64, error) {
+	res, err := db.Exec(
+		"UPDATE OR IGNORE users_repos SET user_id = ? WHERE "+accountsOf("user_id")+" AND chat_id = ? AND repo_id = ?;",
+		toUserID,
+		userID,
+		chatID,
+		repoID)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+// DeleteGithubUser removes a github account with its subscriptions,
+// filters, alerts and owner watches
+func DeleteGithubUser(db *sql.DB, userID int64) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if err := deleteGithubUser(tx, userID); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func deleteGithubUser(tx *sql.Tx, userID int64) error {
+	for _, query := range []string{
+		"DELETE FROM pending_notifications WHERE users_repos_id IN (SELECT id FROM users_repos WHERE user_id = ?);",
+		"DELETE FROM users_repos WHERE user_id = ?;",
+		"DELETE FROM filters WHERE user_id = ?;",
+		"DELETE FROM sent_alerts WHERE alert_id IN (SELECT id FROM alerts WHERE user_id = ?);",
+		"DELETE FROM alerts WHERE user_id = ?;",
+		"DELETE FROM owner_watches WHERE user_id = ?;",
+		"DELETE FROM removed_repos WHERE user_id = ?;",
+		"UPDATE telegram_users SET github_user_id = 0 WHERE github_user_id = ?;",
+		"DELETE FROM github_users WHERE id = ?;",
+	} {
+		if _, err := tx.Exec(query, userID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
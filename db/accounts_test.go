@@ -0,0 +1,122 @@
+package db
+
+import "testing"
+
+func TestUpsertGithubUser(t *testing.T) {
+	db := openTestDB(t)
+
+	work := &GithubUser{Name: "Octo Work", UserName: "octowork", Token: "token-1", TelegramUserID: "42"}
+	if previous, err := UpsertGithubUser(db, work); err != nil || previous != "" {
+		t.Fatalf("UpsertGithubUser(new) = %q, %v", previous, err)
+	}
+	home := &GithubUser{Name: "Octo Cat", UserName: "octocat", Token: "token-2", TelegramUserID: "42"}
+	if previous, err := UpsertGithubUser(db, home); err != nil || previous != "" {
+		t.Fatalf("UpsertGithubUser(second account) = %q, %v", previous, err)
+	}
+	if work.ID == 0 || home.ID == work.ID {
+		t.Fatalf("accounts got ids %d and %d", work.ID, home.ID)
+	}
+
+	// signing in again refreshes the token and keeps the id
+	again := &GithubUser{Name: "Octo Work", UserName: "octowork", Token: "token-3", TelegramUserID: "42"}
+	if previous, err := UpsertGithubUser(db, again); err != nil || previous != "" || again.ID != work.ID {
+		t.Fatalf("UpsertGithubUser(same user) = %q, %v with id %d, want id %d", previous, err, again.ID, work.ID)
+	}
+
+	accounts, err := GetGithubAccounts(db, "42")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(accounts) != 2 || accounts[0].Token != "token-3" || accounts[1].UserName != "octocat" {
+		t.Fatalf("got accounts %+v, want octowork with the new token and octocat", accounts)
+	}
+
+	// the account moves to another telegram user and stops being default
+	if err := SetDefaultAccount(db, "42", work.ID); err != nil {
+		t.Fatal(err)
+	}
+	moved := &GithubUser{Name: "Octo Work", UserName: "octowork", Token: "token-4", TelegramUserID: "7"}
+	if previous, err := UpsertGithubUser(db, moved); err != nil || previous != "42" {
+		t.Fatalf("UpsertGithubUser(other telegram user) = %q, %v, want previous 42", previous, err)
+	}
+
+	user, err := GetGithubUserFromDB(db, "42")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != home.ID {
+		t.Errorf("default account of 42 is %s, want octocat after octowork moved", user.UserName)
+	}
+}
+
+func TestDefaultAccount(t *testing.T) {
+	db := openTestDB(t)
+	seedAccount(t, db, 1, "42")
+	seedAccount(t, db, 2, "42")
+
+	tests := []struct {
+		set  int64
+		want int64
+	}{
+		// the first linked account until one is chosen
+		{0, 1},
+		{2, 2},
+		{1, 1},
+		// an account that is gone falls back to the first one
+		{9, 1},
+	}
+
+	for _, tt := range tests {
+		if tt.set != 0 {
+			if err := SetDefaultAccount(db, "42", tt.set); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		user, err := GetGithubUserFromDB(db, "42")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.ID != tt.want {
+			t.Errorf("default account after choosing %d is %d, want %d", tt.set, user.ID, tt.want)
+		}
+	}
+}
+
+func TestDeleteGithubUser(t *testing.T) {
+	db := openTestDB(t)
+	seedAccount(t, db, 1, "42")
+	seedAccount(t, db, 2, "42")
+	seedTelegramUser(t, db, "42", 2)
+
+	if err := DeleteGithubUser(db, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	for table, n := range countRows(t, db, []int64{2}, "0") {
+		if n != 0 {
+			t.Errorf("%d rows of the unlinked account left in %s", n, table)
+		}
+	}
+	for table, n := range countRows(t, db, []int64{1}, "42") {
+		if n != 1 {
+			t.Errorf("%d rows of the other account in %s, want 1", n, table)
+		}
+	}
+
+	var defaultAccount int64
+	if err := db.QueryRow(`SELECT github_user_id FROM telegram_users WHERE telegram_user_id = "42"`).Scan(&defaultAccount); err != nil {
+		t.Fatal(err)
+	}
+	if defaultAccount != 0 {
+		t.Errorf("default account is %d, want it reset after unlinking", defaultAccount)
+	}
+
+	user, err := GetGithubUserFromDB(db, "42")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != 1 {
+		t.Errorf("default account is %d, want the remaining one", user.ID)
+	}
+}
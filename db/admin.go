@@ -0,0 +1,109 @@
+package db
+
+import (
+	"context"
+
+	sql "github.com/lazada/sqle"
+)
+
+// Stats counts what the bot stores
+type Stats struct {
+	GithubUsers       int64
+	TelegramUsers     int64
+	Repos             int64
+	Subscriptions     int64
+	ChatSubscriptions int64
+	Chats             int64
+	Pending           int64
+	Messages          int64
+	Banned            int64
+}
+
+// GetStats ...
+func GetStats(db *sql.DB) (*Stats, error) {
+	var stats Stats
+
+	err := db.QueryRow(`SELECT
+	(SELECT COUNT(*) FROM github_users),
+	(SELECT COUNT(DISTINCT telegram_user_id) FROM github_users),
+	(SELECT COUNT(*) FROM github_repos),
+	(SELECT COUNT(*) FROM users_repos),
+	(SELECT COUNT(*) FROM users_repos WHERE chat_id != 0),
+	(SELECT COUNT(*) FROM chats),
+	(SELECT COUNT(*) FROM pending_notifications),
+	(SELECT COUNT(*) FROM telegram_messages),
+	(SELECT COUNT(*) FROM banned_users);`).Scan(
+		&stats.GithubUsers,
+		&stats.TelegramUsers,
+		&stats.Repos,
+		&stats.Subscriptions,
+		&stats.ChatSubscriptions,
+		&stats.Chats,
+		&stats.Pending,
+		&stats.Messages,
+		&stats.Banned)
+	if err != nil {
+		return nil, err
+	}
+
+	return &stats, nil
+}
+
+// CountUserSubscriptions returns number of subscriptions per github user id
+func CountUserSubscriptions(db *sql.DB) (map[int64]int64, error) {
+	rows, err := db.Query(`SELECT user_id, COUNT(*) FROM users_repos GROUP BY user_id;`)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	counts := make(map[int64]int64)
+	for rows.Next() {
+		var userID, count int64
+		if err := rows.Scan(&userID, &count); err != nil {
+			return nil, err
+		}
+		counts[userID] = count
+	}
+
+	return counts, rows.Err()
+}
+
+// BanTelegramUser makes the bot ignore a telegram user
+func BanTelegramUser(db *sql.DB, telegramUserID string) error {
+	_, err := db.Exec("INSERT OR IGNORE INTO banned_users (telegram_user_id) VALUES (?);", telegramUserID)
+
+	return err
+}
+
+// UnbanTelegramUser ...
+func UnbanTelegramUser(db *sql.DB, telegramUserID string) (int64, error) {
+	res, err := db.Exec("DELETE FROM banned_users WHERE telegram_user_id = ?;", telegramUserID)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+// IsBanned ...
+func IsBanned(db *sql.DB, telegramUserID string) (bool, error) {
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM banned_users WHERE telegram_user_id = ?;", telegramUserID).Scan(&count); err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// Ping checks the database answers and its schema is readable, a locked
+// database fails once ctx is done
+func Ping(ctx context.Context, db *sql.DB) error {
+	if err := db.PingContext(ctx); err != nil {
+		return err
+	}
+
+	var count int
+
+	return db.QueryRowContext(ctx, "SELECT COUNT(*) FROM sqlite_master;").Scan(&count)
+}
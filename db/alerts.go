@@ -0,0 +1,166 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	sql "github.com/lazada/sqle"
+)
+
+// Alert is a keyword a user wants to be alerted about
+type Alert struct {
+	ID        int64     `sql:"id"`
+	UserID    int64     `sql:"user_id"`
+	Pattern   string    `sql:"pattern"`
+	CreatedAt time.Time `sql:"created_at"`
+}
+
+// RepoAlert is an alert applied to one of the repos its owner watches
+// with any linked account, Token is of the account watching the repo
+type RepoAlert struct {
+	ID             int64     `sql:"id"`
+	UserID         int64     `sql:"user_id"`
+	Pattern        string    `sql:"pattern"`
+	CreatedAt      time.Time `sql:"created_at"`
+	UserName       string    `sql:"user_name"`
+	TelegramUserID string    `sql:"telegram_user_id"`
+	Token          string    `sql:"token"`
+	RepoID         int64     `sql:"repo_id"`
+	RepoName       string    `sql:"repo_name"`
+	CheckedAt      time.Time `sql:"alerts_checked_at"`
+	Format         string    `sql:"format"`
+	Timezone       string    `sql:"timezone"`
+}
+
+// AddAlert ...
+func AddAlert(db *sql.DB, userID int64, pattern string) error {
+	_, err := db.Exec(
+		"INSERT INTO alerts (user_id, pattern, created_at) VALUES (?, ?, ?);",
+		userID,
+		pattern,
+		time.Now().UTC())
+
+	return err
+}
+
+// GetUserAlerts ...
+func GetUserAlerts(db *sql.DB, userID int64) (alerts []*Alert, err error) {
+	var returnModel Alert
+
+	result, err := QuerySQLList(db, returnModel, `select * FROM alerts WHERE user_id = ? ORDER BY id;`, userID)
+	if err != nil {
+		return alerts, err
+	}
+	for _, item := range result {
+		if returnModel, ok := item.Interface().(*Alert); ok {
+			alerts = append(alerts, returnModel)
+		}
+	}
+
+	return alerts, err
+}
+
+// DeleteAlert removes alert by pattern, every alert of the user if pattern is empty
+func DeleteAlert(db *sql.DB, userID int64, pattern string) (int64, error) {
+	sql := "DELETE FROM alerts WHERE user_id = ?"
+	args := []interface{}{userID}
+
+	if pattern != "" {
+		sql += " AND pattern = ?"
+		args = append(args, pattern)
+	}
+
+	res, err := db.Exec(sql+";", args...)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+const repoAlertsSelect = `select
+	alerts.id as id,
+	alerts.user_id as user_id,
+	alerts.pattern as pattern,
+	alerts.created_at as created_at,
+	github_users.user_name as user_name,
+	github_users.telegram_user_id as telegram_user_id,
+	watcher.token as token,
+	github_repos.id as repo_id,
+	github_repos.repo_name as repo_name,
+	github_repos.alerts_checked_at as alerts_checked_at,
+	COALESCE(telegram_users.format, "") as format,
+	COALESCE(telegram_users.timezone, "") as timezone
+FROM
+	alerts
+	INNER JOIN github_users ON github_users.id = alerts.user_id
+	INNER JOIN (
+		SELECT github_users.telegram_user_id AS telegram_user_id, users_repos.repo_id AS repo_id, MIN(users_repos.user_id) AS user_id
+		FROM users_repos INNER JOIN github_users ON github_users.id = users_repos.user_id
+		GROUP BY github_users.telegram_user_id, users_repos.repo_id
+	) AS watched ON watched.telegram_user_id = github_users.telegram_user_id
+	INNER JOIN github_users AS watcher ON watcher.id = watched.user_id
+	INNER JOIN github_repos ON github_repos.id = watched.repo_id
+	LEFT JOIN telegram_users ON telegram_users.telegram_user_id = github_users.telegram_user_id`
+
+func queryRepoAlerts(ctx context.Context, db *sql.DB, sql string, args ...interface{}) (alerts []*RepoAlert, err error) {
+	var returnModel RepoAlert
+
+	result, err := QuerySQLListContext(ctx, db, returnModel, sql, args...)
+	if err != nil {
+		return alerts, err
+	}
+	for _, item := range result {
+		if returnModel, ok := item.Interface().(*RepoAlert); ok {
+			alerts = append(alerts, returnModel)
+		}
+	}
+
+	return alerts, err
+}
+
+// GetRepoAlerts returns alerts of users watching a repo
+func GetRepoAlerts(ctx context.Context, db *sql.DB, repoID int64) ([]*RepoAlert, error) {
+	return queryRepoAlerts(ctx, db, repoAlertsSelect+`
+WHERE
+	github_repos.id = ?
+ORDER BY
+	alerts.id;`, repoID)
+}
+
+// GetStaleRepoAlerts returns alerts of repos whose pull requests and
+// releases were last checked before the given time
+func GetStaleRepoAlerts(ctx context.Context, db *sql.DB, before time.Time) ([]*RepoAlert, error) {
+	return queryRepoAlerts(ctx, db, repoAlertsSelect+`
+WHERE
+	DATETIME(github_repos.alerts_checked_at) < DATETIME(?)
+ORDER BY
+	github_repos.id, alerts.id;`, before.UTC())
+}
+
+// SetAlertsCheckedAt ...
+func SetAlertsCheckedAt(ctx context.Context, db *sql.DB, repoID int64, checkedAt time.Time) error {
+	_, err := execContext(ctx, db, "UPDATE github_repos SET alerts_checked_at = ? WHERE id = ?;", checkedAt.UTC(), repoID)
+
+	return err
+}
+
+// MarkAlertSent records delivery of an alert about an event, false means
+// it was already delivered
+func MarkAlertSent(ctx context.Context, db *sql.DB, alertID int64, event string) (bool, error) {
+	res, err := execContext(ctx, db, "INSERT INTO sent_alerts (alert_id, event, created_at) VALUES (?, ?, ?);", alertID, event, time.Now().UTC())
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+
+	return n > 0, err
+}
+
+// DeleteSentAlerts forgets deliveries older than the given time
+func DeleteSentAlerts(ctx context.Context, db *sql.DB, before time.Time) error {
+	_, err := execContext(ctx, db, "DELETE FROM sent_alerts WHERE DATETIME(created_at) < DATETIME(?);", before.UTC())
+
+	return err
+}
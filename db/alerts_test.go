@@ -0,0 +1,40 @@
+package db
+
+import (
+	"context"
+	"testing"
+)
+
+func TestGetRepoAlertsOfOtherAccounts(t *testing.T) {
+	db := openTestDB(t)
+
+	mustExec(t, db, `INSERT INTO github_users (id, name, user_name, token, telegram_user_id) VALUES
+		(1, "Octo Cat", "octocat", "token-1", 42),
+		(2, "Octo Work", "octowork", "token-2", 42),
+		(3, "Hubot", "hubot", "token-3", 7)`)
+	mustExec(t, db, `INSERT INTO github_repos (id, name, repo_name) VALUES (1, "work", "acme/work")`)
+	// the repo is linked through the second account of the same user only
+	mustExec(t, db, `INSERT INTO users_repos (user_id, repo_id) VALUES (2, 1)`)
+	if err := AddAlert(db, 1, "deploy"); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddAlert(db, 3, "release"); err != nil {
+		t.Fatal(err)
+	}
+
+	alerts, err := GetRepoAlerts(context.Background(), db, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(alerts) != 1 {
+		t.Fatalf("got %d alerts, want 1", len(alerts))
+	}
+
+	alert := alerts[0]
+	if alert.Pattern != "deploy" || alert.UserID != 1 || alert.TelegramUserID != "42" {
+		t.Errorf("alert %+v, want deploy of user 1", alert)
+	}
+	if alert.Token != "token-2" {
+		t.Errorf("token %q, want token-2 of the account watching the repo", alert.Token)
+	}
+}
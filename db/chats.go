@@ -0,0 +1,136 @@
+package db
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	logging "github.com/ad/go-githublistener/logging"
+
+	sql "github.com/lazada/sqle"
+)
+
+// ChatNotFound ...
+const ChatNotFound = "chat not found"
+
+// Chat is a telegram group or channel receiving notifications
+type Chat struct {
+	ID        int64     `sql:"id"`
+	ChatID    int64     `sql:"chat_id"`
+	Type      string    `sql:"type"`
+	Title     string    `sql:"title"`
+	CreatedAt time.Time `sql:"created_at"`
+}
+
+// AddChatIfNotExist stores chat or refreshes its title
+func AddChatIfNotExist(db *sql.DB, chat *Chat) (*Chat, error) {
+	var returnModel Chat
+
+	result, err := QuerySQLObject(db, returnModel, `SELECT * FROM chats WHERE chat_id = ?;`, chat.ChatID)
+	if err != nil {
+		return nil, err
+	}
+	if returnModel, ok := result.Interface().(*Chat); ok && returnModel.ChatID != 0 {
+		if returnModel.Title != chat.Title || returnModel.Type != chat.Type {
+			if _, err := db.Exec("UPDATE chats SET title = ?, type = ? WHERE id = ?;", chat.Title, chat.Type, returnModel.ID); err != nil {
+				return nil, err
+			}
+			returnModel.Title = chat.Title
+			returnModel.Type = chat.Type
+		}
+		return returnModel, nil
+	}
+
+	res, err := db.Exec(
+		"INSERT INTO chats (chat_id, type, title) VALUES (?, ?, ?);",
+		chat.ChatID,
+		chat.Type,
+		chat.Title,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	chat.ID, _ = res.LastInsertId()
+	chat.CreatedAt = time.Now()
+
+	slog.Debug("chat added", "title", chat.Title, logging.KeyChat, chat.ChatID)
+
+	return chat, nil
+}
+
+// GetChatFromDB ...
+func GetChatFromDB(db *sql.DB, chatID int64) (*Chat, error) {
+	var returnModel Chat
+
+	result, err := QuerySQLObject(db, returnModel, `SELECT * FROM chats WHERE chat_id = ?;`, chatID)
+	if err != nil {
+		return nil, err
+	}
+
+	if returnModel, ok := result.Interface().(*Chat); ok && returnModel.ChatID != 0 {
+		return returnModel, nil
+	}
+
+	return nil, fmt.Errorf(ChatNotFound)
+}
+
+// GetChatRepos returns repos linked to a group or channel
+func GetChatRepos(db *sql.DB, chatID int64) (repos []*GithubRepo, err error) {
+	var returnModel GithubRepo
+	sql := `SELECT DISTINCT
+	github_repos.*
+FROM
+	github_repos
+	INNER JOIN users_repos ON github_repos.id = users_repos.repo_id
+WHERE
+	users_repos.chat_id = ?
+ORDER BY
+	github_repos.repo_name;`
+
+	result, err := QuerySQLList(db, returnModel, sql, chatID)
+	if err != nil {
+		return repos, err
+	}
+	for _, item := range result {
+		if returnModel, ok := item.Interface().(*GithubRepo); ok {
+			repos = append(repos, returnModel)
+		}
+	}
+
+	return repos, err
+}
+
+// DeleteChatRepoLinkDB removes repo from a group or channel whoever linked it
+func DeleteChatRepoLinkDB(db *sql.DB, chatID int64, repo *GithubRepo) error {
+	_, err := db.Exec(
+		"DELETE FROM users_repos WHERE chat_id = ? AND repo_id = ?;",
+		chatID,
+		repo.ID)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// MigrateChat moves chat and its subscriptions to a new id after a group is upgraded to supergroup
+func MigrateChat(db *sql.DB, from, to int64) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("UPDATE chats SET chat_id = ?, type = ? WHERE chat_id = ?;", to, "supergroup", from); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	if _, err := tx.Exec("UPDATE users_repos SET chat_id = ? WHERE chat_id = ?;", to, from); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
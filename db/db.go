@@ -1,12 +1,18 @@
 package db
 
 import (
+	"context"
 	s "database/sql"
 	"fmt"
+	"log/slog"
 	"reflect"
+	"strings"
 	"time"
 
-	dlog "github.com/amoghe/distillog"
+	logging "github.com/ad/go-githublistener/logging"
+	metrics "github.com/ad/go-githublistener/metrics"
+	tracing "github.com/ad/go-githublistener/tracing"
+
 	sql "github.com/lazada/sqle"
 	_ "github.com/mattn/go-sqlite3" // ...
 )
@@ -34,9 +40,23 @@ type GithubUser struct {
 	UserName       string    `sql:"user_name"`
 	TelegramUserID string    `sql:"telegram_user_id"`
 	Token          string    `sql:"token"`
+	Sources        string    `sql:"sources"`
 	CreatedAt      time.Time `sql:"created_at"`
 }
 
+// SourceList returns repo sync sources the user chose, none means the user
+// only adds repos manually
+func (u *GithubUser) SourceList() []string {
+	var sources []string
+	for _, source := range strings.Split(u.Sources, ",") {
+		if source = strings.TrimSpace(source); source != "" {
+			sources = append(sources, source)
+		}
+	}
+
+	return sources
+}
+
 // GithubRepo ...
 type GithubRepo struct {
 	ID        int64     `sql:"id"`
@@ -47,26 +67,59 @@ type GithubRepo struct {
 
 // UserRepo ...
 type UserRepo struct {
-	ID        int64     `sql:"id"`
-	UserID    int64     `sql:"user_id"`
-	RepoID    int64     `sql:"repo_id"`
-	CreatedAt time.Time `sql:"created_at"`
-	UpdatedAt time.Time `sql:"updated_at"`
+	ID         int64     `sql:"id"`
+	UserID     int64     `sql:"user_id"`
+	RepoID     int64     `sql:"repo_id"`
+	ChatID     int64     `sql:"chat_id"`
+	CreatedAt  time.Time `sql:"created_at"`
+	UpdatedAt  time.Time `sql:"updated_at"`
+	MutedUntil time.Time `sql:"muted_until"`
+	Source     string    `sql:"source"`
 }
 
+// Forever is the mute deadline of subscriptions muted until /resume
+var Forever = time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC)
+
 // UsersReposResult ...
 type UsersReposResult struct {
+	ID             int64
 	UserID         int64
 	RepoID         int64
+	ChatID         int64
 	TelegramUserID string
 	Token          string
 	RepoName       string
 	UpdatedAt      time.Time
+	MutedUntil     time.Time
+	MuteSummary    bool
+	Source         string
+	Format         string
+	Delivery       string
+	DigestTime     string
+	Timezone       string
+	QuietStart     string
+	QuietEnd       string
+}
+
+// Settings returns settings of the subscriber
+func (r *UsersReposResult) Settings() *TelegramUser {
+	return &TelegramUser{
+		TelegramUserID: r.TelegramUserID,
+		Format:         r.Format,
+		Timezone:       r.Timezone,
+		QuietStart:     r.QuietStart,
+		QuietEnd:       r.QuietEnd,
+	}
 }
 
 // InitDB ...
 func InitDB() (*sql.DB, error) {
-	db, err := sql.Open("sqlite3", "db/githublistener.db")
+	return Open("db/githublistener.db")
+}
+
+// Open opens the database at path creating tables and running migrations
+func Open(path string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite3", path)
 	if err != nil {
 		return nil, err
 	}
@@ -84,7 +137,7 @@ func InitDB() (*sql.DB, error) {
 		"created_at" timestamp DEFAULT CURRENT_TIMESTAMP
 	);`)
 	if err != nil {
-		dlog.Errorf("%s", err)
+		slog.Error("failed to create table", logging.Err(err))
 	}
 
 	err = ExecSQL(db, `CREATE TABLE IF NOT EXISTS "github_users" (
@@ -97,7 +150,7 @@ func InitDB() (*sql.DB, error) {
 		CONSTRAINT "github_users_user_name" UNIQUE ("user_name") ON CONFLICT IGNORE
 	  );`)
 	if err != nil {
-		dlog.Errorf("%s", err)
+		slog.Error("failed to create table", logging.Err(err))
 	}
 
 	err = ExecSQL(db, `CREATE TABLE IF NOT EXISTS "github_repos" (
@@ -108,7 +161,7 @@ func InitDB() (*sql.DB, error) {
 		CONSTRAINT "github_repos_repo_name" UNIQUE ("repo_name") ON CONFLICT IGNORE
 	  );`)
 	if err != nil {
-		dlog.Errorf("%s", err)
+		slog.Error("failed to create table", logging.Err(err))
 	}
 
 	err = ExecSQL(db, `CREATE TABLE IF NOT EXISTS "users_repos" (
@@ -122,7 +175,11 @@ func InitDB() (*sql.DB, error) {
 		CONSTRAINT "repos_repo_id_user_id" UNIQUE ("user_id", "repo_id") ON CONFLICT IGNORE
 	  );`)
 	if err != nil {
-		dlog.Errorf("%s", err)
+		slog.Error("failed to create table", logging.Err(err))
+	}
+
+	if err := Migrate(db); err != nil {
+		return nil, err
 	}
 
 	return db, nil
@@ -140,14 +197,24 @@ func ExecSQL(db *sql.DB, sql string) error {
 
 // QuerySQLObject ...
 func QuerySQLObject(db *sql.DB, returnModel interface{}, sql string, args ...interface{}) (reflect.Value, error) {
+	return QuerySQLObjectContext(context.Background(), db, returnModel, sql, args...)
+}
+
+// QuerySQLObjectContext is QuerySQLObject traced within the trace of ctx
+func QuerySQLObjectContext(ctx context.Context, db *sql.DB, returnModel interface{}, sql string, args ...interface{}) (reflect.Value, error) {
 	t := reflect.TypeOf(returnModel)
 	u := reflect.New(t)
 
-	err := db.QueryRow(sql, args...).Scan(u.Interface())
+	defer metrics.DBQueryDuration.Since(time.Now(), "object "+t.Name())
+	ctx, span := startQuery(ctx, "object "+t.Name(), sql)
+	defer span.End()
+
+	err := db.QueryRowContext(ctx, sql, args...).Scan(u.Interface())
 	switch {
 	case err == s.ErrNoRows:
 		return u, nil
 	case err != nil:
+		span.SetError(err)
 		return u, fmt.Errorf("%s: %s", err.Error(), sql)
 	}
 
@@ -156,18 +223,29 @@ func QuerySQLObject(db *sql.DB, returnModel interface{}, sql string, args ...int
 
 // QuerySQLList ...
 func QuerySQLList(db *sql.DB, returnModel interface{}, sql string, args ...interface{}) ([]reflect.Value, error) {
+	return QuerySQLListContext(context.Background(), db, returnModel, sql, args...)
+}
+
+// QuerySQLListContext is QuerySQLList traced within the trace of ctx
+func QuerySQLListContext(ctx context.Context, db *sql.DB, returnModel interface{}, sql string, args ...interface{}) ([]reflect.Value, error) {
 	var result []reflect.Value
 
-	rows, err := db.Query(sql, args...)
+	t := reflect.TypeOf(returnModel)
+
+	defer metrics.DBQueryDuration.Since(time.Now(), "list "+t.Name())
+	ctx, span := startQuery(ctx, "list "+t.Name(), sql)
+	defer span.End()
+
+	rows, err := db.QueryContext(ctx, sql, args...)
 	if err != nil {
+		span.SetError(err)
 		return nil, fmt.Errorf("%s: %s", err.Error(), sql)
 	}
 
-	t := reflect.TypeOf(returnModel)
-
 	for rows.Next() {
 		u := reflect.New(t)
 		if err = rows.Scan(u.Interface()); err != nil {
+			span.SetError(err)
 			return nil, fmt.Errorf("%s: %s", err.Error(), sql)
 		}
 		result = append(result, u)
@@ -176,52 +254,39 @@ func QuerySQLList(db *sql.DB, returnModel interface{}, sql string, args ...inter
 	return result, nil
 }
 
-// AddUserIfNotExist ...
-func AddUserIfNotExist(db *sql.DB, user *GithubUser) (*GithubUser, error) {
-	var returnModel GithubUser
+// execContext runs a statement traced within the trace of ctx
+func execContext(ctx context.Context, db *sql.DB, query string, args ...interface{}) (s.Result, error) {
+	defer metrics.DBQueryDuration.Since(time.Now(), "exec")
+	ctx, span := startQuery(ctx, "exec", query)
+	defer span.End()
 
-	result, err := QuerySQLObject(db, returnModel, `SELECT * FROM github_users WHERE user_name = ?;`, user.UserName)
-	if err != nil {
-		return nil, err
-	}
-	if returnModel, ok := result.Interface().(*GithubUser); ok && returnModel.UserName != "" {
-		// dlog.Debugf("already exists: %#v", returnModel)
-		return returnModel, fmt.Errorf(AlreadyExists)
-	}
-
-	res, err := db.Exec(
-		"INSERT INTO github_users (name, user_name, token, telegram_user_id) VALUES (?, ?, ?, ?);",
-		user.Name,
-		user.UserName,
-		user.Token,
-		user.TelegramUserID,
-	)
-
-	if err != nil {
-		return nil, err
-	}
+	res, err := db.ExecContext(ctx, query, args...)
+	span.SetError(err)
 
-	user.ID, _ = res.LastInsertId()
-	user.CreatedAt = time.Now()
-
-	dlog.Debugf("%s (%d) added at %s\n", user.UserName, user.ID, user.CreatedAt)
+	return res, err
+}
 
-	return user, nil
+// startQuery starts a span of a query only inside a trace, queries of
+// commands and jobs that are not traced are not recorded
+func startQuery(ctx context.Context, op, query string) (context.Context, *tracing.Span) {
+	return tracing.StartChild(ctx, tracing.KindClient, "db "+op,
+		tracing.String("db.system", "sqlite"),
+		tracing.String("db.statement", query),
+	)
 }
 
 // AddRepoIfNotExist ...
-func AddRepoIfNotExist(db *sql.DB, repo *GithubRepo) (*GithubRepo, error) {
+func AddRepoIfNotExist(ctx context.Context, db *sql.DB, repo *GithubRepo) (*GithubRepo, error) {
 	var returnModel GithubRepo
 
-	result, err := QuerySQLObject(db, returnModel, `SELECT * FROM github_repos WHERE repo_name = ?;`, repo.RepoName)
+	result, err := QuerySQLObjectContext(ctx, db, returnModel, `SELECT * FROM github_repos WHERE repo_name = ?;`, repo.RepoName)
 	if err != nil {
 		return nil, err
 	}
 	if returnModel, ok := result.Interface().(*GithubRepo); ok && returnModel.RepoName != "" {
-		// dlog.Debugf("already exists: %#v", returnModel)
 		return returnModel, fmt.Errorf(AlreadyExists)
 	}
-	res, err := db.Exec(
+	res, err := execContext(ctx, db,
 		"INSERT INTO github_repos (name, repo_name) VALUES (?, ?);",
 		repo.Name,
 		repo.RepoName,
@@ -234,38 +299,94 @@ func AddRepoIfNotExist(db *sql.DB, repo *GithubRepo) (*GithubRepo, error) {
 	repo.ID, _ = res.LastInsertId()
 	repo.CreatedAt = time.Now()
 
-	dlog.Debugf("%s (%d) added at %s\n", repo.RepoName, repo.ID, repo.CreatedAt)
+	slog.Debug("repo added", logging.KeyRepo, repo.RepoName, "id", repo.ID)
 
 	return repo, nil
 }
 
-// AddRepoLinkIfNotExist ...
+// Subscription sources, links created by watching an owner use
+// SourceOwner followed by the owner login
+const (
+	SourceManual  = "manual"
+	SourceWatched = "watched"
+	SourceStarred = "starred"
+	SourceOwned   = "owned"
+	SourceOrgs    = "orgs"
+	SourceOwner   = "owner:"
+)
+
+// UserSources are sources repo sync reads for a github user
+var UserSources = []string{SourceWatched, SourceStarred, SourceOwned, SourceOrgs}
+
+// IsUserSource ...
+func IsUserSource(source string) bool {
+	for _, s := range UserSources {
+		if s == source {
+			return true
+		}
+	}
+
+	return false
+}
+
+// SetUserSources stores comma separated repo sync sources of a user
+func SetUserSources(db *sql.DB, userID int64, sources []string) error {
+	_, err := db.Exec("UPDATE github_users SET sources = ? WHERE id = ?;", strings.Join(sources, ","), userID)
+
+	return err
+}
+
+// AddRepoLinkIfNotExist links a repo the user watches on github
 func AddRepoLinkIfNotExist(db *sql.DB, user *GithubUser, repo *GithubRepo, updatedAt time.Time) error {
+	return AddRepoLinkFrom(context.Background(), db, user, repo, 0, updatedAt, SourceWatched)
+}
+
+// AddChatRepoLinkIfNotExist links repo to a group or channel, chatID 0 means private chat of the user
+func AddChatRepoLinkIfNotExist(db *sql.DB, user *GithubUser, repo *GithubRepo, chatID int64, updatedAt time.Time) error {
+	return AddRepoLinkFrom(context.Background(), db, user, repo, chatID, updatedAt, SourceManual)
+}
+
+// AddRepoLinkFrom links repo remembering the source that created the link
+func AddRepoLinkFrom(ctx context.Context, db *sql.DB, user *GithubUser, repo *GithubRepo, chatID int64, updatedAt time.Time, source string) error {
 	var returnModel UserRepo
 
-	result, err := QuerySQLObject(db, returnModel, `SELECT * FROM users_repos WHERE user_id = ? AND repo_id = ?;`, user.ID, repo.ID)
+	// a repo is linked to the private chat once whatever account watches
+	// it and to a group once whoever added it
+	query := `SELECT * FROM users_repos WHERE ` + accountsOf("user_id") + ` AND repo_id = ? AND chat_id = ?;`
+	args := []interface{}{user.ID, repo.ID, chatID}
+	if chatID != 0 {
+		query = `SELECT * FROM users_repos WHERE repo_id = ? AND chat_id = ?;`
+		args = args[1:]
+	}
+
+	result, err := QuerySQLObjectContext(ctx, db, returnModel, query, args...)
 	if err != nil {
 		return err
 	}
 	if returnModel, ok := result.Interface().(*UserRepo); ok && returnModel.UserID > 0 && returnModel.RepoID > 0 {
-		// dlog.Debugf("already exists: %#v", returnModel)
 		return fmt.Errorf(AlreadyExists)
 	}
 
-	res, err := db.Exec(
-		"INSERT INTO users_repos (user_id, repo_id, updated_at) VALUES (?, ?, ?);",
+	// the unique index of chat links ignores a concurrent insert
+	res, err := execContext(ctx, db,
+		"INSERT OR IGNORE INTO users_repos (user_id, repo_id, chat_id, updated_at, source) VALUES (?, ?, ?, ?, ?);",
 		user.ID,
 		repo.ID,
+		chatID,
 		updatedAt,
+		source,
 	)
 
 	if err != nil {
 		return err
 	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf(AlreadyExists)
+	}
 
 	id, _ := res.LastInsertId()
 
-	dlog.Debugf("link %s <-> %s (%d) added at %s\n", user.Name, repo.RepoName, id, time.Now())
+	slog.Debug("subscription added", "user_name", user.UserName, logging.KeyRepo, repo.RepoName, logging.KeyChat, chatID, "id", id)
 
 	return nil
 }
@@ -286,13 +407,24 @@ func StoreTelegramMessage(db *sql.DB, message TelegramMessage) error {
 	return nil
 }
 
+// DeleteTelegramMessages removes logged messages sent before the given time
+func DeleteTelegramMessages(db *sql.DB, before time.Time) (int64, error) {
+	res, err := db.Exec("DELETE FROM telegram_messages WHERE created_at < ?;", before)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
 // UpdateUserRepoLink ...
-func UpdateUserRepoLink(db *sql.DB, userRepoResult *UsersReposResult) error {
-	_, err := db.Exec(
-		"UPDATE users_repos SET updated_at = ? WHERE user_id = ? AND repo_id = ?;",
+func UpdateUserRepoLink(ctx context.Context, db *sql.DB, userRepoResult *UsersReposResult) error {
+	_, err := execContext(ctx, db,
+		"UPDATE users_repos SET updated_at = ? WHERE user_id = ? AND repo_id = ? AND chat_id = ?;",
 		userRepoResult.UpdatedAt,
 		userRepoResult.UserID,
-		userRepoResult.RepoID)
+		userRepoResult.RepoID,
+		userRepoResult.ChatID)
 
 	if err != nil {
 		return err
@@ -301,24 +433,58 @@ func UpdateUserRepoLink(db *sql.DB, userRepoResult *UsersReposResult) error {
 	return nil
 }
 
-// GetUserRepos ...
-func GetUserRepos(db *sql.DB) (usersRepos []*UsersReposResult, err error) {
-	var returnModel UsersReposResult
-	sql := `select
+const usersReposSelect = `select
+	users_repos.id as id,
 	users_repos.user_id as user_id,
 	users_repos.repo_id as repo_id,
+	users_repos.chat_id as chat_id,
 	github_users.telegram_user_id as telegram_user_id,
 	github_users.token as token,
 	github_repos.repo_name as repo_name,
-	users_repos.updated_at as updated_at
+	users_repos.updated_at as updated_at,
+	users_repos.muted_until as muted_until,
+	users_repos.mute_summary as mute_summary,
+	users_repos.source as source,
+	users_repos.delivery as delivery,
+	users_repos.digest_time as digest_time,
+	COALESCE(telegram_users.format, "") as format,
+	COALESCE(telegram_users.timezone, "") as timezone,
+	COALESCE(telegram_users.quiet_start, "") as quiet_start,
+	COALESCE(telegram_users.quiet_end, "") as quiet_end
 FROM
 	github_repos
 	INNER JOIN users_repos ON github_repos.id = users_repos.repo_id
 	INNER JOIN github_users ON github_users.id = users_repos.user_id
+	LEFT JOIN telegram_users ON telegram_users.telegram_user_id = github_users.telegram_user_id`
+
+// GetUserRepos returns subscriptions last checked before the given time
+func GetUserRepos(ctx context.Context, db *sql.DB, before time.Time) (usersRepos []*UsersReposResult, err error) {
+	var returnModel UsersReposResult
+	sql := usersReposSelect + `
+WHERE
+	DATETIME(users_repos.updated_at) < DATETIME(?);`
+
+	result, err := QuerySQLListContext(ctx, db, returnModel, sql, before.UTC())
+	if err != nil {
+		return usersRepos, err
+	}
+	for _, item := range result {
+		if returnModel, ok := item.Interface().(*UsersReposResult); ok {
+			usersRepos = append(usersRepos, returnModel)
+		}
+	}
+
+	return usersRepos, err
+}
+
+// GetRepoSubscriptions returns every subscription to a repo
+func GetRepoSubscriptions(ctx context.Context, db *sql.DB, repoID int64) (usersRepos []*UsersReposResult, err error) {
+	var returnModel UsersReposResult
+	sql := usersReposSelect + `
 WHERE
-	users_repos.updated_at < DATETIME('now',  '-15 minutes');`
+	users_repos.repo_id = ?;`
 
-	result, err := QuerySQLList(db, returnModel, sql)
+	result, err := QuerySQLListContext(ctx, db, returnModel, sql, repoID)
 	if err != nil {
 		return usersRepos, err
 	}
@@ -332,14 +498,14 @@ WHERE
 }
 
 // GetUsers ...
-func GetUsers(db *sql.DB) (users []*GithubUser, err error) {
+func GetUsers(ctx context.Context, db *sql.DB) (users []*GithubUser, err error) {
 	var returnModel GithubUser
 	sql := `select
 	*
 FROM
 	github_users;`
 
-	result, err := QuerySQLList(db, returnModel, sql)
+	result, err := QuerySQLListContext(ctx, db, returnModel, sql)
 	if err != nil {
 		return users, err
 	}
@@ -352,11 +518,21 @@ FROM
 	return users, err
 }
 
-// GetGithubUserFromDB ...
+// GetGithubUserFromDB returns default github account of a telegram user,
+// the first linked one unless chosen with SetDefaultAccount
 func GetGithubUserFromDB(db *sql.DB, id string) (*GithubUser, error) {
 	var returnModel GithubUser
 
-	result, err := QuerySQLObject(db, returnModel, `SELECT * FROM github_users WHERE telegram_user_id = ?;`, id)
+	result, err := QuerySQLObject(db, returnModel, `SELECT
+	github_users.*
+FROM
+	github_users
+	LEFT JOIN telegram_users ON telegram_users.telegram_user_id = github_users.telegram_user_id
+WHERE
+	github_users.telegram_user_id = ?
+ORDER BY
+	github_users.id = telegram_users.github_user_id DESC, github_users.id
+LIMIT 1;`, id)
 	if err != nil {
 		return nil, err
 	}
@@ -384,10 +560,11 @@ func GetGithubRepoByNameFromDB(db *sql.DB, repo_name string) (*GithubRepo, error
 	return nil, fmt.Errorf(RepoNotFound)
 }
 
-// DeleteRepoUserLinkDB ...
+// DeleteRepoUserLinkDB removes repo from private subscriptions of the user
+// whichever of the user's accounts linked it
 func DeleteRepoUserLinkDB(db *sql.DB, user *GithubUser, repo *GithubRepo) error {
 	_, err := db.Exec(
-		"DELETE FROM users_repos WHERE user_id = ? AND repo_id = ?;",
+		"DELETE FROM users_repos WHERE "+accountsOf("user_id")+" AND repo_id = ? AND chat_id = 0;",
 		user.ID,
 		repo.ID)
 
@@ -397,3 +574,138 @@ func DeleteRepoUserLinkDB(db *sql.DB, user *GithubUser, repo *GithubRepo) error
 
 	return nil
 }
+
+// DeleteUserRepoLink removes a single subscription
+func DeleteUserRepoLink(ctx context.Context, db *sql.DB, userRepoResult *UsersReposResult) error {
+	_, err := execContext(ctx, db,
+		"DELETE FROM users_repos WHERE user_id = ? AND repo_id = ? AND chat_id = ?;",
+		userRepoResult.UserID,
+		userRepoResult.RepoID,
+		userRepoResult.ChatID)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetSyncedLinks returns private links of a user created by repo sync
+func GetSyncedLinks(ctx context.Context, db *sql.DB, userID int64) (usersRepos []*UsersReposResult, err error) {
+	var returnModel UsersReposResult
+	sql := usersReposSelect + `
+WHERE
+	users_repos.user_id = ? AND users_repos.chat_id = 0 AND users_repos.source IN (?, ?, ?, ?)
+ORDER BY
+	github_repos.repo_name;`
+
+	result, err := QuerySQLListContext(ctx, db, returnModel, sql, userID, SourceWatched, SourceStarred, SourceOwned, SourceOrgs)
+	if err != nil {
+		return usersRepos, err
+	}
+	for _, item := range result {
+		if returnModel, ok := item.Interface().(*UsersReposResult); ok {
+			usersRepos = append(usersRepos, returnModel)
+		}
+	}
+
+	return usersRepos, err
+}
+
+// SetLinkSource moves a link to another source, possibly of another github
+// account of the user, when the one that created it no longer lists the repo
+func SetLinkSource(ctx context.Context, db *sql.DB, id, userID int64, source string) error {
+	_, err := execContext(ctx, db, "UPDATE users_repos SET user_id = ?, source = ? WHERE id = ?;", userID, source, id)
+
+	return err
+}
+
+// GetUserRepoByID returns a single subscription
+func GetUserRepoByID(db *sql.DB, id int64) (*UsersReposResult, error) {
+	var returnModel UsersReposResult
+
+	result, err := QuerySQLObject(db, returnModel, usersReposSelect+`
+WHERE
+	users_repos.id = ?;`, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if returnModel, ok := result.Interface().(*UsersReposResult); ok && returnModel.ID != 0 {
+		return returnModel, nil
+	}
+
+	return nil, fmt.Errorf(RepoNotFound)
+}
+
+// MuteUserRepoLink stops notifications of a subscription until the given time
+func MuteUserRepoLink(db *sql.DB, id int64, until time.Time) error {
+	_, err := db.Exec(
+		"UPDATE users_repos SET muted_until = ?, mute_summary = 0 WHERE id = ?;",
+		until.UTC(),
+		id)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetUserSubscriptions returns private subscriptions of every github account
+// of the user
+func GetUserSubscriptions(db *sql.DB, userID int64) (usersRepos []*UsersReposResult, err error) {
+	var returnModel UsersReposResult
+	sql := usersReposSelect + `
+WHERE
+	` + accountsOf("users_repos.user_id") + ` AND users_repos.chat_id = 0
+ORDER BY
+	github_repos.repo_name;`
+
+	result, err := QuerySQLList(db, returnModel, sql, userID)
+	if err != nil {
+		return usersRepos, err
+	}
+	for _, item := range result {
+		if returnModel, ok := item.Interface().(*UsersReposResult); ok {
+			usersRepos = append(usersRepos, returnModel)
+		}
+	}
+
+	return usersRepos, err
+}
+
+// updateSubscriptions applies set to private subscriptions of the user, or
+// of a chat if chatID is set, repoID 0 means every repo
+func updateSubscriptions(db *sql.DB, userID, chatID, repoID int64, set string, args ...interface{}) (int64, error) {
+	sql := "UPDATE users_repos SET " + set + " WHERE chat_id = ?"
+	args = append(args, chatID)
+
+	if chatID == 0 {
+		sql += " AND " + accountsOf("user_id")
+		args = append(args, userID)
+	}
+
+	if repoID != 0 {
+		sql += " AND repo_id = ?"
+		args = append(args, repoID)
+	}
+
+	res, err := db.Exec(sql+";", args...)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+// SetDelivery changes delivery mode of subscriptions
+func SetDelivery(db *sql.DB, userID, chatID, repoID int64, delivery, digestTime string) (int64, error) {
+	return updateSubscriptions(db, userID, chatID, repoID, "delivery = ?, digest_time = ?", delivery, digestTime)
+}
+
+// MuteSubscriptions stops notifications of subscriptions until the given
+// time, with summary commits are kept and sent once the mute ends
+func MuteSubscriptions(db *sql.DB, userID, chatID, repoID int64, until time.Time, summary bool) (int64, error) {
+	return updateSubscriptions(db, userID, chatID, repoID, "muted_until = ?, mute_summary = ?", until.UTC(), summary)
+}
@@ -0,0 +1,134 @@
+package db
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	sql "github.com/lazada/sqle"
+)
+
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+// mustExec runs statements setting up a test
+func mustExec(t *testing.T, db *sql.DB, query string, args ...interface{}) {
+	t.Helper()
+
+	if _, err := db.Exec(query, args...); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// mutedLinks returns ids of links muted with a summary
+func mutedLinks(t *testing.T, db *sql.DB) []int64 {
+	t.Helper()
+
+	rows, err := db.Query(`SELECT id FROM users_repos WHERE mute_summary = 1 AND DATETIME(muted_until) > DATETIME('now') ORDER BY id;`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+
+	return ids
+}
+
+func TestMuteSubscriptions(t *testing.T) {
+	tests := []struct {
+		name   string
+		chatID int64
+		repoID int64
+		want   []int64
+	}{
+		// private links of every account of the user, not the group
+		{"pause", 0, 0, []int64{1, 2}},
+		{"mute repo", 0, 2, []int64{2}},
+		{"pause group", 100, 0, []int64{4}},
+	}
+
+	for _, tt := range tests {
+		db := openTestDB(t)
+		seedAccount(t, db, 1, "42")
+		seedAccount(t, db, 2, "42")
+		seedAccount(t, db, 3, "7")
+		mustExec(t, db, `INSERT INTO users_repos (id, user_id, repo_id, chat_id, updated_at) VALUES (4, 1, 1, 100, CURRENT_TIMESTAMP)`)
+
+		n, err := MuteSubscriptions(db, 1, tt.chatID, tt.repoID, Forever, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := mutedLinks(t, db); n != int64(len(tt.want)) || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: muted %d links %v, want %v", tt.name, n, got, tt.want)
+		}
+
+		if _, err := MuteSubscriptions(db, 1, tt.chatID, tt.repoID, time.Time{}, false); err != nil {
+			t.Fatal(err)
+		}
+		if got := mutedLinks(t, db); len(got) != 0 {
+			t.Errorf("%s: links %v still muted after resume", tt.name, got)
+		}
+	}
+}
+
+func TestAddRepoLinkFromChats(t *testing.T) {
+	db := openTestDB(t)
+	seedAccount(t, db, 1, "42")
+	seedAccount(t, db, 2, "42")
+	seedAccount(t, db, 3, "7")
+	mustExec(t, db, `DELETE FROM users_repos`)
+
+	repo := &GithubRepo{ID: 1, RepoName: "user1/repo"}
+	account := func(id int64) *GithubUser { return &GithubUser{ID: id} }
+
+	tests := []struct {
+		name    string
+		user    int64
+		chatID  int64
+		wantErr bool
+	}{
+		{"private", 1, 0, false},
+		{"private with another account", 2, 0, true},
+		{"private of another user", 3, 0, false},
+		{"group", 1, 100, false},
+		{"group by another user", 3, 100, true},
+		{"other group", 3, 200, false},
+	}
+
+	for _, tt := range tests {
+		err := AddRepoLinkFrom(context.Background(), db, account(tt.user), repo, tt.chatID, time.Now(), SourceManual)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: AddRepoLinkFrom = %v, want error %t", tt.name, err, tt.wantErr)
+		}
+		if err != nil && err.Error() != AlreadyExists {
+			t.Errorf("%s: AddRepoLinkFrom = %v, want %s", tt.name, err, AlreadyExists)
+		}
+	}
+
+	subscriptions, err := GetRepoSubscriptions(context.Background(), db, repo.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(subscriptions) != 4 {
+		t.Errorf("got %d subscriptions, want 4", len(subscriptions))
+	}
+}
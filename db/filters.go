@@ -0,0 +1,106 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	sql "github.com/lazada/sqle"
+)
+
+// Filter kinds
+const (
+	FilterAuthor  = "author"
+	FilterPath    = "path"
+	FilterMessage = "message"
+)
+
+// Filter actions
+const (
+	FilterInclude = "include"
+	FilterExclude = "exclude"
+)
+
+// Filter is a commit rule of private subscriptions of a user or of a chat
+type Filter struct {
+	ID        int64     `sql:"id"`
+	UserID    int64     `sql:"user_id"`
+	ChatID    int64     `sql:"chat_id"`
+	RepoID    int64     `sql:"repo_id"`
+	Kind      string    `sql:"kind"`
+	Action    string    `sql:"action"`
+	Pattern   string    `sql:"pattern"`
+	CreatedAt time.Time `sql:"created_at"`
+}
+
+// filterOwner returns user id stored with filters, chat filters are shared
+// by chat admins
+func filterOwner(userID, chatID int64) int64 {
+	if chatID != 0 {
+		return 0
+	}
+
+	return userID
+}
+
+// filterOwnerWhere matches filters of a chat, or private filters added from
+// any github account of the user
+func filterOwnerWhere(userID, chatID int64) (string, int64) {
+	if chatID != 0 {
+		return "user_id = ?", 0
+	}
+
+	return accountsOf("user_id"), userID
+}
+
+// AddFilter ...
+func AddFilter(db *sql.DB, filter *Filter) error {
+	_, err := db.Exec(
+		"INSERT INTO filters (user_id, chat_id, repo_id, kind, action, pattern) VALUES (?, ?, ?, ?, ?, ?);",
+		filterOwner(filter.UserID, filter.ChatID),
+		filter.ChatID,
+		filter.RepoID,
+		filter.Kind,
+		filter.Action,
+		filter.Pattern)
+
+	return err
+}
+
+// GetFilters returns filters of private subscription of the user to a repo,
+// or of a chat subscription if chatID is set
+func GetFilters(ctx context.Context, db *sql.DB, userID, chatID, repoID int64) (filters []*Filter, err error) {
+	var returnModel Filter
+	owner, ownerID := filterOwnerWhere(userID, chatID)
+	sql := `select * FROM filters WHERE ` + owner + ` AND chat_id = ? AND repo_id = ? ORDER BY id;`
+
+	result, err := QuerySQLListContext(ctx, db, returnModel, sql, ownerID, chatID, repoID)
+	if err != nil {
+		return filters, err
+	}
+	for _, item := range result {
+		if returnModel, ok := item.Interface().(*Filter); ok {
+			filters = append(filters, returnModel)
+		}
+	}
+
+	return filters, err
+}
+
+// DeleteFilters removes a filter by id, or every filter of the repo if id is 0
+func DeleteFilters(db *sql.DB, userID, chatID, repoID, id int64) (int64, error) {
+	owner, ownerID := filterOwnerWhere(userID, chatID)
+	sql := "DELETE FROM filters WHERE " + owner + " AND chat_id = ? AND repo_id = ?"
+	args := []interface{}{ownerID, chatID, repoID}
+
+	if id != 0 {
+		sql += " AND id = ?"
+		args = append(args, id)
+	}
+
+	res, err := db.Exec(sql+";", args...)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
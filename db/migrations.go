@@ -0,0 +1,174 @@
+package db
+
+import (
+	"fmt"
+	"log/slog"
+
+	sql "github.com/lazada/sqle"
+)
+
+// migrations are applied in order on top of the base schema created by
+// InitDB, PRAGMA user_version stores how many of them were applied
+var migrations = []string{
+	// 1: chats and per-chat subscriptions
+	`CREATE TABLE IF NOT EXISTS "chats" (
+		"id" INTEGER PRIMARY KEY AUTOINCREMENT,
+		"chat_id" INTEGER NOT NULL,
+		"type" text NOT NULL DEFAULT "",
+		"title" text NOT NULL DEFAULT "",
+		"created_at" timestamp DEFAULT CURRENT_TIMESTAMP,
+		CONSTRAINT "chats_chat_id" UNIQUE ("chat_id") ON CONFLICT IGNORE
+	);
+	CREATE TABLE "users_repos_new" (
+		"id" INTEGER PRIMARY KEY AUTOINCREMENT,
+		"user_id" INTEGER NOT NULL,
+		"repo_id" INTEGER NOT NULL,
+		"chat_id" INTEGER NOT NULL DEFAULT 0,
+		"created_at" timestamp DEFAULT CURRENT_TIMESTAMP,
+		"updated_at" timestamp,
+		CONSTRAINT "repos_user_id" FOREIGN KEY ("user_id") REFERENCES "github_users" ("id"),
+		CONSTRAINT "repos_repo_id" FOREIGN KEY ("repo_id") REFERENCES "github_repos" ("id"),
+		CONSTRAINT "repos_repo_id_user_id_chat_id" UNIQUE ("user_id", "repo_id", "chat_id") ON CONFLICT IGNORE
+	);
+	INSERT INTO users_repos_new (id, user_id, repo_id, created_at, updated_at)
+		SELECT id, user_id, repo_id, created_at, updated_at FROM users_repos;
+	DROP TABLE users_repos;
+	ALTER TABLE users_repos_new RENAME TO users_repos;`,
+	// 2: muted subscriptions
+	`ALTER TABLE users_repos ADD COLUMN "muted_until" timestamp NOT NULL DEFAULT "0001-01-01 00:00:00+00:00";`,
+	// 3: per telegram user settings
+	`CREATE TABLE IF NOT EXISTS "telegram_users" (
+		"telegram_user_id" text PRIMARY KEY NOT NULL,
+		"format" text NOT NULL DEFAULT "",
+		"created_at" timestamp DEFAULT CURRENT_TIMESTAMP
+	);`,
+	// 4: delivery modes and queued digest notifications
+	`ALTER TABLE users_repos ADD COLUMN "delivery" text NOT NULL DEFAULT "";
+	ALTER TABLE users_repos ADD COLUMN "digest_time" text NOT NULL DEFAULT "";
+	CREATE TABLE IF NOT EXISTS "pending_notifications" (
+		"id" INTEGER PRIMARY KEY AUTOINCREMENT,
+		"users_repos_id" INTEGER NOT NULL,
+		"sha" text NOT NULL DEFAULT "",
+		"author" text NOT NULL DEFAULT "",
+		"title" text NOT NULL DEFAULT "",
+		"url" text NOT NULL DEFAULT "",
+		"date" timestamp NOT NULL DEFAULT "0001-01-01 00:00:00+00:00",
+		"created_at" timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		CONSTRAINT "pending_users_repos_id" FOREIGN KEY ("users_repos_id") REFERENCES "users_repos" ("id")
+	);`,
+	// 5: time zones and quiet hours
+	`ALTER TABLE telegram_users ADD COLUMN "timezone" text NOT NULL DEFAULT "";
+	ALTER TABLE telegram_users ADD COLUMN "quiet_start" text NOT NULL DEFAULT "";
+	ALTER TABLE telegram_users ADD COLUMN "quiet_end" text NOT NULL DEFAULT "";`,
+	// 6: summaries of commits missed while muted
+	`ALTER TABLE users_repos ADD COLUMN "mute_summary" INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE pending_notifications ADD COLUMN "reason" text NOT NULL DEFAULT "";`,
+	// 7: commit filters
+	`CREATE TABLE IF NOT EXISTS "filters" (
+		"id" INTEGER PRIMARY KEY AUTOINCREMENT,
+		"user_id" INTEGER NOT NULL DEFAULT 0,
+		"chat_id" INTEGER NOT NULL DEFAULT 0,
+		"repo_id" INTEGER NOT NULL,
+		"kind" text NOT NULL,
+		"action" text NOT NULL,
+		"pattern" text NOT NULL,
+		"created_at" timestamp DEFAULT CURRENT_TIMESTAMP,
+		CONSTRAINT "filters_repo_id" FOREIGN KEY ("repo_id") REFERENCES "github_repos" ("id"),
+		CONSTRAINT "filters_rule" UNIQUE ("user_id", "chat_id", "repo_id", "kind", "action", "pattern") ON CONFLICT IGNORE
+	);`,
+	// 8: keyword alerts
+	`CREATE TABLE IF NOT EXISTS "alerts" (
+		"id" INTEGER PRIMARY KEY AUTOINCREMENT,
+		"user_id" INTEGER NOT NULL,
+		"pattern" text NOT NULL,
+		"created_at" timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		CONSTRAINT "alerts_user_id" FOREIGN KEY ("user_id") REFERENCES "github_users" ("id"),
+		CONSTRAINT "alerts_user_id_pattern" UNIQUE ("user_id", "pattern") ON CONFLICT IGNORE
+	);
+	CREATE TABLE IF NOT EXISTS "sent_alerts" (
+		"id" INTEGER PRIMARY KEY AUTOINCREMENT,
+		"alert_id" INTEGER NOT NULL,
+		"event" text NOT NULL,
+		"created_at" timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		CONSTRAINT "sent_alerts_alert_id_event" UNIQUE ("alert_id", "event") ON CONFLICT IGNORE
+	);
+	ALTER TABLE github_repos ADD COLUMN "alerts_checked_at" timestamp NOT NULL DEFAULT "0001-01-01 00:00:00+00:00";`,
+	// 9: subscription sources and watched owners
+	`ALTER TABLE users_repos ADD COLUMN "source" text NOT NULL DEFAULT "";
+	CREATE TABLE IF NOT EXISTS "owner_watches" (
+		"id" INTEGER PRIMARY KEY AUTOINCREMENT,
+		"user_id" INTEGER NOT NULL,
+		"chat_id" INTEGER NOT NULL DEFAULT 0,
+		"owner" text NOT NULL,
+		"kind" text NOT NULL,
+		"pattern" text NOT NULL DEFAULT "",
+		"created_at" timestamp DEFAULT CURRENT_TIMESTAMP,
+		CONSTRAINT "owner_watches_user_id" FOREIGN KEY ("user_id") REFERENCES "github_users" ("id"),
+		CONSTRAINT "owner_watches_user_id_chat_id_owner" UNIQUE ("user_id", "chat_id", "owner") ON CONFLICT REPLACE
+	);`,
+	// 10: repos removed locally but still watched on github
+	`CREATE TABLE IF NOT EXISTS "removed_repos" (
+		"id" INTEGER PRIMARY KEY AUTOINCREMENT,
+		"user_id" INTEGER NOT NULL,
+		"repo_id" INTEGER NOT NULL,
+		"created_at" timestamp DEFAULT CURRENT_TIMESTAMP,
+		CONSTRAINT "removed_repos_user_id" FOREIGN KEY ("user_id") REFERENCES "github_users" ("id"),
+		CONSTRAINT "removed_repos_repo_id" FOREIGN KEY ("repo_id") REFERENCES "github_repos" ("id"),
+		CONSTRAINT "removed_repos_user_id_repo_id" UNIQUE ("user_id", "repo_id") ON CONFLICT IGNORE
+	);`,
+	// 11: repo sync sources of github users
+	`ALTER TABLE github_users ADD COLUMN "sources" text NOT NULL DEFAULT "watched";`,
+	// 12: default github account of telegram users
+	`ALTER TABLE telegram_users ADD COLUMN "github_user_id" INTEGER NOT NULL DEFAULT 0;`,
+	// 13: drop access tokens logged with /start
+	`UPDATE telegram_messages SET message = substr(message, 1, instr(message, ' ')) || '[redacted]'
+	WHERE message LIKE '/start %' OR message LIKE '/start@% %' OR message LIKE '/startgroup %';`,
+	// 14: telegram users banned by operators
+	`CREATE TABLE IF NOT EXISTS "banned_users" (
+		"telegram_user_id" text PRIMARY KEY,
+		"created_at" timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);`,
+	// 15: one subscription per group and repo whoever added it
+	`DELETE FROM pending_notifications WHERE users_repos_id IN (
+		SELECT id FROM users_repos WHERE chat_id != 0 AND id NOT IN (
+			SELECT MIN(id) FROM users_repos WHERE chat_id != 0 GROUP BY repo_id, chat_id));
+	DELETE FROM users_repos WHERE chat_id != 0 AND id NOT IN (
+		SELECT MIN(id) FROM users_repos WHERE chat_id != 0 GROUP BY repo_id, chat_id);
+	CREATE UNIQUE INDEX IF NOT EXISTS "users_repos_repo_id_chat_id" ON "users_repos" ("repo_id", "chat_id") WHERE "chat_id" != 0;`,
+	// 16: lower case owner logins, watches differing only in case merge
+	`UPDATE OR REPLACE owner_watches SET owner = lower(owner);
+	UPDATE users_repos SET source = 'owner:' || lower(substr(source, 7)) WHERE source LIKE 'owner:%';`,
+}
+
+// Migrate applies pending schema migrations
+func Migrate(db *sql.DB) error {
+	var version int
+	if err := db.QueryRow(`PRAGMA user_version;`).Scan(&version); err != nil {
+		return err
+	}
+
+	for i := version; i < len(migrations); i++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(migrations[i]); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("migration %d: %s", i+1, err)
+		}
+
+		if _, err := tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d;`, i+1)); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("migration %d: %s", i+1, err)
+		}
+
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("migration %d: %s", i+1, err)
+		}
+
+		slog.Info("database migrated", "version", i+1)
+	}
+
+	return nil
+}
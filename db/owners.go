@@ -0,0 +1,138 @@
+package db
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	sql "github.com/lazada/sqle"
+)
+
+// Owner kinds
+const (
+	OwnerOrg  = "org"
+	OwnerUser = "user"
+)
+
+// OwnerWatch subscribes a user or a chat to every repo of an organization
+// or a github user
+type OwnerWatch struct {
+	ID             int64     `sql:"id"`
+	UserID         int64     `sql:"user_id"`
+	ChatID         int64     `sql:"chat_id"`
+	Owner          string    `sql:"owner"`
+	Kind           string    `sql:"kind"`
+	Pattern        string    `sql:"pattern"`
+	CreatedAt      time.Time `sql:"created_at"`
+	Name           string    `sql:"name"`
+	TelegramUserID string    `sql:"telegram_user_id"`
+	Token          string    `sql:"token"`
+}
+
+// Source returns source of links created by the watch
+func (w *OwnerWatch) Source() string {
+	return SourceOwner + w.Owner
+}
+
+// AddOwnerWatch adds or updates a watch and sets its id, the owner is
+// stored lower case as github logins are case insensitive
+func AddOwnerWatch(db *sql.DB, watch *OwnerWatch) error {
+	watch.Owner = strings.ToLower(watch.Owner)
+
+	res, err := db.Exec(
+		"INSERT INTO owner_watches (user_id, chat_id, owner, kind, pattern) VALUES (?, ?, ?, ?, ?);",
+		watch.UserID,
+		watch.ChatID,
+		watch.Owner,
+		watch.Kind,
+		watch.Pattern)
+	if err != nil {
+		return err
+	}
+
+	watch.ID, err = res.LastInsertId()
+
+	return err
+}
+
+const ownerWatchesSelect = `select
+	owner_watches.*,
+	github_users.name as name,
+	github_users.telegram_user_id as telegram_user_id,
+	github_users.token as token
+FROM
+	owner_watches
+	INNER JOIN github_users ON github_users.id = owner_watches.user_id`
+
+func queryOwnerWatches(ctx context.Context, db *sql.DB, sql string, args ...interface{}) (watches []*OwnerWatch, err error) {
+	var returnModel OwnerWatch
+
+	result, err := QuerySQLListContext(ctx, db, returnModel, sql, args...)
+	if err != nil {
+		return watches, err
+	}
+	for _, item := range result {
+		if returnModel, ok := item.Interface().(*OwnerWatch); ok {
+			watches = append(watches, returnModel)
+		}
+	}
+
+	return watches, err
+}
+
+// GetOwnerWatches returns every watch
+func GetOwnerWatches(ctx context.Context, db *sql.DB) ([]*OwnerWatch, error) {
+	return queryOwnerWatches(ctx, db, ownerWatchesSelect+` ORDER BY owner_watches.id;`)
+}
+
+// GetUserOwnerWatches returns watches of private chat of the user, or of a
+// chat if chatID is set
+func GetUserOwnerWatches(db *sql.DB, userID, chatID int64) ([]*OwnerWatch, error) {
+	if chatID != 0 {
+		return queryOwnerWatches(context.Background(), db, ownerWatchesSelect+` WHERE owner_watches.chat_id = ? ORDER BY owner_watches.owner;`, chatID)
+	}
+
+	return queryOwnerWatches(context.Background(), db, ownerWatchesSelect+` WHERE owner_watches.user_id = ? AND owner_watches.chat_id = 0 ORDER BY owner_watches.owner;`, userID)
+}
+
+// DeleteOwnerWatch removes a watch together with the links it created
+func DeleteOwnerWatch(db *sql.DB, watch *OwnerWatch) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM owner_watches WHERE id = ?;", watch.ID); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM users_repos WHERE user_id = ? AND chat_id = ? AND source = ?;", watch.UserID, watch.ChatID, watch.Source()); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetSourceLinks returns links of a user or chat created by source
+func GetSourceLinks(ctx context.Context, db *sql.DB, userID, chatID int64, source string) (usersRepos []*UsersReposResult, err error) {
+	var returnModel UsersReposResult
+	sql := usersReposSelect + `
+WHERE
+	users_repos.user_id = ? AND users_repos.chat_id = ? AND users_repos.source = ?
+ORDER BY
+	github_repos.repo_name;`
+
+	result, err := QuerySQLListContext(ctx, db, returnModel, sql, userID, chatID, source)
+	if err != nil {
+		return usersRepos, err
+	}
+	for _, item := range result {
+		if returnModel, ok := item.Interface().(*UsersReposResult); ok {
+			usersRepos = append(usersRepos, returnModel)
+		}
+	}
+
+	return usersRepos, err
+}
@@ -0,0 +1,58 @@
+package db
+
+import (
+	"context"
+	"testing"
+)
+
+func TestAddOwnerWatchIgnoresCase(t *testing.T) {
+	db := openTestDB(t)
+	mustExec(t, db, `INSERT INTO github_users (id, name, user_name, token, telegram_user_id) VALUES (1, "Octo Cat", "octocat", "token", 42)`)
+
+	for _, owner := range []string{"Acme", "acme", "ACME"} {
+		watch := &OwnerWatch{UserID: 1, Owner: owner, Kind: OwnerOrg}
+		if err := AddOwnerWatch(db, watch); err != nil {
+			t.Fatal(err)
+		}
+		if watch.Owner != "acme" || watch.Source() != SourceOwner+"acme" {
+			t.Errorf("AddOwnerWatch(%q) stored %q with source %q, want acme", owner, watch.Owner, watch.Source())
+		}
+	}
+
+	watches, err := GetUserOwnerWatches(db, 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(watches) != 1 || watches[0].Owner != "acme" {
+		t.Errorf("got watches %+v, want one of acme", watches)
+	}
+}
+
+func TestMigrateLowersOwners(t *testing.T) {
+	db := openTestDB(t)
+	mustExec(t, db, `INSERT INTO github_users (id, name, user_name, token, telegram_user_id) VALUES (1, "Octo Cat", "octocat", "token", 42)`)
+	mustExec(t, db, `INSERT INTO github_repos (id, name, repo_name) VALUES (1, "app", "Acme/app")`)
+	mustExec(t, db, `INSERT INTO owner_watches (user_id, owner, kind) VALUES (1, "Acme", "org"), (1, "acme", "org")`)
+	mustExec(t, db, `INSERT INTO users_repos (user_id, repo_id, updated_at, source) VALUES (1, 1, CURRENT_TIMESTAMP, "owner:Acme")`)
+	mustExec(t, db, `PRAGMA user_version = 15;`)
+
+	if err := Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+
+	watches, err := GetUserOwnerWatches(db, 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(watches) != 1 || watches[0].Owner != "acme" {
+		t.Fatalf("got watches %+v, want one of acme", watches)
+	}
+
+	links, err := GetSourceLinks(context.Background(), db, 1, 0, watches[0].Source())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(links) != 1 {
+		t.Errorf("got %d links of %s, want 1", len(links), watches[0].Source())
+	}
+}
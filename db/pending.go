@@ -0,0 +1,136 @@
+package db
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	sql "github.com/lazada/sqle"
+)
+
+// Reasons notifications are held
+const (
+	PendingDigest = "digest"
+	PendingQuiet  = "quiet"
+	PendingMuted  = "muted"
+)
+
+// PendingNotification is a commit waiting for the next digest of a subscription
+type PendingNotification struct {
+	ID             int64     `sql:"id"`
+	UserRepoID     int64     `sql:"users_repos_id"`
+	SHA            string    `sql:"sha"`
+	Author         string    `sql:"author"`
+	Title          string    `sql:"title"`
+	URL            string    `sql:"url"`
+	Date           time.Time `sql:"date"`
+	Reason         string    `sql:"reason"`
+	CreatedAt      time.Time `sql:"created_at"`
+	RepoName       string    `sql:"repo_name"`
+	ChatID         int64     `sql:"chat_id"`
+	TelegramUserID string    `sql:"telegram_user_id"`
+	Format         string    `sql:"format"`
+	Timezone       string    `sql:"timezone"`
+	QuietStart     string    `sql:"quiet_start"`
+	QuietEnd       string    `sql:"quiet_end"`
+	Delivery       string    `sql:"delivery"`
+	DigestTime     string    `sql:"digest_time"`
+	MutedUntil     time.Time `sql:"muted_until"`
+}
+
+// Settings returns settings of the subscriber
+func (n *PendingNotification) Settings() *TelegramUser {
+	return &TelegramUser{
+		TelegramUserID: n.TelegramUserID,
+		Format:         n.Format,
+		Timezone:       n.Timezone,
+		QuietStart:     n.QuietStart,
+		QuietEnd:       n.QuietEnd,
+	}
+}
+
+// AddPendingNotification queues a commit for the next digest
+func AddPendingNotification(ctx context.Context, db *sql.DB, n *PendingNotification) error {
+	_, err := execContext(ctx, db,
+		"INSERT INTO pending_notifications (users_repos_id, sha, author, title, url, date, reason, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?);",
+		n.UserRepoID,
+		n.SHA,
+		n.Author,
+		n.Title,
+		n.URL,
+		n.Date.UTC(),
+		n.Reason,
+		n.CreatedAt.UTC())
+
+	return err
+}
+
+// GetPendingNotifications returns queued commits of existing subscriptions
+// in the order they were queued
+func GetPendingNotifications(ctx context.Context, db *sql.DB) (items []*PendingNotification, err error) {
+	var returnModel PendingNotification
+	sql := `select
+	pending_notifications.id as id,
+	pending_notifications.users_repos_id as users_repos_id,
+	pending_notifications.sha as sha,
+	pending_notifications.author as author,
+	pending_notifications.title as title,
+	pending_notifications.url as url,
+	pending_notifications.date as date,
+	pending_notifications.reason as reason,
+	pending_notifications.created_at as created_at,
+	github_repos.repo_name as repo_name,
+	users_repos.chat_id as chat_id,
+	github_users.telegram_user_id as telegram_user_id,
+	COALESCE(telegram_users.format, "") as format,
+	COALESCE(telegram_users.timezone, "") as timezone,
+	COALESCE(telegram_users.quiet_start, "") as quiet_start,
+	COALESCE(telegram_users.quiet_end, "") as quiet_end,
+	users_repos.delivery as delivery,
+	users_repos.digest_time as digest_time,
+	users_repos.muted_until as muted_until
+FROM
+	pending_notifications
+	INNER JOIN users_repos ON users_repos.id = pending_notifications.users_repos_id
+	INNER JOIN github_repos ON github_repos.id = users_repos.repo_id
+	INNER JOIN github_users ON github_users.id = users_repos.user_id
+	LEFT JOIN telegram_users ON telegram_users.telegram_user_id = github_users.telegram_user_id
+ORDER BY
+	pending_notifications.id;`
+
+	result, err := QuerySQLListContext(ctx, db, returnModel, sql)
+	if err != nil {
+		return items, err
+	}
+	for _, item := range result {
+		if returnModel, ok := item.Interface().(*PendingNotification); ok {
+			items = append(items, returnModel)
+		}
+	}
+
+	return items, err
+}
+
+// DeletePendingNotifications removes delivered notifications
+func DeletePendingNotifications(ctx context.Context, db *sql.DB, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	list := make([]string, len(ids))
+	for i, id := range ids {
+		list[i] = strconv.FormatInt(id, 10)
+	}
+
+	_, err := execContext(ctx, db, "DELETE FROM pending_notifications WHERE id IN ("+strings.Join(list, ",")+");")
+
+	return err
+}
+
+// DeleteOrphanPendingNotifications removes notifications of deleted subscriptions
+func DeleteOrphanPendingNotifications(ctx context.Context, db *sql.DB) error {
+	_, err := execContext(ctx, db, "DELETE FROM pending_notifications WHERE users_repos_id NOT IN (SELECT id FROM users_repos);")
+
+	return err
+}
@@ -0,0 +1,130 @@
+package db
+
+import (
+	"time"
+
+	sql "github.com/lazada/sqle"
+)
+
+// ForgetTelegramUser deletes every github account of a telegram user with
+// tokens, subscriptions and cursors, settings and the message log
+func ForgetTelegramUser(db *sql.DB, telegramUserID string) error {
+	accounts, err := GetGithubAccounts(db, telegramUserID)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	for _, account := range accounts {
+		if err := deleteGithubUser(tx, account.ID); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+
+	for _, query := range []string{
+		"DELETE FROM telegram_messages WHERE user_id = ?;",
+		"DELETE FROM telegram_users WHERE telegram_user_id = ?;",
+	} {
+		if _, err := tx.Exec(query, telegramUserID); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// ExportTelegramUser returns rows of every table holding data of a telegram
+// user keyed by table name, tokens are masked
+func ExportTelegramUser(db *sql.DB, telegramUserID string) (map[string]interface{}, error) {
+	export := map[string]interface{}{
+		"telegram_user_id": telegramUserID,
+		"exported_at":      time.Now().UTC(),
+	}
+
+	const accounts = `(SELECT id FROM github_users WHERE telegram_user_id = ?)`
+
+	for _, table := range []struct {
+		name  string
+		query string
+	}{
+		{"telegram_users", `SELECT * FROM telegram_users WHERE telegram_user_id = ?;`},
+		{"github_users", `SELECT * FROM github_users WHERE telegram_user_id = ?;`},
+		{"users_repos", `SELECT users_repos.*, github_repos.repo_name FROM users_repos INNER JOIN github_repos ON github_repos.id = users_repos.repo_id WHERE users_repos.user_id IN ` + accounts + `;`},
+		{"pending_notifications", `SELECT * FROM pending_notifications WHERE users_repos_id IN (SELECT id FROM users_repos WHERE user_id IN ` + accounts + `);`},
+		{"filters", `SELECT * FROM filters WHERE user_id IN ` + accounts + `;`},
+		{"alerts", `SELECT * FROM alerts WHERE user_id IN ` + accounts + `;`},
+		{"owner_watches", `SELECT * FROM owner_watches WHERE user_id IN ` + accounts + `;`},
+		{"removed_repos", `SELECT removed_repos.*, github_repos.repo_name FROM removed_repos INNER JOIN github_repos ON github_repos.id = removed_repos.repo_id WHERE removed_repos.user_id IN ` + accounts + `;`},
+		{"telegram_messages", `SELECT * FROM telegram_messages WHERE user_id = ? ORDER BY id;`},
+	} {
+		rows, err := exportRows(db, table.query, telegramUserID)
+		if err != nil {
+			return nil, err
+		}
+		export[table.name] = rows
+	}
+
+	return export, nil
+}
+
+// exportRows reads query results as column name to value maps
+func exportRows(db *sql.DB, query string, args ...interface{}) ([]map[string]interface{}, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	result := []map[string]interface{}{}
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+
+		row := make(map[string]interface{}, len(columns))
+		for i, column := range columns {
+			value := values[i]
+			if b, ok := value.([]byte); ok {
+				value = string(b)
+			}
+			if column == "token" {
+				value = maskToken(value)
+			}
+			row[column] = value
+		}
+		result = append(result, row)
+	}
+
+	return result, rows.Err()
+}
+
+// maskToken keeps only the last characters of a token
+func maskToken(value interface{}) interface{} {
+	token, ok := value.(string)
+	if !ok {
+		return value
+	}
+
+	if len(token) <= 4 {
+		return "****"
+	}
+
+	return "****" + token[len(token)-4:]
+}
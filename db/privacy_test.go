@@ -0,0 +1,134 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	sql "github.com/lazada/sqle"
+)
+
+// seedAccount adds a github account of a telegram user with a
+// subscription, a queued notification, a filter, an alert, an owner watch
+// and a removed repo
+func seedAccount(t *testing.T, db *sql.DB, id int64, telegramUserID string) {
+	t.Helper()
+
+	login := fmt.Sprintf("user%d", id)
+	mustExec(t, db, `INSERT INTO github_users (id, name, user_name, token, telegram_user_id) VALUES (?, ?, ?, ?, ?)`, id, login, login, "gho_secret"+login, telegramUserID)
+	mustExec(t, db, `INSERT INTO github_repos (id, name, repo_name) VALUES (?, ?, ?)`, id, "repo", login+"/repo")
+	mustExec(t, db, `INSERT INTO users_repos (id, user_id, repo_id, updated_at) VALUES (?, ?, ?, CURRENT_TIMESTAMP)`, id, id, id)
+	mustExec(t, db, `INSERT INTO pending_notifications (users_repos_id, sha) VALUES (?, "0123456")`, id)
+	mustExec(t, db, `INSERT INTO filters (user_id, repo_id, kind, action, pattern) VALUES (?, ?, ?, ?, "src/**")`, id, id, FilterPath, FilterInclude)
+	mustExec(t, db, `INSERT INTO alerts (id, user_id, pattern) VALUES (?, ?, "CVE")`, id, id)
+	mustExec(t, db, `INSERT INTO sent_alerts (alert_id, event) VALUES (?, "release:1")`, id)
+	mustExec(t, db, `INSERT INTO owner_watches (user_id, owner, kind) VALUES (?, "acme", ?)`, id, OwnerOrg)
+	mustExec(t, db, `INSERT INTO removed_repos (user_id, repo_id) VALUES (?, ?)`, id, id)
+}
+
+// seedTelegramUser adds settings and a logged message of a telegram user
+func seedTelegramUser(t *testing.T, db *sql.DB, telegramUserID string, defaultAccount int64) {
+	t.Helper()
+
+	if err := SetDefaultAccount(db, telegramUserID, defaultAccount); err != nil {
+		t.Fatal(err)
+	}
+	mustExec(t, db, `INSERT INTO telegram_messages (user_id, message) VALUES (?, "/list")`, telegramUserID)
+}
+
+// countRows counts rows of every table holding data of github accounts or
+// of a telegram user
+func countRows(t *testing.T, db *sql.DB, accounts []int64, telegramUserID string) map[string]int {
+	t.Helper()
+
+	ids := make([]string, len(accounts))
+	for i, id := range accounts {
+		ids[i] = fmt.Sprint(id)
+	}
+	in := "(" + strings.Join(ids, ", ") + ")"
+
+	counts := make(map[string]int)
+	for table, query := range map[string]string{
+		"github_users":          `SELECT COUNT(*) FROM github_users WHERE id IN ` + in,
+		"users_repos":           `SELECT COUNT(*) FROM users_repos WHERE user_id IN ` + in,
+		"pending_notifications": `SELECT COUNT(*) FROM pending_notifications WHERE users_repos_id IN ` + in,
+		"filters":               `SELECT COUNT(*) FROM filters WHERE user_id IN ` + in,
+		"alerts":                `SELECT COUNT(*) FROM alerts WHERE user_id IN ` + in,
+		"sent_alerts":           `SELECT COUNT(*) FROM sent_alerts WHERE alert_id IN ` + in,
+		"owner_watches":         `SELECT COUNT(*) FROM owner_watches WHERE user_id IN ` + in,
+		"removed_repos":         `SELECT COUNT(*) FROM removed_repos WHERE user_id IN ` + in,
+		"telegram_users":        `SELECT COUNT(*) FROM telegram_users WHERE telegram_user_id = ` + telegramUserID,
+		"telegram_messages":     `SELECT COUNT(*) FROM telegram_messages WHERE user_id = ` + telegramUserID,
+	} {
+		var n int
+		if err := db.QueryRow(query).Scan(&n); err != nil {
+			t.Fatalf("%s: %v", table, err)
+		}
+		counts[table] = n
+	}
+
+	return counts
+}
+
+func TestForgetTelegramUser(t *testing.T) {
+	db := openTestDB(t)
+	seedAccount(t, db, 1, "42")
+	seedAccount(t, db, 2, "42")
+	seedTelegramUser(t, db, "42", 2)
+	seedAccount(t, db, 3, "7")
+	seedTelegramUser(t, db, "7", 3)
+
+	if err := ForgetTelegramUser(db, "42"); err != nil {
+		t.Fatal(err)
+	}
+
+	for table, n := range countRows(t, db, []int64{1, 2}, "42") {
+		if n != 0 {
+			t.Errorf("%d rows of the forgotten user left in %s", n, table)
+		}
+	}
+	for table, n := range countRows(t, db, []int64{3}, "7") {
+		if n != 1 {
+			t.Errorf("%d rows of another user in %s, want 1", n, table)
+		}
+	}
+}
+
+func TestExportTelegramUser(t *testing.T) {
+	db := openTestDB(t)
+	seedAccount(t, db, 1, "42")
+	seedAccount(t, db, 2, "42")
+	seedTelegramUser(t, db, "42", 2)
+	seedAccount(t, db, 3, "7")
+
+	export, err := ExportTelegramUser(db, "42")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for table, want := range map[string]int{
+		"telegram_users":        1,
+		"github_users":          2,
+		"users_repos":           2,
+		"pending_notifications": 2,
+		"filters":               2,
+		"alerts":                2,
+		"owner_watches":         2,
+		"removed_repos":         2,
+		"telegram_messages":     1,
+	} {
+		rows, _ := export[table].([]map[string]interface{})
+		if len(rows) != want {
+			t.Errorf("exported %d rows of %s, want %d", len(rows), table, want)
+		}
+	}
+
+	for _, row := range export["github_users"].([]map[string]interface{}) {
+		if token := row["token"]; token != "****ser1" && token != "****ser2" {
+			t.Errorf("exported token %q, want it masked", token)
+		}
+	}
+	if got := fmt.Sprint(export); strings.Contains(got, "gho_secret") || strings.Contains(got, "user3") {
+		t.Errorf("export %s has tokens or another user", got)
+	}
+}
@@ -0,0 +1,57 @@
+package db
+
+import (
+	"context"
+	sql "github.com/lazada/sqle"
+)
+
+// RemovedRepo is a repo the user removed with /delete while still watching
+// it on github, repo sync does not link it again
+type RemovedRepo struct {
+	ID       int64  `sql:"id"`
+	UserID   int64  `sql:"user_id"`
+	RepoID   int64  `sql:"repo_id"`
+	RepoName string `sql:"repo_name"`
+}
+
+// AddRemovedRepo ...
+func AddRemovedRepo(db *sql.DB, userID, repoID int64) error {
+	_, err := db.Exec("INSERT INTO removed_repos (user_id, repo_id) VALUES (?, ?);", userID, repoID)
+
+	return err
+}
+
+// DeleteRemovedRepo lets repo sync of every account of the user link the
+// repo again, userID is any of the accounts
+func DeleteRemovedRepo(ctx context.Context, db *sql.DB, userID, repoID int64) error {
+	_, err := execContext(ctx, db, "DELETE FROM removed_repos WHERE "+accountsOf("user_id")+" AND repo_id = ?;", userID, repoID)
+
+	return err
+}
+
+// GetRemovedRepos returns repos removed by any github account of the user
+func GetRemovedRepos(ctx context.Context, db *sql.DB, userID int64) (repos []*RemovedRepo, err error) {
+	var returnModel RemovedRepo
+	sql := `select
+	removed_repos.id as id,
+	removed_repos.user_id as user_id,
+	removed_repos.repo_id as repo_id,
+	github_repos.repo_name as repo_name
+FROM
+	removed_repos
+	INNER JOIN github_repos ON github_repos.id = removed_repos.repo_id
+WHERE
+	` + accountsOf("removed_repos.user_id") + `;`
+
+	result, err := QuerySQLListContext(ctx, db, returnModel, sql, userID)
+	if err != nil {
+		return repos, err
+	}
+	for _, item := range result {
+		if returnModel, ok := item.Interface().(*RemovedRepo); ok {
+			repos = append(repos, returnModel)
+		}
+	}
+
+	return repos, err
+}
@@ -0,0 +1,114 @@
+package db
+
+import (
+	"fmt"
+	"time"
+
+	sql "github.com/lazada/sqle"
+)
+
+// TelegramUser holds settings of a telegram user
+type TelegramUser struct {
+	TelegramUserID string    `sql:"telegram_user_id"`
+	Format         string    `sql:"format"`
+	Timezone       string    `sql:"timezone"`
+	QuietStart     string    `sql:"quiet_start"`
+	QuietEnd       string    `sql:"quiet_end"`
+	GithubUserID   int64     `sql:"github_user_id"`
+	CreatedAt      time.Time `sql:"created_at"`
+}
+
+// Location returns time zone of the user, UTC if not set
+func (u *TelegramUser) Location() *time.Location {
+	if u.Timezone != "" {
+		if loc, err := time.LoadLocation(u.Timezone); err == nil {
+			return loc
+		}
+	}
+
+	return time.UTC
+}
+
+// IsQuiet reports whether t falls into quiet hours of the user, the window
+// may span midnight
+func (u *TelegramUser) IsQuiet(t time.Time) bool {
+	start, err := ClockMinutes(u.QuietStart)
+	if err != nil {
+		return false
+	}
+	end, err := ClockMinutes(u.QuietEnd)
+	if err != nil {
+		return false
+	}
+
+	t = t.In(u.Location())
+	now := t.Hour()*60 + t.Minute()
+
+	if start <= end {
+		return now >= start && now < end
+	}
+
+	return now >= start || now < end
+}
+
+// ClockMinutes parses HH:MM into minutes since midnight
+func ClockMinutes(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("wrong time %q, use HH:MM", s)
+	}
+
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// GetTelegramUser returns settings of a telegram user, defaults if the
+// user never changed them
+func GetTelegramUser(db *sql.DB, telegramUserID string) (*TelegramUser, error) {
+	var returnModel TelegramUser
+
+	result, err := QuerySQLObject(db, returnModel, `SELECT * FROM telegram_users WHERE telegram_user_id = ?;`, telegramUserID)
+	if err != nil {
+		return nil, err
+	}
+
+	if returnModel, ok := result.Interface().(*TelegramUser); ok && returnModel.TelegramUserID != "" {
+		return returnModel, nil
+	}
+
+	return &TelegramUser{TelegramUserID: telegramUserID}, nil
+}
+
+// SetTelegramUserFormat stores notification format preset of a telegram user
+func SetTelegramUserFormat(db *sql.DB, telegramUserID, format string) error {
+	_, err := db.Exec(
+		`INSERT INTO telegram_users (telegram_user_id, format) VALUES (?, ?)
+		ON CONFLICT (telegram_user_id) DO UPDATE SET format = excluded.format;`,
+		telegramUserID,
+		format)
+
+	return err
+}
+
+// SetTelegramUserTimezone stores time zone name of a telegram user
+func SetTelegramUserTimezone(db *sql.DB, telegramUserID, timezone string) error {
+	_, err := db.Exec(
+		`INSERT INTO telegram_users (telegram_user_id, timezone) VALUES (?, ?)
+		ON CONFLICT (telegram_user_id) DO UPDATE SET timezone = excluded.timezone;`,
+		telegramUserID,
+		timezone)
+
+	return err
+}
+
+// SetTelegramUserQuiet stores quiet hours of a telegram user, empty start
+// and end turn them off
+func SetTelegramUserQuiet(db *sql.DB, telegramUserID, start, end string) error {
+	_, err := db.Exec(
+		`INSERT INTO telegram_users (telegram_user_id, quiet_start, quiet_end) VALUES (?, ?, ?)
+		ON CONFLICT (telegram_user_id) DO UPDATE SET quiet_start = excluded.quiet_start, quiet_end = excluded.quiet_end;`,
+		telegramUserID,
+		start,
+		end)
+
+	return err
+}
@@ -0,0 +1,60 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIsQuiet(t *testing.T) {
+	at := func(hour, min int) time.Time {
+		return time.Date(2026, 1, 15, hour, min, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name string
+		user TelegramUser
+		t    time.Time
+		want bool
+	}{
+		{"no quiet hours", TelegramUser{}, at(3, 0), false},
+		{"same day inside", TelegramUser{QuietStart: "12:00", QuietEnd: "14:00"}, at(13, 0), true},
+		{"same day start", TelegramUser{QuietStart: "12:00", QuietEnd: "14:00"}, at(12, 0), true},
+		{"same day end", TelegramUser{QuietStart: "12:00", QuietEnd: "14:00"}, at(14, 0), false},
+		{"overnight before midnight", TelegramUser{QuietStart: "23:00", QuietEnd: "08:00"}, at(23, 30), true},
+		{"overnight after midnight", TelegramUser{QuietStart: "23:00", QuietEnd: "08:00"}, at(7, 59), true},
+		{"overnight daytime", TelegramUser{QuietStart: "23:00", QuietEnd: "08:00"}, at(12, 0), false},
+		// 22:30 UTC is 23:30 in Berlin
+		{"time zone", TelegramUser{QuietStart: "23:00", QuietEnd: "08:00", Timezone: "Europe/Berlin"}, at(22, 30), true},
+		{"time zone daytime", TelegramUser{QuietStart: "23:00", QuietEnd: "08:00", Timezone: "Europe/Berlin"}, at(7, 30), false},
+		{"unknown time zone is utc", TelegramUser{QuietStart: "23:00", QuietEnd: "08:00", Timezone: "Nowhere/Town"}, at(23, 30), true},
+		{"wrong start", TelegramUser{QuietStart: "late", QuietEnd: "08:00"}, at(3, 0), false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.user.IsQuiet(tt.t); got != tt.want {
+			t.Errorf("%s: IsQuiet(%s) = %t, want %t", tt.name, tt.t.Format("15:04"), got, tt.want)
+		}
+	}
+}
+
+func TestClockMinutes(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int
+		wantErr bool
+	}{
+		{"00:00", 0, false},
+		{"08:30", 510, false},
+		{"23:59", 1439, false},
+		{"24:00", 0, true},
+		{"8:30", 510, false},
+		{"noon", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ClockMinutes(tt.in)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("ClockMinutes(%q) = %d, %v, want %d, error %t", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -1,13 +1,23 @@
 package ghapi
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"log/slog"
 	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	database "github.com/ad/go-githublistener/db"
+	logging "github.com/ad/go-githublistener/logging"
+	metrics "github.com/ad/go-githublistener/metrics"
+	tracing "github.com/ad/go-githublistener/tracing"
 )
 
 // OAuthAccessResponse ...
@@ -25,6 +35,7 @@ type UserResponse struct {
 type Repo struct {
 	Name      string    `json:"name"`
 	FullName  string    `json:"full_name"`
+	Archived  bool      `json:"archived"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
@@ -36,10 +47,49 @@ type RepoErrorAnswer struct {
 
 // CommitItem ...
 type CommitItem struct {
-	SHA     string `json:"sha"`
-	Commit  Commit `json:"commit"`
-	URL     string `json:"url"`
-	HTMLUrl string `json:"html_url"`
+	SHA     string      `json:"sha"`
+	Commit  Commit      `json:"commit"`
+	URL     string      `json:"url"`
+	HTMLUrl string      `json:"html_url"`
+	Author  *Account    `json:"author"`
+	Parents []CommitRef `json:"parents"`
+	Stats   CommitStats `json:"stats"`
+	Files   []File      `json:"files"`
+}
+
+// Account is the github user linked to a commit, nil when the commit email
+// does not belong to any account
+type Account struct {
+	Login string `json:"login"`
+}
+
+// CommitRef ...
+type CommitRef struct {
+	SHA string `json:"sha"`
+}
+
+// CommitStats ...
+type CommitStats struct {
+	Additions int `json:"additions"`
+	Deletions int `json:"deletions"`
+	Total     int `json:"total"`
+}
+
+// File ...
+type File struct {
+	Filename  string `json:"filename"`
+	Status    string `json:"status"`
+	Additions int    `json:"additions"`
+	Deletions int    `json:"deletions"`
+}
+
+// CompareURL returns github page comparing the commit with its first parent
+func (c *CommitItem) CompareURL(repoName string) string {
+	if len(c.Parents) == 0 {
+		return c.HTMLUrl
+	}
+
+	return "https://github.com/" + repoName + "/compare/" + c.Parents[0].SHA + "..." + c.SHA
 }
 
 // Commit ...
@@ -63,11 +113,44 @@ type Committer struct {
 	Date  time.Time `json:"date"`
 }
 
+// PullRequest ...
+type PullRequest struct {
+	Number    int       `json:"number"`
+	Title     string    `json:"title"`
+	Body      string    `json:"body"`
+	State     string    `json:"state"`
+	HTMLUrl   string    `json:"html_url"`
+	User      Account   `json:"user"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Release ...
+type Release struct {
+	ID          int64     `json:"id"`
+	TagName     string    `json:"tag_name"`
+	Name        string    `json:"name"`
+	Body        string    `json:"body"`
+	HTMLUrl     string    `json:"html_url"`
+	Author      Account   `json:"author"`
+	CreatedAt   time.Time `json:"created_at"`
+	PublishedAt time.Time `json:"published_at"`
+}
+
+// RateLimit is the api quota of a token from the last response
+type RateLimit struct {
+	Limit     int
+	Remaining int
+	Reset     time.Time
+}
+
 // Client ...
 type Client struct {
 	HTTPClient   http.Client
 	clientID     string
 	clientSecret string
+
+	mu         sync.Mutex
+	rateLimits map[string]RateLimit
 }
 
 // NewClient ...
@@ -75,6 +158,9 @@ func NewClient(clientID, clientSecret string) *Client {
 	client := &Client{
 		HTTPClient: http.Client{
 			Timeout: time.Duration(5 * time.Second),
+			Transport: &tracing.Transport{Name: func(r *http.Request) string {
+				return "github " + r.Method + " " + Endpoint(r.URL.Path)
+			}},
 		},
 		clientID:     clientID,
 		clientSecret: clientSecret,
@@ -83,17 +169,142 @@ func NewClient(clientID, clientSecret string) *Client {
 	return client
 }
 
+// do sends a request recording metrics and quota of the token
+func (c *Client) do(request *http.Request, token string) (*http.Response, error) {
+	endpoint := request.Method + " " + Endpoint(request.URL.Path)
+	start := time.Now()
+
+	res, err := c.HTTPClient.Do(request)
+	metrics.GithubRequestDuration.Since(start, endpoint)
+	if err != nil {
+		metrics.GithubRequests.Inc(endpoint, "error")
+		slog.ErrorContext(request.Context(), "github request failed", "endpoint", endpoint, logging.Err(err))
+		return nil, err
+	}
+	metrics.GithubRequests.Inc(endpoint, strconv.Itoa(res.StatusCode))
+
+	level := slog.LevelDebug
+	if res.StatusCode >= http.StatusBadRequest {
+		level = slog.LevelWarn
+	}
+	slog.Log(request.Context(), level, "github request",
+		"endpoint", endpoint,
+		"status", res.StatusCode,
+		"duration", time.Since(start),
+		logging.KeyGithubRequestID, res.Header.Get("X-GitHub-Request-Id"))
+
+	if token != "" {
+		c.trackRateLimit(token, res)
+	}
+
+	return res, nil
+}
+
+var (
+	shaRe    = regexp.MustCompile(`^[0-9a-f]{7,40}$`)
+	numberRe = regexp.MustCompile(`^[0-9]+$`)
+)
+
+// Endpoint replaces owners, repos, shas and numbers in an api path with
+// placeholders to keep metric labels few
+func Endpoint(path string) string {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	for i := 0; i < len(parts); i++ {
+		switch {
+		case parts[i] == "repos" && i+2 < len(parts):
+			parts[i+1], parts[i+2] = ":owner", ":repo"
+			i += 2
+		case (parts[i] == "users" || parts[i] == "orgs") && i+1 < len(parts):
+			parts[i+1] = ":owner"
+			i++
+		case shaRe.MatchString(parts[i]) && i > 0 && parts[i-1] == "commits":
+			parts[i] = ":sha"
+		case numberRe.MatchString(parts[i]):
+			parts[i] = ":number"
+		}
+	}
+
+	return "/" + strings.Join(parts, "/")
+}
+
+// rateLimitTTL is how long quota of a token is kept after it resets
+const rateLimitTTL = time.Hour
+
+// trackRateLimit remembers quota headers of a response
+func (c *Client) trackRateLimit(token string, res *http.Response) {
+	limit, err := strconv.Atoi(res.Header.Get("X-RateLimit-Limit"))
+	if err != nil {
+		return
+	}
+	remaining, _ := strconv.Atoi(res.Header.Get("X-RateLimit-Remaining"))
+	reset, _ := strconv.ParseInt(res.Header.Get("X-RateLimit-Reset"), 10, 64)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.rateLimits == nil {
+		c.rateLimits = make(map[string]RateLimit)
+	}
+	c.rateLimits[token] = RateLimit{Limit: limit, Remaining: remaining, Reset: time.Unix(reset, 0)}
+}
+
+// RateLimits returns last seen api quota per token, tokens unused for an
+// hour after their quota reset are forgotten
+func (c *Client) RateLimits() map[string]RateLimit {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	limits := make(map[string]RateLimit, len(c.rateLimits))
+	for token, limit := range c.rateLimits {
+		if time.Since(limit.Reset) > rateLimitTTL {
+			delete(c.rateLimits, token)
+			continue
+		}
+		limits[token] = limit
+	}
+
+	return limits
+}
+
+// ForgetToken drops quota of a token that was revoked or unlinked
+func (c *Client) ForgetToken(token string) {
+	c.mu.Lock()
+	delete(c.rateLimits, token)
+	c.mu.Unlock()
+}
+
+// Ping checks github api is reachable, rate limit requests are not
+// counted against the quota
+func (c *Client) Ping(ctx context.Context) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://api.github.com/rate_limit", nil)
+	if err != nil {
+		return err
+	}
+
+	res, err := c.do(request, "")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = res.Body.Close() }()
+
+	if res.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("github api answered %s", res.Status)
+	}
+
+	return nil
+}
+
 // GetGithubUserAccessToken ...
-func (c *Client) GetGithubUserAccessToken(code string) (token string, err error) {
+func (c *Client) GetGithubUserAccessToken(ctx context.Context, code string) (token string, err error) {
 	reqURL := fmt.Sprintf("https://github.com/login/oauth/access_token?client_id=%s&client_secret=%s&code=%s", c.clientID, c.clientSecret, code)
-	req, err := http.NewRequest(http.MethodPost, reqURL, nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, reqURL, nil)
 	if err != nil {
 		return "", fmt.Errorf("could not create HTTP request: %v", err)
 	}
 
 	req.Header.Set("Accept", "application/json")
 
-	res, err := c.HTTPClient.Do(req)
+	res, err := c.do(req, "")
 	if err != nil {
 		return "", fmt.Errorf("could not send HTTP request: %v", err)
 	}
@@ -113,10 +324,10 @@ func (c *Client) GetGithubUserAccessToken(code string) (token string, err error)
 }
 
 // GetGithubUser ...
-func (c *Client) GetGithubUser(code string) (*UserResponse, error) {
+func (c *Client) GetGithubUser(ctx context.Context, code string) (*UserResponse, error) {
 	url := "https://api.github.com/user"
 
-	body, err := c.MakeRequest(url, code)
+	body, err := c.MakeRequest(ctx, url, code)
 	if err != nil {
 		return nil, err
 	}
@@ -130,14 +341,14 @@ func (c *Client) GetGithubUser(code string) (*UserResponse, error) {
 }
 
 // MakeRequest ...
-func (c *Client) MakeRequest(url, token string) ([]byte, error) {
-	request, err := http.NewRequest("GET", url, nil)
+func (c *Client) MakeRequest(ctx context.Context, url, token string) ([]byte, error) {
+	request, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, err
 	}
 	request.Header.Set("Authorization", "token "+token)
 
-	res, err := c.HTTPClient.Do(request)
+	res, err := c.do(request, token)
 	if err != nil {
 		return nil, err
 	}
@@ -151,28 +362,70 @@ func (c *Client) MakeRequest(url, token string) ([]byte, error) {
 	return body, nil
 }
 
-// GetGithubUserRepos ...
-func (c *Client) GetGithubUserRepos(code, username string) ([]*Repo, error) {
-	var repos []*Repo
+// GetGithubUserRepos returns repos the user is watching
+func (c *Client) GetGithubUserRepos(ctx context.Context, code, username string) ([]*Repo, error) {
+	return c.getRepoPages(ctx, "https://api.github.com/users/"+username+"/subscriptions?per_page=100&page=", code)
+}
 
-	url := "https://api.github.com/users/" + username + "/subscriptions"
-	if body, err := c.MakeRequest(url, code); err == nil {
-		if err2 := json.Unmarshal(body, &repos); err2 != nil {
-			return nil, fmt.Errorf("%s\n%s", err2, string(body))
-		}
+// GetGithubUserSourceRepos returns repos the user watches, starred, owns or
+// can access through organization membership
+func (c *Client) GetGithubUserSourceRepos(ctx context.Context, code, username, source string) ([]*Repo, error) {
+	switch source {
+	case database.SourceWatched:
+		return c.GetGithubUserRepos(ctx, code, username)
+	case database.SourceStarred:
+		return c.getRepoPages(ctx, "https://api.github.com/users/"+username+"/starred?per_page=100&page=", code)
+	case database.SourceOwned:
+		return c.getRepoPages(ctx, "https://api.github.com/user/repos?affiliation=owner&per_page=100&page=", code)
+	case database.SourceOrgs:
+		return c.getRepoPages(ctx, "https://api.github.com/user/repos?affiliation=organization_member&per_page=100&page=", code)
+	}
+
+	return nil, fmt.Errorf("unknown source %s", source)
+}
+
+// SetGithubSubscription watches or unwatches a repo on behalf of the token
+// owner, it needs the notifications scope
+func (c *Client) SetGithubSubscription(ctx context.Context, code, reponame string, subscribed bool) error {
+	url := "https://api.github.com/repos/" + reponame + "/subscription"
+
+	var request *http.Request
+	var err error
+	if subscribed {
+		request, err = http.NewRequestWithContext(ctx, http.MethodPut, url, strings.NewReader(`{"subscribed":true}`))
 	} else {
-		return nil, fmt.Errorf("%s\n%s", err, string(body))
+		request, err = http.NewRequestWithContext(ctx, http.MethodDelete, url, nil)
+	}
+	if err != nil {
+		return err
 	}
+	request.Header.Set("Authorization", "token "+code)
 
-	return repos, nil
+	res, err := c.do(request, code)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = res.Body.Close() }()
+
+	if res.StatusCode >= http.StatusBadRequest {
+		body, _ := ioutil.ReadAll(res.Body)
+
+		var answer RepoErrorAnswer
+		if err := json.Unmarshal(body, &answer); err == nil && answer.Message != "" {
+			return fmt.Errorf("%s", answer.Message)
+		}
+		return fmt.Errorf("%s", res.Status)
+	}
+
+	return nil
 }
 
 // GetGithubRepo ...
-func (c *Client) GetGithubRepo(code, reponame string) (*Repo, error) {
+func (c *Client) GetGithubRepo(ctx context.Context, code, reponame string) (*Repo, error) {
 	var repo *Repo
 
 	url := "https://api.github.com/repos/" + reponame
-	if body, err := c.MakeRequest(url, code); err == nil {
+	if body, err := c.MakeRequest(ctx, url, code); err == nil {
 		if err2 := json.Unmarshal(body, &repo); err2 != nil {
 			return nil, fmt.Errorf("%s\n%s", err2, string(body))
 		}
@@ -184,11 +437,11 @@ func (c *Client) GetGithubRepo(code, reponame string) (*Repo, error) {
 }
 
 // GetGithubUserRepoCommits ...
-func (c *Client) GetGithubUserRepoCommits(item *database.UsersReposResult) ([]*CommitItem, error) {
+func (c *Client) GetGithubUserRepoCommits(ctx context.Context, item *database.UsersReposResult) ([]*CommitItem, error) {
 	var commits []*CommitItem
 
 	url := "https://api.github.com/repos/" + item.RepoName + "/commits?since=" + item.UpdatedAt.Add(time.Second*1).Format(time.RFC3339)
-	if body, err := c.MakeRequest(url, item.Token); err == nil {
+	if body, err := c.MakeRequest(ctx, url, item.Token); err == nil {
 		if err2 := json.Unmarshal(body, &commits); err2 != nil {
 			var repoErrorAnswer RepoErrorAnswer
 			if err2 := json.Unmarshal(body, &repoErrorAnswer); err2 == nil {
@@ -206,3 +459,110 @@ func (c *Client) GetGithubUserRepoCommits(item *database.UsersReposResult) ([]*C
 
 	return commits, nil
 }
+
+// GetGithubCommit returns a single commit with stats and changed files
+func (c *Client) GetGithubCommit(ctx context.Context, code, reponame, sha string) (*CommitItem, error) {
+	var commit *CommitItem
+
+	url := "https://api.github.com/repos/" + reponame + "/commits/" + sha
+	if body, err := c.MakeRequest(ctx, url, code); err == nil {
+		if err2 := json.Unmarshal(body, &commit); err2 != nil {
+			return nil, fmt.Errorf("%s\n%s", err2, string(body))
+		}
+		if commit.SHA == "" {
+			return nil, fmt.Errorf("commit %s not found in %s", sha, reponame)
+		}
+	} else {
+		return nil, fmt.Errorf("%s\n%s", err, string(body))
+	}
+
+	return commit, nil
+}
+
+// GetGithubRepoPulls returns recently created pull requests of a repo
+func (c *Client) GetGithubRepoPulls(ctx context.Context, code, reponame string) ([]*PullRequest, error) {
+	var pulls []*PullRequest
+
+	url := "https://api.github.com/repos/" + reponame + "/pulls?state=all&sort=created&direction=desc&per_page=30"
+	if body, err := c.MakeRequest(ctx, url, code); err == nil {
+		if err2 := json.Unmarshal(body, &pulls); err2 != nil {
+			return nil, fmt.Errorf("%s\n%s", err2, string(body))
+		}
+	} else {
+		return nil, fmt.Errorf("%s\n%s", err, string(body))
+	}
+
+	return pulls, nil
+}
+
+// GetGithubRepoReleases returns recent releases of a repo
+func (c *Client) GetGithubRepoReleases(ctx context.Context, code, reponame string) ([]*Release, error) {
+	var releases []*Release
+
+	url := "https://api.github.com/repos/" + reponame + "/releases?per_page=10"
+	if body, err := c.MakeRequest(ctx, url, code); err == nil {
+		if err2 := json.Unmarshal(body, &releases); err2 != nil {
+			return nil, fmt.Errorf("%s\n%s", err2, string(body))
+		}
+	} else {
+		return nil, fmt.Errorf("%s\n%s", err, string(body))
+	}
+
+	return releases, nil
+}
+
+// maxRepoPages limits repos listed for an owner or watched by a user to 1000
+const maxRepoPages = 10
+
+// ErrTruncated comes with the first maxRepoPages pages of a longer repo
+// list, repos missing from it may still exist
+var ErrTruncated = errors.New("repo list truncated at 1000 repos")
+
+// GetGithubOwnerRepos returns public repos of an organization, or of a user
+// if org is false
+func (c *Client) GetGithubOwnerRepos(ctx context.Context, code, owner string, org bool) ([]*Repo, error) {
+	url := "https://api.github.com/users/" + owner + "/repos?type=owner&per_page=100&page="
+	if org {
+		url = "https://api.github.com/orgs/" + owner + "/repos?type=public&per_page=100&page="
+	}
+
+	repos, err := c.getRepoPages(ctx, url, code)
+	if err != nil && err.Error() == notFound {
+		return nil, fmt.Errorf("%s not found", owner)
+	}
+
+	return repos, err
+}
+
+const notFound = "Not Found"
+
+// getRepoPages reads up to maxRepoPages pages of 100 repos, url must end
+// with the page parameter. A full last page returns the repos read with
+// ErrTruncated
+func (c *Client) getRepoPages(ctx context.Context, url, code string) ([]*Repo, error) {
+	var repos []*Repo
+
+	for page := 1; page <= maxRepoPages; page++ {
+		var items []*Repo
+
+		body, err := c.MakeRequest(ctx, url+strconv.Itoa(page), code)
+		if err != nil {
+			return nil, fmt.Errorf("%s\n%s", err, string(body))
+		}
+
+		if err2 := json.Unmarshal(body, &items); err2 != nil {
+			var repoErrorAnswer RepoErrorAnswer
+			if err3 := json.Unmarshal(body, &repoErrorAnswer); err3 == nil && repoErrorAnswer.Message == notFound {
+				return nil, fmt.Errorf(notFound)
+			}
+			return nil, fmt.Errorf("%s\n%s", err2, string(body))
+		}
+
+		repos = append(repos, items...)
+		if len(items) < 100 {
+			return repos, nil
+		}
+	}
+
+	return repos, ErrTruncated
+}
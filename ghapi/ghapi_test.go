@@ -0,0 +1,66 @@
+package ghapi
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestEndpoint(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/user", "/user"},
+		{"/user/repos", "/user/repos"},
+		{"/users/octocat/repos", "/users/:owner/repos"},
+		{"/orgs/acme/repos", "/orgs/:owner/repos"},
+		{"/repos/octo/hello", "/repos/:owner/:repo"},
+		{"/repos/octo/hello/commits", "/repos/:owner/:repo/commits"},
+		{"/repos/octo/hello/commits/7fd1a60b01f91b314f59955a4e4d4e80d8edf11d", "/repos/:owner/:repo/commits/:sha"},
+		{"/repos/octo/hello/pulls/1347", "/repos/:owner/:repo/pulls/:number"},
+		{"/user/subscriptions/octo/hello", "/user/subscriptions/octo/hello"},
+		{"/repos/octo", "/repos/octo"},
+		{"/users/deadbeef", "/users/:owner"},
+		{"/rate_limit/", "/rate_limit"},
+	}
+
+	for _, tt := range tests {
+		if got := Endpoint(tt.path); got != tt.want {
+			t.Errorf("Endpoint(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestRateLimits(t *testing.T) {
+	c := NewClient("id", "secret")
+
+	track := func(token string, remaining int, reset time.Time) {
+		res := &http.Response{Header: http.Header{}}
+		res.Header.Set("X-RateLimit-Limit", "5000")
+		res.Header.Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+		res.Header.Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+		c.trackRateLimit(token, res)
+	}
+
+	now := time.Now()
+	track("fresh", 4000, now.Add(30*time.Minute))
+	track("recent", 10, now.Add(-30*time.Minute))
+	track("stale", 0, now.Add(-2*rateLimitTTL))
+	track("unlinked", 4999, now.Add(time.Hour))
+	c.trackRateLimit("no headers", &http.Response{Header: http.Header{}})
+
+	c.ForgetToken("unlinked")
+
+	limits := c.RateLimits()
+	if len(limits) != 2 || limits["fresh"].Remaining != 4000 || limits["recent"].Remaining != 10 {
+		t.Errorf("RateLimits() = %+v, want fresh and recent", limits)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.rateLimits["stale"]; ok {
+		t.Error("stale token was not pruned")
+	}
+}
@@ -3,12 +3,12 @@ module github.com/ad/go-githublistener
 go 1.22
 
 require (
-	github.com/amoghe/distillog v0.0.0-20180726233512-ae382b35b717
 	github.com/lazada/sqle v0.0.0-20171211164427-f1ca64d42ef4
 	github.com/mattn/go-sqlite3 v2.0.3+incompatible
 	github.com/robfig/cron/v3 v3.0.1
 	golang.org/x/net v0.33.0
 	gopkg.in/telegram-bot-api.v4 v4.6.4
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	database "github.com/ad/go-githublistener/db"
+	logging "github.com/ad/go-githublistener/logging"
+)
+
+// updatesMaxAge is how long getUpdates may fail before the bot is not
+// ready, long polling returns at least every 60 seconds
+const updatesMaxAge = 3 * time.Minute
+
+// githubCheckEvery limits how often /readyz calls github
+const githubCheckEvery = time.Minute
+
+var started = time.Now()
+
+// Check is the result of one readiness check
+type Check struct {
+	Status      string     `json:"status"`
+	Error       string     `json:"error,omitempty"`
+	LastSuccess *time.Time `json:"last_success,omitempty"`
+	Age         string     `json:"age,omitempty"`
+}
+
+// Health is the body of /healthz and /readyz
+type Health struct {
+	Status  string            `json:"status"`
+	Version string            `json:"version"`
+	Uptime  string            `json:"uptime"`
+	Checks  map[string]*Check `json:"checks,omitempty"`
+}
+
+func newCheck(err error) *Check {
+	if err != nil {
+		return &Check{Status: "fail", Error: err.Error()}
+	}
+
+	return &Check{Status: "ok"}
+}
+
+// warnCheck is newCheck for dependencies the bot works around, a failure
+// is reported without failing readiness
+func warnCheck(err error) *Check {
+	check := newCheck(err)
+	if err != nil {
+		check.Status = "warn"
+	}
+
+	return check
+}
+
+// recentCheck fails when last is older than maxAge, a zero last counts
+// from start of the process
+func recentCheck(last time.Time, maxAge time.Duration) *Check {
+	check := &Check{Status: "ok"}
+
+	since := last
+	if last.IsZero() {
+		since = started
+	} else {
+		check.LastSuccess = &last
+	}
+
+	age := time.Since(since)
+	if !last.IsZero() {
+		check.Age = age.Round(time.Second).String()
+	}
+
+	if age > maxAge {
+		check.Status = "fail"
+		check.Error = fmt.Sprintf("no success for %s", age.Round(time.Second))
+	}
+
+	return check
+}
+
+// githubPing caches github reachability between readiness probes
+type githubPing struct {
+	mu      sync.Mutex
+	checked time.Time
+	err     error
+}
+
+func (g *githubPing) check(ctx context.Context) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if time.Since(g.checked) < githubCheckEvery {
+		return g.err
+	}
+
+	g.err = client.Ping(ctx)
+	g.checked = time.Now()
+
+	return g.err
+}
+
+var githubHealth githubPing
+
+// ready runs every readiness check, lastUpdates is when telegram updates
+// were last received
+func ready(ctx context.Context, lastUpdates time.Time) *Health {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	health := newHealth()
+	health.Checks = map[string]*Check{
+		"database": newCheck(database.Ping(ctx, db)),
+		"telegram": recentCheck(lastUpdates, updatesMaxAge),
+		// polls retry on their own, a github outage must not get the bot
+		// restarted or taken out of rotation
+		"github": warnCheck(githubHealth.check(ctx)),
+	}
+
+	tick := repoPoller.LastTick()
+	var last time.Time
+	if !tick.Started.IsZero() {
+		last = tick.Started.Add(tick.Duration)
+	}
+	health.Checks["cron"] = recentCheck(last, readyTickAge)
+
+	for _, check := range health.Checks {
+		if check.Status == "fail" {
+			health.Status = "fail"
+		}
+	}
+
+	return health
+}
+
+func newHealth() *Health {
+	return &Health{
+		Status:  "ok",
+		Version: version,
+		Uptime:  time.Since(started).Round(time.Second).String(),
+	}
+}
+
+func writeHealth(w http.ResponseWriter, health *Health) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+
+	if health.Status != "ok" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	if err := json.NewEncoder(w).Encode(health); err != nil {
+		slog.Error("failed to write health", logging.Err(err))
+	}
+}
+
+// registerHealthHandlers adds /healthz reporting the process is up and
+// /readyz reporting whether the bot actually works
+func registerHealthHandlers() {
+	http.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		writeHealth(w, newHealth())
+	})
+
+	http.HandleFunc("/readyz", readyHandler(bot.LastUpdates))
+}
+
+// readyHandler serves /readyz, lastUpdates reports when the bot last
+// received telegram updates
+func readyHandler(lastUpdates func() time.Time) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeHealth(w, ready(r.Context(), lastUpdates()))
+	}
+}
+
+// healthcheck probes /healthz of a running instance, the image has no curl
+// so docker HEALTHCHECK runs the binary itself
+func healthcheck(port int) int {
+	httpClient := http.Client{Timeout: 10 * time.Second}
+
+	res, err := httpClient.Get("http://127.0.0.1:" + strconv.Itoa(port) + "/healthz")
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	defer func() { _ = res.Body.Close() }()
+
+	if res.StatusCode != http.StatusOK {
+		fmt.Println(res.Status)
+		return 1
+	}
+
+	return 0
+}
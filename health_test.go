@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	poller "github.com/ad/go-githublistener/poller"
+)
+
+// useTestPoller points the repoPoller global to a poller whose last tick
+// started at tickAt
+func useTestPoller(t *testing.T, tickAt time.Time) {
+	t.Helper()
+
+	previous := repoPoller
+	repoPoller = poller.New(db, client, nil)
+	repoPoller.Clock = poller.NewFakeClock(tickAt)
+	if err := repoPoller.Tick(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { repoPoller = previous })
+}
+
+func TestReadyz(t *testing.T) {
+	previousAge := readyTickAge
+	readyTickAge = 10 * time.Minute
+	t.Cleanup(func() { readyTickAge = previousAge })
+
+	now := time.Now()
+
+	tests := []struct {
+		name         string
+		githubStatus int
+		tickAt       time.Time
+		updatesAt    time.Time
+		wantCode     int
+		wantChecks   map[string]string
+	}{
+		{"ok", http.StatusOK, now, now, http.StatusOK,
+			map[string]string{"database": "ok", "telegram": "ok", "github": "ok", "cron": "ok"}},
+		{"github outage", http.StatusBadGateway, now, now, http.StatusOK,
+			map[string]string{"database": "ok", "telegram": "ok", "github": "warn", "cron": "ok"}},
+		{"stale tick", http.StatusOK, now.Add(-time.Hour), now, http.StatusServiceUnavailable,
+			map[string]string{"database": "ok", "telegram": "ok", "github": "ok", "cron": "fail"}},
+		{"no telegram updates", http.StatusOK, now, now.Add(-time.Hour), http.StatusServiceUnavailable,
+			map[string]string{"database": "ok", "telegram": "fail", "github": "ok", "cron": "ok"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests []string
+			useTestDB(t)
+			useTestGithub(t, tt.githubStatus, &requests)
+			useTestPoller(t, tt.tickAt)
+			githubHealth = githubPing{}
+
+			rec := httptest.NewRecorder()
+			readyHandler(func() time.Time { return tt.updatesAt })(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+			if rec.Code != tt.wantCode {
+				t.Errorf("status %d, want %d", rec.Code, tt.wantCode)
+			}
+
+			var health Health
+			if err := json.NewDecoder(rec.Body).Decode(&health); err != nil {
+				t.Fatal(err)
+			}
+			for name, want := range tt.wantChecks {
+				if check := health.Checks[name]; check == nil || check.Status != want {
+					t.Errorf("check %s = %+v, want %s", name, check, want)
+				}
+			}
+
+			wantStatus := "ok"
+			if tt.wantCode != http.StatusOK {
+				wantStatus = "fail"
+			}
+			if health.Status != wantStatus {
+				t.Errorf("status %q, want %q", health.Status, wantStatus)
+			}
+		})
+	}
+}
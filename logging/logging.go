@@ -0,0 +1,205 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// Field names attached to log records through context
+const (
+	KeyTelegramUser    = "telegram_user"
+	KeyChat            = "chat"
+	KeyCommand         = "command"
+	KeyRepo            = "repo"
+	KeyJob             = "job"
+	KeyJobID           = "job_id"
+	KeyGithubRequestID = "github_request_id"
+	KeyError           = "err"
+)
+
+// Redacted replaces secrets in log output
+const Redacted = "[redacted]"
+
+var secrets = []struct {
+	re          *regexp.Regexp
+	replacement string
+}{
+	// github tokens, tokens issued by the bot have the gho_ prefix
+	{regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{20,}|github_pat_[A-Za-z0-9_]{20,})\b`), Redacted},
+	// legacy 40 hex char tokens only in authorization headers, bare ones
+	// are commit shas
+	{regexp.MustCompile(`(?i)\b((?:token|bearer)\s+)[A-Za-z0-9_.-]{20,}`), "${1}" + Redacted},
+	// telegram bot tokens, also inside api urls as bot<token>
+	{regexp.MustCompile(`\b(?:bot)?\d{6,}:[A-Za-z0-9_-]{30,}\b`), Redacted},
+	// oauth codes, client secrets and tokens in query strings
+	{regexp.MustCompile(`(?i)\b((?:client_secret|access_token|code)=)[^&\s"]+`), "${1}" + Redacted},
+}
+
+// Redact removes access tokens from text
+func Redact(text string) string {
+	for _, secret := range secrets {
+		text = secret.re.ReplaceAllString(text, secret.replacement)
+	}
+
+	return text
+}
+
+// ParseLevel accepts debug, info, warn and error
+func ParseLevel(level string) (slog.Level, error) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return l, fmt.Errorf("wrong log level %q, use debug, info, warn or error", level)
+	}
+
+	return l, nil
+}
+
+// New returns a logger writing text or json records at level and above,
+// secrets are redacted and fields from context are attached
+func New(w io.Writer, level, format string) (*slog.Logger, error) {
+	l, err := ParseLevel(level)
+	if err != nil {
+		return nil, err
+	}
+
+	options := &slog.HandlerOptions{Level: l}
+
+	var h slog.Handler
+	switch strings.ToLower(format) {
+	case "", "text":
+		h = slog.NewTextHandler(w, options)
+	case "json":
+		h = slog.NewJSONHandler(w, options)
+	default:
+		return nil, fmt.Errorf("wrong log format %q, use text or json", format)
+	}
+
+	return slog.New(&handler{inner: h}), nil
+}
+
+// Setup makes a logger from New the default one, the standard log package
+// writes through it too
+func Setup(w io.Writer, level, format string) error {
+	logger, err := New(w, level, format)
+	if err != nil {
+		return err
+	}
+
+	slog.SetDefault(logger)
+
+	return nil
+}
+
+// StdLogger returns a standard library logger writing through the default
+// logger at level, for libraries that log with log.Printf
+func StdLogger(level slog.Level) *log.Logger {
+	return slog.NewLogLogger(slog.Default().Handler(), level)
+}
+
+type ctxKey struct{}
+
+// With returns a context carrying fields added to every record logged
+// with it, args are key value pairs like in slog
+func With(ctx context.Context, args ...any) context.Context {
+	attrs := append(Attrs(ctx), argsToAttrs(args)...)
+
+	return context.WithValue(ctx, ctxKey{}, attrs)
+}
+
+// Attrs returns fields carried by ctx
+func Attrs(ctx context.Context) []slog.Attr {
+	if ctx == nil {
+		return nil
+	}
+
+	attrs, _ := ctx.Value(ctxKey{}).([]slog.Attr)
+
+	// copy so appends of different contexts don't share the array
+	return append([]slog.Attr(nil), attrs...)
+}
+
+func argsToAttrs(args []any) []slog.Attr {
+	var r slog.Record
+	r.Add(args...)
+
+	attrs := make([]slog.Attr, 0, r.NumAttrs())
+	r.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, a)
+		return true
+	})
+
+	return attrs
+}
+
+// Err is the attribute of an error
+func Err(err error) slog.Attr {
+	return slog.Any(KeyError, err)
+}
+
+// handler adds context fields and redacts secrets
+type handler struct {
+	inner slog.Handler
+}
+
+func (h *handler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.inner.Enabled(ctx, level)
+}
+
+func (h *handler) Handle(ctx context.Context, record slog.Record) error {
+	r := slog.NewRecord(record.Time, record.Level, Redact(record.Message), record.PC)
+
+	for _, a := range Attrs(ctx) {
+		r.AddAttrs(redactAttr(a))
+	}
+	record.Attrs(func(a slog.Attr) bool {
+		r.AddAttrs(redactAttr(a))
+		return true
+	})
+
+	return h.inner.Handle(ctx, r)
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redacted := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		redacted[i] = redactAttr(a)
+	}
+
+	return &handler{inner: h.inner.WithAttrs(redacted)}
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	return &handler{inner: h.inner.WithGroup(name)}
+}
+
+func redactAttr(a slog.Attr) slog.Attr {
+	v := a.Value.Resolve()
+
+	switch v.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, Redact(v.String()))
+	case slog.KindGroup:
+		group := v.Group()
+		attrs := make([]any, len(group))
+		for i, item := range group {
+			attrs[i] = redactAttr(item)
+		}
+		return slog.Group(a.Key, attrs...)
+	case slog.KindAny:
+		switch value := v.Any().(type) {
+		case error:
+			return slog.String(a.Key, Redact(value.Error()))
+		case fmt.Stringer:
+			return slog.String(a.Key, Redact(value.String()))
+		case []byte:
+			return slog.String(a.Key, Redact(string(value)))
+		}
+	}
+
+	return slog.Attr{Key: a.Key, Value: v}
+}
@@ -0,0 +1,66 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	const (
+		hex      = "0123456789abcdef0123456789abcdef01234567"
+		botToken = "123456789:AAHdqTcvCH1vGWJxfSeofSAs0K5PALDsaw"
+	)
+
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"personal token", "token ghp_" + strings.Repeat("a", 36), "token " + Redacted},
+		{"oauth token", "got gho_" + strings.Repeat("B1", 18) + " back", "got " + Redacted + " back"},
+		{"fine grained token", "github_pat_11ABCDEFG0_" + strings.Repeat("x", 40), Redacted},
+		{"bot token", "bot " + botToken + " started", "bot " + Redacted + " started"},
+		{"bot token in url", "https://api.telegram.org/bot" + botToken + "/getUpdates", "https://api.telegram.org/" + Redacted + "/getUpdates"},
+		{"token header", "Authorization: token " + hex, "Authorization: token " + Redacted},
+		{"bearer header", "Authorization: Bearer " + hex, "Authorization: Bearer " + Redacted},
+		{"client secret", "client_id=abc&client_secret=s3cr3t&code=c0de", "client_id=abc&client_secret=" + Redacted + "&code=" + Redacted},
+		{"access token query", `"?access_token=abc123"`, `"?access_token=` + Redacted + `"`},
+		{"commit sha", "commit " + hex + " pushed", "commit " + hex + " pushed"},
+		{"short token word", "token expired", "token expired"},
+		{"github prefix in words", "ghp_short and gho_", "ghp_short and gho_"},
+		{"chat id", "chat -1001234567890 joined", "chat -1001234567890 joined"},
+		{"code word", "source code=", "source code="},
+	}
+
+	for _, tt := range tests {
+		if got := Redact(tt.in); got != tt.want {
+			t.Errorf("%s: Redact(%q) = %q, want %q", tt.name, tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestHandlerRedactsAttrs(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, "info", "text")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	secret := "ghp_" + strings.Repeat("a", 36)
+	ctx := With(context.Background(), KeyRepo, "octo/repo")
+	logger.With("header", "token "+secret).InfoContext(ctx, "sent "+secret,
+		Err(errors.New("bad credentials "+secret)),
+		slog.Group("request", "url", "https://api.github.com/?access_token="+secret))
+
+	out := buf.String()
+	if strings.Contains(out, secret) {
+		t.Errorf("log record %q contains the token", out)
+	}
+	if !strings.Contains(out, "repo=octo/repo") {
+		t.Errorf("log record %q has no context fields", out)
+	}
+}
@@ -1,19 +1,25 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"flag"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
-	"regexp"
 	"strconv"
 	"time"
 
 	database "github.com/ad/go-githublistener/db"
 	ghapi "github.com/ad/go-githublistener/ghapi"
+	logging "github.com/ad/go-githublistener/logging"
+	metrics "github.com/ad/go-githublistener/metrics"
+	poller "github.com/ad/go-githublistener/poller"
 	telegram "github.com/ad/go-githublistener/telegram"
+	templates "github.com/ad/go-githublistener/templates"
+	tracing "github.com/ad/go-githublistener/tracing"
 
-	dlog "github.com/amoghe/distillog"
 	sql "github.com/lazada/sqle"
 	cron "github.com/robfig/cron/v3"
 	tgbotapi "gopkg.in/telegram-bot-api.v4"
@@ -24,10 +30,14 @@ const version = "0.0.4"
 var (
 	err error
 
-	bot    *tgbotapi.BotAPI
+	bot    *telegram.Bot
 	db     *sql.DB
 	client *ghapi.Client
 
+	repoPoller *poller.Poller
+
+	notifications *templates.Set
+
 	clientID     string
 	clientSecret string
 
@@ -41,38 +51,87 @@ var (
 	telegramProxyPassword string
 	telegramDebug         bool
 
+	callbackSecret string
+	parseMode      string
+	templatesFile  string
+
 	checkReposEvery   string
 	checkCommitsEvery string
+
+	commandsPerMinute int
+
+	adminIDs string
+
+	syncWatching bool
+
+	logMessages       bool
+	messagesRetention time.Duration
+
+	readyTickAge    time.Duration
+	healthcheckMode bool
+
+	configPath      string
+	printConfigMode bool
+
+	logLevel  string
+	logFormat string
+
+	metricsAddr   string
+	metricsLabels bool
 )
 
 func main() {
-	dlog.Infof("Started version %s", version)
+	registerFlags(flag.CommandLine)
+	flag.Parse()
+
+	sources, err := loadConfig(flag.CommandLine, configPath)
+	if err != nil {
+		configError(err)
+	}
 
-	flag.StringVar(&clientID, "client_id", lookupEnvOrString("GO_GITHUB_LISTENER_CLIENT_ID", clientID), "github client id")
-	flag.StringVar(&clientSecret, "client_secret", lookupEnvOrString("GO_GITHUB_LISTENER_CLIENT_SECRET", clientSecret), "github client secret")
+	if healthcheckMode {
+		os.Exit(healthcheck(httpPort))
+	}
 
-	flag.IntVar(&httpPort, "http_port", lookupEnvOrInt("GO_GITHUB_LISTENER_PORT", 8080), "bot http port")
-	flag.StringVar(&httpRedirectURI, "http_redirect_uri", lookupEnvOrString("GO_GITHUB_LISTENER_HTTP_REDIRECT_URI", "http://localhost:8080/oauth/redirect"), "http redirect uri")
+	if printConfigMode {
+		if err := printConfig(os.Stdout, flag.CommandLine, sources); err != nil {
+			configError(err)
+		}
+	}
 
-	flag.StringVar(&telegramToken, "telegram_token", lookupEnvOrString("GO_GITHUB_LISTENER_TELEGRAM_TOKEN", telegramToken), "telegramToken")
-	flag.StringVar(&telegramProxyHost, "telegram_proxy_host", lookupEnvOrString("GO_GITHUB_LISTENER_TELEGRAM_PROXY_HOST", telegramProxyHost), "telegramProxyHost")
-	flag.StringVar(&telegramProxyPort, "telegram_proxy_port", lookupEnvOrString("GO_GITHUB_LISTENER_TELEGRAM_PROXY_PORT", telegramProxyPort), "telegramProxyPort")
-	flag.StringVar(&telegramProxyUser, "telegram_proxy_user", lookupEnvOrString("GO_GITHUB_LISTENER_TELEGRAM_PROXY_USER", telegramProxyUser), "telegramProxyUser")
-	flag.StringVar(&telegramProxyPassword, "telegram_proxy_password", lookupEnvOrString("GO_GITHUB_LISTENER_TELEGRAM_PROXY_PASSWORD", telegramProxyPassword), "telegramProxyPassword")
-	flag.BoolVar(&telegramDebug, "telegram_debug", lookupEnvOrBool("GO_GITHUB_LISTENER_TELEGRAM_DEBUG", telegramDebug), "telegramDebug")
+	if err := validateConfig(); err != nil {
+		configError(err)
+	}
 
-	flag.StringVar(&checkReposEvery, "check_repos_every", lookupEnvOrString("GO_GITHUB_LISTENER_CHECK_REPOS_EVERY", "*/15 * * * *"), "run cron job for check repos every")
-	flag.StringVar(&checkCommitsEvery, "check_commits_every", lookupEnvOrString("GO_GITHUB_LISTENER_CHECK_COMMITS_EVERY", "* * * * *"), "run cron job for check commits every")
+	if printConfigMode {
+		os.Exit(0)
+	}
 
-	flag.Parse()
-	log.SetFlags(0)
+	if err := logging.Setup(os.Stderr, logLevel, logFormat); err != nil {
+		fatal("wrong logging settings", err)
+	}
+	if err := tgbotapi.SetLogger(logging.StdLogger(slog.LevelInfo)); err != nil {
+		fatal("failed to set telegram logger", err)
+	}
+
+	tracingConfig, err := tracing.ConfigFromEnv("go-githublistener", version)
+	if err != nil {
+		fatal("wrong tracing settings", err)
+	}
+	tracing.Setup(tracingConfig)
+
+	slog.Info("started", "version", version, "tracing", tracingConfig.Endpoint != "")
+
+	if callbackSecret == "" {
+		callbackSecret = telegramToken
+	}
 
 	client = ghapi.NewClient(clientID, clientSecret)
 
 	// Init DB
 	db, err = database.InitDB()
 	if err != nil {
-		log.Fatalf("failed to open database: %v", err)
+		fatal("failed to open database", err)
 		return
 	}
 	defer func() { _ = db.Close() }()
@@ -80,31 +139,67 @@ func main() {
 	// Init telegram
 	bot, err = telegram.InitTelegram(telegramToken, telegramProxyHost, telegramProxyPort, telegramProxyUser, telegramProxyPassword, telegramDebug)
 	if err != nil {
-		log.Fatalf("fail on telegram login: %v", err)
+		fatal("fail on telegram login", err)
+	}
+
+	mode, err := telegram.ParseMode(parseMode)
+	if err != nil {
+		fatal("wrong parse mode", err)
+	}
+	bot.Renderer = telegram.Renderer{Mode: mode}
+
+	notifications, err = templates.Load(templatesFile, bot.Renderer)
+	if err != nil {
+		fatal("failed to load templates", err)
 	}
 
 	u := tgbotapi.NewUpdate(0)
 	u.Timeout = 60
 	updates, err := bot.GetUpdatesChan(u)
 	if err != nil {
-		log.Fatalf("[INIT] [Failed to init Telegram updates chan: %v]", err)
+		fatal("failed to init telegram updates", err)
 	}
 
-	go processTelegramMessages(updates)
+	router := telegram.NewRouter(bot)
+	router.Use(
+		telegram.Recover(),
+		telegram.Logging(),
+		telegram.Banned(db),
+		telegram.RateLimit(commandsPerMinute, time.Minute),
+		telegram.UserLookup(db),
+	)
+	router.Signer = telegram.NewSigner(callbackSecret)
+	router.Admins, err = parseAdmins(adminIDs)
+	if err != nil {
+		fatal("wrong admins", err)
+	}
+	registerCommands(router)
+	registerCallbacks(router)
+	registerAdminCommands(router)
 
-	http.HandleFunc("/oauth/redirect", func(w http.ResponseWriter, r *http.Request) {
-		// dlog.Debugf("parse query: %#v", r)
+	if err := router.RegisterCommands(); err != nil {
+		slog.Error("failed to register commands", logging.Err(err))
+	}
 
+	repoPoller = poller.New(db, client, bot)
+	repoPoller.Signer = router.Signer
+	repoPoller.Renderer = bot.Renderer
+	repoPoller.Templates = notifications
+	repoPoller.RepoLabels = metricsLabels
+
+	go processTelegramMessages(updates, router)
+
+	http.HandleFunc("/oauth/redirect", func(w http.ResponseWriter, r *http.Request) {
 		err12 := r.ParseForm()
 		if err12 != nil {
-			dlog.Errorf("could not parse query: %v", err12)
+			slog.Error("could not parse oauth redirect", logging.Err(err12))
 			w.WriteHeader(http.StatusBadRequest)
 		}
 		code := r.FormValue("code")
 
-		token, err13 := client.GetGithubUserAccessToken(code)
+		token, err13 := client.GetGithubUserAccessToken(r.Context(), code)
 		if err13 != nil {
-			dlog.Errorln(err13)
+			slog.Error("failed to get github access token", logging.Err(err13))
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
@@ -114,317 +209,228 @@ func main() {
 		w.WriteHeader(http.StatusFound)
 	})
 
-	dlog.Debugf("Listening on port %d", httpPort)
+	registerHealthHandlers()
+
+	if metricsLabels {
+		metrics.NewGaugeFunc("githublistener_github_rate_limit_remaining", "GitHub API requests left for the token of a user.", "user", rateLimits)
+	} else {
+		metrics.NewGaugeFunc("githublistener_github_rate_limit_remaining", "GitHub API requests left for the token with the least quota.", "", lowestRateLimit)
+	}
+
+	// metrics are served apart from the public oauth redirect
+	if metricsAddr != "" {
+		go func() {
+			mux := http.NewServeMux()
+			mux.Handle("/metrics", metrics.Handler())
+			fatal("metrics server stopped", http.ListenAndServe(metricsAddr, mux))
+		}()
+	}
+
+	slog.Debug("listening", "port", httpPort)
+
+	p := repoPoller
 
 	cron := cron.New()
-	_, err = cron.AddFunc(checkCommitsEvery, func() {
-		// ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cronDisableTimeout)*time.Second)
-		// defer cancel()
-
-		dlog.Debugln("started check commits cron job")
-
-		if usersRepos, err14 := database.GetUserRepos(db); err14 != nil {
-			dlog.Errorln(err14)
-		} else if len(usersRepos) > 0 {
-			for _, item := range usersRepos {
-				telegramUserID, err15 := strconv.ParseInt(item.TelegramUserID, 10, 64)
-				if err15 != nil {
-					dlog.Errorln(err15)
-					continue
-				}
-				// dlog.Infof("ITEM in:  %#v %s", item, item.UpdatedAt.String())
-				go func(item *database.UsersReposResult) {
-					commits, err16 := client.GetGithubUserRepoCommits(item)
-					if err16 != nil {
-						dlog.Errorln(err16)
-						if err16.Error() == "repo not found" {
-							if errDeleteRepo := database.DeleteRepoUserLinkDB(db, &database.GithubUser{ID: item.UserID}, &database.GithubRepo{ID: item.RepoID}); err == nil {
-								dlog.Infof("%s %s %d", item.RepoName, "removed for", item.UserID)
-								msg := tgbotapi.NewMessage(telegramUserID, "repo "+item.RepoName+" not found, removed")
-								_, err9 := bot.Send(msg)
-								if err9 != nil {
-									dlog.Errorln(err9)
-								}
-							} else {
-								dlog.Errorln(errDeleteRepo)
-							}
-						}
-						return
-					}
-
-					if len(commits) > 0 {
-						// dlog.Debugf("ITEM in:  %#v %s", item, item.UpdatedAt.String())
-						// dlog.Infof("%#v", commits)
-
-						for _, commit := range commits {
-							if commit.Commit.Author.Date.After(item.UpdatedAt) {
-								item.UpdatedAt = commit.Commit.Author.Date
-							}
-
-							if commit.Commit.Committer.Date.After(item.UpdatedAt) {
-								item.UpdatedAt = commit.Commit.Committer.Date
-							}
-
-							msg := tgbotapi.NewMessage(telegramUserID, "")
-							msg.ParseMode = "Markdown"
-							msg.DisableWebPagePreview = true
-							msg.Text += "[" + item.RepoName + "](https://github.com/" + item.RepoName + ") was updated by [" + commit.Commit.Author.Name + "](https://github.com/" + commit.Commit.Author.Name + ") with new commit([" + commit.SHA + "](" + commit.HTMLUrl + ")):\n" + commit.Commit.Message
-							_, err17 := bot.Send(msg)
-							if err17 != nil {
-								dlog.Errorln(err17)
-							}
-						}
-
-						// dlog.Debugf("ITEM out: %#v %s", item, item.UpdatedAt.String())
-						err18 := database.UpdateUserRepoLink(db, item)
-						if err18 != nil {
-							dlog.Errorln(err18)
-						}
-					}
-				}(item)
-			}
-		}
-	})
+	_, err = cron.AddFunc(checkCommitsEvery, job("check_commits", p.Tick))
 	if err != nil {
-		dlog.Errorf("wrong cronjob params: %s", err)
+		slog.Error("wrong cronjob params", logging.KeyJob, "check_commits", logging.Err(err))
+	}
+	_, err2 := cron.AddFunc(checkReposEvery, job("check_repos", p.SyncRepos))
+	if err2 != nil {
+		slog.Error("wrong cronjob params", logging.KeyJob, "check_repos", logging.Err(err2))
+	}
+	_, err3 := cron.AddFunc("* * * * *", job("digest", p.Digest))
+	if err3 != nil {
+		slog.Error("wrong cronjob params", logging.KeyJob, "digest", logging.Err(err3))
 	}
-	_, err2 := cron.AddFunc(checkReposEvery, func() {
-		dlog.Debugln("started check repos cron job")
-
-		if users, err14 := database.GetUsers(db); err14 != nil {
-			dlog.Errorln(err14)
-		} else if len(users) > 0 {
-			for _, ghuser := range users {
-				if repos, err6 := client.GetGithubUserRepos(ghuser.Token, ghuser.UserName); err6 == nil {
-					for _, repo := range repos {
-
-						ghrepo := &database.GithubRepo{
-							Name:     repo.Name,
-							RepoName: repo.FullName,
-						}
-
-						if dbrepo, err7 := database.AddRepoIfNotExist(db, ghrepo); err7 != nil && err7.Error() != database.AlreadyExists {
-							dlog.Errorln(err7)
-						} else if err8 := database.AddRepoLinkIfNotExist(db, ghuser, dbrepo, repo.UpdatedAt); err8 != nil && err8.Error() != database.AlreadyExists {
-							dlog.Errorln(err8)
-						}
-					}
-				} else {
-					dlog.Errorln(err6)
-				}
+	if messagesRetention > 0 {
+		_, err4 := cron.AddFunc("0 * * * *", job("messages_cleanup", func(ctx context.Context) error {
+			n, err14 := database.DeleteTelegramMessages(db, time.Now().Add(-messagesRetention))
+			if n > 0 {
+				slog.InfoContext(ctx, "old messages deleted", "count", n, "retention", messagesRetention)
 			}
+			return err14
+		}))
+		if err4 != nil {
+			slog.Error("wrong cronjob params", logging.KeyJob, "messages_cleanup", logging.Err(err4))
 		}
-	})
-	if err2 != nil {
-		dlog.Errorf("wrong cronjob params: %s", err2)
 	}
+
 	cron.Start()
 	defer cron.Stop()
 
-	log.Fatal(http.ListenAndServe("0.0.0.0:"+strconv.Itoa(httpPort), nil))
+	fatal("http server stopped", http.ListenAndServe("0.0.0.0:"+strconv.Itoa(httpPort), nil))
 }
 
-func processTelegramMessages(updates tgbotapi.UpdatesChannel) {
-	for update := range updates {
-		if update.Message == nil { // ignore any non-Message Updates
-			continue
-		}
+// registerFlags binds every setting to fs
+func registerFlags(fs *flag.FlagSet) {
+	fs.StringVar(&clientID, "client_id", "", "github client id")
+	fs.StringVar(&clientSecret, "client_secret", "", "github client secret")
 
-		dlog.Infof("%s [%d] %s", update.Message.From.UserName, update.Message.From.ID, update.Message.Text)
+	fs.IntVar(&httpPort, "http_port", 8080, "bot http port")
+	fs.StringVar(&httpRedirectURI, "http_redirect_uri", "http://localhost:8080/oauth/redirect", "http redirect uri")
 
-		message := database.TelegramMessage{
-			UserID:   update.Message.From.ID,
-			UserName: update.Message.From.UserName,
-			Message:  update.Message.Text,
-			Date:     time.Unix(int64(update.Message.Date), 0),
-		}
+	fs.StringVar(&telegramToken, "telegram_token", "", "telegramToken")
+	fs.StringVar(&telegramProxyHost, "telegram_proxy_host", "", "telegramProxyHost")
+	fs.StringVar(&telegramProxyPort, "telegram_proxy_port", "", "telegramProxyPort")
+	fs.StringVar(&telegramProxyUser, "telegram_proxy_user", "", "telegramProxyUser")
+	fs.StringVar(&telegramProxyPassword, "telegram_proxy_password", "", "telegramProxyPassword")
+	fs.BoolVar(&telegramDebug, "telegram_debug", false, "telegramDebug")
+	fs.StringVar(&parseMode, "telegram_parse_mode", "HTML", "message formatting, HTML or MarkdownV2")
+	fs.StringVar(&templatesFile, "templates_file", "", "file with notification templates overriding built-in ones")
+	fs.StringVar(&callbackSecret, "callback_secret", "", "secret for signing inline buttons, defaults to telegram token")
 
-		err2 := database.StoreTelegramMessage(db, message)
-		if err2 != nil {
-			dlog.Errorf("%s", err2)
-		}
+	fs.StringVar(&checkReposEvery, "check_repos_every", "*/15 * * * *", "run cron job for check repos every")
+	fs.StringVar(&checkCommitsEvery, "check_commits_every", "* * * * *", "run cron job for check commits every")
 
-		if update.Message.IsCommand() {
-			msg := tgbotapi.NewMessage(update.Message.Chat.ID, "")
-			switch update.Message.Command() {
-			case "start", "startgroup", "repos":
-				ghuser := &database.GithubUser{
-					TelegramUserID: strconv.Itoa(update.Message.From.ID),
-				}
-
-				if update.Message.Command() != "repos" && update.Message.CommandArguments() != "" {
-					if user, err3 := client.GetGithubUser(update.Message.CommandArguments()); err3 == nil {
-						if user.Name != "" {
-							msg.Text = "Hi, " + user.Name
-						} else {
-							msg.Text = "Hi, " + user.UserName
-						}
-
-						ghuser.Name = user.Name
-						ghuser.UserName = user.UserName
-						ghuser.Token = update.Message.CommandArguments()
-
-						dbuser, err4 := database.AddUserIfNotExist(db, ghuser)
-						if err4 != nil && err4.Error() != database.AlreadyExists {
-							msg.Text += "\nError on save your token, try /start again\n" + err4.Error()
-							_, err5 := bot.Send(msg)
-							if err5 != nil {
-								dlog.Errorln(err5)
-							}
-							continue
-						}
-						ghuser.ID = dbuser.ID
-					}
-				} else {
-					if user, err20 := database.GetGithubUserFromDB(db, ghuser.TelegramUserID); err20 == nil {
-						ghuser.ID = user.ID
-						ghuser.Name = user.Name
-						ghuser.UserName = user.UserName
-						ghuser.Token = user.Token
-					}
-				}
-
-				if ghuser.ID != 0 {
-					if repos, err6 := client.GetGithubUserRepos(ghuser.Token, ghuser.UserName); err6 == nil {
-						msg2 := tgbotapi.NewMessage(update.Message.Chat.ID, "You are watching:\n")
-						for _, repo := range repos {
-							msg2.Text += "[" + repo.FullName + "](https://github.com/" + repo.FullName + ") updated at:" + repo.UpdatedAt.Format("2006-01-02 15:04:05") + "\n"
-
-							ghrepo := &database.GithubRepo{
-								Name:     repo.Name,
-								RepoName: repo.FullName,
-							}
-
-							if dbrepo, err7 := database.AddRepoIfNotExist(db, ghrepo); err7 != nil && err7.Error() != database.AlreadyExists {
-								dlog.Errorln(err7)
-							} else if err8 := database.AddRepoLinkIfNotExist(db, ghuser, dbrepo, repo.UpdatedAt); err8 != nil && err8.Error() != database.AlreadyExists {
-								dlog.Errorln(err8)
-							}
-						}
-						msg2.ParseMode = "Markdown"
-						msg2.DisableWebPagePreview = true
-						_, err9 := bot.Send(msg2)
-						if err9 != nil {
-							dlog.Errorln(err9)
-						}
-
-						continue
-					} else {
-						dlog.Errorln(err6)
-					}
-				}
-
-				text := `[Click here to authorize bot in github](https://github.com/login/oauth/authorize?client_id=` + clientID + `&redirect_uri=` + httpRedirectURI + `), and then press START again`
-				msg.ParseMode = "Markdown"
-				msg.Text = text
-				msg.DisableWebPagePreview = true
-			case "me":
-				if user, err10 := database.GetGithubUserFromDB(db, strconv.Itoa(update.Message.From.ID)); err10 == nil {
-					if user.Name != "" {
-						msg.Text = "Hi, " + user.Name
-					} else {
-						msg.Text = "Hi, " + user.UserName
-					}
-				} else {
-					msg.Text = "type /start\n"
-					msg.Text += err10.Error()
-				}
-			case "delete":
-				if checkRepoName(update.Message.CommandArguments()) {
-					if ghuser, err10 := database.GetGithubUserFromDB(db, strconv.Itoa(update.Message.From.ID)); err10 == nil {
-						if ghrepo, errGetRepo := database.GetGithubRepoByNameFromDB(db, update.Message.CommandArguments()); errGetRepo == nil {
-							if errDeleteRepo := database.DeleteRepoUserLinkDB(db, ghuser, ghrepo); err == nil {
-								dlog.Infof("%s %s %s", ghuser.Name, "removed", ghrepo.RepoName)
-								msg.Text = ghrepo.RepoName + " removed, uncheck Watching in Github interface"
-							} else {
-								msg.Text += errDeleteRepo.Error()
-							}
-						} else {
-							msg.Text = errGetRepo.Error()
-						}
-					} else {
-						msg.Text = "type /start\n"
-						msg.Text += err10.Error()
-					}
-				} else {
-					msg.Text = "wrong repo format, try username/reponame instead"
-				}
-			case "add":
-				if checkRepoName(update.Message.CommandArguments()) {
-					if ghuser, err10 := database.GetGithubUserFromDB(db, strconv.Itoa(update.Message.From.ID)); err10 == nil {
-						if ghrepo, errCheckRepo := database.GetGithubRepoByNameFromDB(db, update.Message.CommandArguments()); errCheckRepo == nil {
-							if err8 := database.AddRepoLinkIfNotExist(db, ghuser, ghrepo, time.Now()); err8 != nil && err8.Error() != database.AlreadyExists {
-								dlog.Errorln(err8)
-							} else {
-								msg.Text = ghrepo.RepoName + " added"
-							}
-						} else {
-							if repo, errGetRepo := client.GetGithubRepo(ghuser.Token, update.Message.CommandArguments()); errGetRepo == nil {
-								ghrepo := &database.GithubRepo{
-									Name:     repo.Name,
-									RepoName: repo.FullName,
-								}
-								if dbrepo, err7 := database.AddRepoIfNotExist(db, ghrepo); err7 != nil && err7.Error() != database.AlreadyExists {
-									dlog.Errorln(err7)
-								} else if err8 := database.AddRepoLinkIfNotExist(db, ghuser, dbrepo, repo.UpdatedAt); err8 != nil && err8.Error() != database.AlreadyExists {
-									dlog.Errorln(err8)
-								} else {
-									msg.Text = ghrepo.RepoName + " added"
-								}
-							} else {
-								msg.Text = ghrepo.RepoName + " not found"
-							}
-						}
-					} else {
-						msg.Text = "type /start\n"
-						msg.Text += err10.Error()
-					}
-				} else {
-					msg.Text = "wrong repo format, try username/reponame instead"
-				}
-			case "help":
-				msg.Text = "type /start"
-			default:
-				msg.Text = "I don't know that command"
-			}
-			msg.ReplyToMessageID = update.Message.MessageID
-			_, err11 := bot.Send(msg)
-			if err11 != nil {
-				dlog.Errorln(err11)
-			}
+	fs.BoolVar(&syncWatching, "sync_watching", false, "watch and unwatch repos on github on /add and /delete")
+
+	fs.StringVar(&adminIDs, "admins", "", "comma separated telegram ids of bot operators")
+
+	fs.BoolVar(&logMessages, "log_messages", true, "store messages sent to the bot, secrets are redacted")
+	fs.DurationVar(&messagesRetention, "messages_retention", 30*24*time.Hour, "delete stored messages older than this, 0 keeps them")
+
+	fs.IntVar(&commandsPerMinute, "commands_per_minute", 20, "max bot commands per user per minute")
+
+	fs.DurationVar(&readyTickAge, "ready_tick_age", 10*time.Minute, "/readyz fails when check commits job has not finished for this long")
+	fs.BoolVar(&healthcheckMode, "healthcheck", false, "check /healthz of a running instance and exit")
+
+	fs.StringVar(&logLevel, "log_level", "info", "log level, debug, info, warn or error")
+	fs.StringVar(&logFormat, "log_format", "text", "log format, text or json")
+
+	fs.StringVar(&metricsAddr, "metrics_addr", "127.0.0.1:9090", "listen address of /metrics, empty disables it")
+	fs.BoolVar(&metricsLabels, "metrics_labels", false, "label metrics with github logins and repo names, private repos included")
+
+	fs.StringVar(&configPath, "config", os.Getenv(configEnv), "YAML config file with settings named like flags, env and flags override it")
+	fs.BoolVar(&printConfigMode, "print-config", false, "print effective settings with secrets masked and exit")
+}
+
+// fatal logs err, flushes spans and exits
+func fatal(msg string, err error) {
+	slog.Error(msg, logging.Err(err))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	_ = tracing.Shutdown(ctx)
+	cancel()
+
+	os.Exit(1)
+}
+
+// job wraps a cron job logging its error and recording metrics, records
+// logged during a run carry the job name and a run id, each run is the
+// root span of a trace
+func job(name string, fn func(context.Context) error) func() {
+	return func() {
+		ctx := logging.With(context.Background(), logging.KeyJob, name, logging.KeyJobID, jobID())
+		ctx, span := tracing.Start(ctx, "job "+name, tracing.String("job", name))
+		defer span.End()
+
+		start := time.Now()
+		err := fn(ctx)
+		metrics.JobDuration.Since(start, name)
+		span.SetError(err)
+
+		if err != nil {
+			metrics.JobErrors.Inc(name)
+			slog.ErrorContext(ctx, "job failed", "duration", time.Since(start), logging.Err(err))
+			return
 		}
+
+		slog.DebugContext(ctx, "job done", "duration", time.Since(start))
 	}
 }
 
-func checkRepoName(s string) bool {
-	re := regexp.MustCompile(`^([\w,\-,\_]+)\/([\w,\-,\_]+)$`)
-	return re.Match([]byte(s))
+// jobID returns a random id of a job run
+func jobID() string {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+
+	return hex.EncodeToString(b)
 }
 
-func lookupEnvOrString(key string, defaultVal string) string {
-	if val, ok := os.LookupEnv(key); ok {
-		return val
+// rateLimits returns remaining github api quota by login of the token owner
+func rateLimits() map[string]float64 {
+	limits := client.RateLimits()
+	if len(limits) == 0 {
+		return nil
 	}
-	return defaultVal
+
+	users, err := database.GetUsers(context.Background(), db)
+	if err != nil {
+		slog.Error("failed to get users", logging.Err(err))
+		return nil
+	}
+
+	remaining := make(map[string]float64)
+	for _, user := range users {
+		if limit, ok := limits[user.Token]; ok {
+			remaining[user.UserName] = float64(limit.Remaining)
+		}
+	}
+
+	return remaining
 }
 
-func lookupEnvOrInt(key string, defaultVal int) int {
-	if val, ok := os.LookupEnv(key); ok {
-		if x, err := strconv.Atoi(val); err == nil {
-			return x
+// lowestRateLimit returns the smallest remaining github api quota of all
+// tokens
+func lowestRateLimit() map[string]float64 {
+	limits := client.RateLimits()
+	if len(limits) == 0 {
+		return nil
+	}
+
+	lowest := -1
+	for _, limit := range limits {
+		if lowest < 0 || limit.Remaining < lowest {
+			lowest = limit.Remaining
 		}
 	}
-	return defaultVal
+
+	return map[string]float64{"": float64(lowest)}
 }
 
-func lookupEnvOrBool(key string, defaultVal bool) bool {
-	if val, ok := os.LookupEnv(key); ok {
-		if val == "true" {
-			return true
+func processTelegramMessages(updates tgbotapi.UpdatesChannel, router *telegram.Router) {
+	for update := range updates {
+		if update.CallbackQuery != nil {
+			router.Dispatch(update)
+			continue
 		}
-		if val == "false" {
-			return false
+
+		if update.Message == nil { // ignore any other non-Message Updates
+			continue
 		}
+
+		if update.Message.MigrateToChatID != 0 {
+			if err := database.MigrateChat(db, update.Message.Chat.ID, update.Message.MigrateToChatID); err != nil {
+				slog.Error("failed to migrate chat", logging.KeyChat, update.Message.Chat.ID, logging.Err(err))
+			}
+			continue
+		}
+
+		if update.Message.From == nil {
+			continue
+		}
+
+		text := telegram.Redact(update.Message.Text)
+
+		slog.Info("message", logging.KeyTelegramUser, update.Message.From.ID, "user_name", update.Message.From.UserName, "text", text)
+
+		if logMessages {
+			message := database.TelegramMessage{
+				UserID:   update.Message.From.ID,
+				UserName: update.Message.From.UserName,
+				Message:  text,
+				Date:     time.Unix(int64(update.Message.Date), 0),
+			}
+
+			err2 := database.StoreTelegramMessage(db, message)
+			if err2 != nil {
+				slog.Error("failed to store message", logging.Err(err2))
+			}
+		}
+
+		router.Dispatch(update)
 	}
-	return defaultVal
 }
@@ -0,0 +1,43 @@
+package metrics
+
+// Metrics of the bot, instrumented packages update them directly
+var (
+	GithubRequests = NewCounterVec("githublistener_github_requests_total",
+		"GitHub API requests by endpoint and response status.", "endpoint", "status")
+	GithubRequestDuration = NewHistogramVec("githublistener_github_request_duration_seconds",
+		"GitHub API request latency by endpoint.", nil, "endpoint")
+
+	JobDuration = NewHistogramVec("githublistener_job_duration_seconds",
+		"Duration of cron jobs.", nil, "job")
+	JobErrors = NewCounterVec("githublistener_job_errors_total",
+		"Cron jobs that returned an error.", "job")
+	PollLag = NewHistogramVec("githublistener_poll_lag_seconds",
+		"Time between two polls of a subscription.", []float64{30, 60, 120, 300, 600, 900, 1200, 1800, 3600, 7200})
+	PollDuration = NewHistogramVec("githublistener_poll_duration_seconds",
+		"Duration of commits requests of subscriptions.", nil)
+	// per repo series are only set with repo labels enabled, names of
+	// private repos would leak otherwise
+	RepoPollLag = NewGaugeVec("githublistener_repo_poll_lag_seconds",
+		"Time between the previous and the latest poll of a subscription to a repo.", "repo")
+	RepoPollDuration = NewGaugeVec("githublistener_repo_poll_duration_seconds",
+		"Duration of the latest commits request of a repo.", "repo")
+	QueueDepth = NewGaugeVec("githublistener_poll_queue_depth",
+		"Subscriptions waiting for a poll worker.")
+
+	Notifications = NewCounterVec("githublistener_notifications_total",
+		"Notifications by reason and result.", "reason", "status")
+	TelegramRequests = NewCounterVec("githublistener_telegram_requests_total",
+		"Telegram API calls by method and result.", "method", "status")
+
+	DBQueryDuration = NewHistogramVec("githublistener_db_query_duration_seconds",
+		"Database query latency.", []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1}, "query")
+)
+
+// Status is the status label of a result
+func Status(err error) string {
+	if err != nil {
+		return "error"
+	}
+
+	return "ok"
+}
@@ -0,0 +1,332 @@
+// Package metrics exposes counters, gauges and histograms in the prometheus
+// text format without pulling the client library in
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultBuckets suit durations in seconds from milliseconds to a minute
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60}
+
+type collector interface {
+	name() string
+	write(w io.Writer)
+}
+
+var (
+	registryMu sync.Mutex
+	registry   = map[string]collector{}
+)
+
+func register(c collector) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if _, ok := registry[c.name()]; ok {
+		panic("metrics: " + c.name() + " registered twice")
+	}
+	registry[c.name()] = c
+}
+
+// Handler serves every registered metric
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		Write(w)
+	})
+}
+
+// Write writes every registered metric sorted by name
+func Write(w io.Writer) {
+	registryMu.Lock()
+	collectors := make([]collector, 0, len(registry))
+	for _, c := range registry {
+		collectors = append(collectors, c)
+	}
+	registryMu.Unlock()
+
+	sort.Slice(collectors, func(i, j int) bool { return collectors[i].name() < collectors[j].name() })
+
+	for _, c := range collectors {
+		c.write(w)
+	}
+}
+
+// desc holds name, help and label names shared by metric kinds
+type desc struct {
+	metric string
+	help   string
+	labels []string
+}
+
+func (d *desc) name() string {
+	return d.metric
+}
+
+func (d *desc) header(w io.Writer, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.metric, d.help, d.metric, kind)
+}
+
+// key joins label values, it panics on a wrong count as that is a bug
+func (d *desc) key(values []string) string {
+	if len(values) != len(d.labels) {
+		panic(fmt.Sprintf("metrics: %s needs %d label values, got %d", d.metric, len(d.labels), len(values)))
+	}
+
+	return strings.Join(values, "\xff")
+}
+
+// pairs formats labels of a key with extra name/value pairs appended
+func (d *desc) pairs(key string, extra ...string) string {
+	var values []string
+	if len(d.labels) > 0 {
+		values = strings.Split(key, "\xff")
+	}
+
+	var parts []string
+	for i, label := range d.labels {
+		parts = append(parts, label+`="`+escape(values[i])+`"`)
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		parts = append(parts, extra[i]+`="`+escape(extra[i+1])+`"`)
+	}
+
+	if len(parts) == 0 {
+		return ""
+	}
+
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func escape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+func format(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func sortedKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// CounterVec counts events by label values
+type CounterVec struct {
+	desc
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+// NewCounterVec registers a counter
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{desc: desc{name, help, labels}, values: map[string]float64{}}
+	register(c)
+
+	return c
+}
+
+// Inc adds one
+func (c *CounterVec) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Add ...
+func (c *CounterVec) Add(v float64, values ...string) {
+	key := c.key(values)
+
+	c.mu.Lock()
+	c.values[key] += v
+	c.mu.Unlock()
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	c.header(w, "counter")
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, key := range sortedKeys(c.values) {
+		fmt.Fprintf(w, "%s%s %s\n", c.metric, c.pairs(key), format(c.values[key]))
+	}
+}
+
+// GaugeVec holds current values by label values
+type GaugeVec struct {
+	desc
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+// NewGaugeVec registers a gauge
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{desc: desc{name, help, labels}, values: map[string]float64{}}
+	register(g)
+
+	return g
+}
+
+// Set ...
+func (g *GaugeVec) Set(v float64, values ...string) {
+	key := g.key(values)
+
+	g.mu.Lock()
+	g.values[key] = v
+	g.mu.Unlock()
+}
+
+// Add ...
+func (g *GaugeVec) Add(v float64, values ...string) {
+	key := g.key(values)
+
+	g.mu.Lock()
+	g.values[key] += v
+	g.mu.Unlock()
+}
+
+// Delete drops the series of label values
+func (g *GaugeVec) Delete(values ...string) {
+	key := g.key(values)
+
+	g.mu.Lock()
+	delete(g.values, key)
+	g.mu.Unlock()
+}
+
+func (g *GaugeVec) write(w io.Writer) {
+	g.header(w, "gauge")
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for _, key := range sortedKeys(g.values) {
+		fmt.Fprintf(w, "%s%s %s\n", g.metric, g.pairs(key), format(g.values[key]))
+	}
+}
+
+// GaugeFunc reads values of a single label when scraped
+type GaugeFunc struct {
+	desc
+	fn func() map[string]float64
+}
+
+// NewGaugeFunc registers a gauge computed by fn, keys of the returned map
+// are values of label. Without a label fn returns a single value keyed by
+// an empty string
+func NewGaugeFunc(name, help, label string, fn func() map[string]float64) *GaugeFunc {
+	var labels []string
+	if label != "" {
+		labels = []string{label}
+	}
+
+	g := &GaugeFunc{desc: desc{name, help, labels}, fn: fn}
+	register(g)
+
+	return g
+}
+
+func (g *GaugeFunc) write(w io.Writer) {
+	g.header(w, "gauge")
+
+	values := g.fn()
+	for _, key := range sortedKeys(values) {
+		fmt.Fprintf(w, "%s%s %s\n", g.metric, g.pairs(key), format(values[key]))
+	}
+}
+
+// HistogramVec counts observations in buckets by label values
+type HistogramVec struct {
+	desc
+	buckets []float64
+	mu      sync.Mutex
+	values  map[string]*histogram
+}
+
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// NewHistogramVec registers a histogram, nil buckets means DefaultBuckets
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+
+	h := &HistogramVec{desc: desc{name, help, labels}, buckets: buckets, values: map[string]*histogram{}}
+	register(h)
+
+	return h
+}
+
+// Observe ...
+func (h *HistogramVec) Observe(v float64, values ...string) {
+	key := h.key(values)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	hist, ok := h.values[key]
+	if !ok {
+		hist = &histogram{counts: make([]uint64, len(h.buckets))}
+		h.values[key] = hist
+	}
+
+	for i, bound := range h.buckets {
+		if v <= bound {
+			hist.counts[i]++
+		}
+	}
+	hist.count++
+	hist.sum += v
+}
+
+// Since observes seconds passed since start
+func (h *HistogramVec) Since(start time.Time, values ...string) {
+	h.Observe(time.Since(start).Seconds(), values...)
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.header(w, "histogram")
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	keys := make([]string, 0, len(h.values))
+	for k := range h.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		hist := h.values[key]
+		for i, bound := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.metric, h.pairs(key, "le", format(bound)), hist.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.metric, h.pairs(key, "le", "+Inf"), hist.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.metric, h.pairs(key), format(hist.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.metric, h.pairs(key), hist.count)
+	}
+}
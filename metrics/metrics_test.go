@@ -0,0 +1,119 @@
+package metrics
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+)
+
+// output returns text of a single collector
+func output(c collector) string {
+	var b bytes.Buffer
+	c.write(&b)
+
+	return b.String()
+}
+
+func TestCounterVec(t *testing.T) {
+	c := NewCounterVec("test_requests_total", "Requests.", "endpoint", "status")
+	c.Inc("/repos/:owner/:repo", "200")
+	c.Add(2, "/repos/:owner/:repo", "200")
+	c.Inc("/user", `5"x\y`+"\n")
+
+	want := `# HELP test_requests_total Requests.
+# TYPE test_requests_total counter
+test_requests_total{endpoint="/repos/:owner/:repo",status="200"} 3
+test_requests_total{endpoint="/user",status="5\"x\\y\n"} 1
+`
+	if got := output(c); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestGaugeVec(t *testing.T) {
+	g := NewGaugeVec("test_queue", "Queue.")
+	g.Set(5)
+	g.Add(-1.5)
+
+	want := "# HELP test_queue Queue.\n# TYPE test_queue gauge\ntest_queue 3.5\n"
+	if got := output(g); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	repos := NewGaugeVec("test_repo_lag", "Lag.", "repo")
+	repos.Set(1, "a/b")
+	repos.Set(2, "c/d")
+	repos.Delete("a/b")
+
+	want = "# HELP test_repo_lag Lag.\n# TYPE test_repo_lag gauge\ntest_repo_lag{repo=\"c/d\"} 2\n"
+	if got := output(repos); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestGaugeFunc(t *testing.T) {
+	labelled := NewGaugeFunc("test_rate_limit", "Limit.", "user", func() map[string]float64 {
+		return map[string]float64{"b": 2, "a": math.Inf(1)}
+	})
+	want := "# HELP test_rate_limit Limit.\n# TYPE test_rate_limit gauge\ntest_rate_limit{user=\"a\"} +Inf\ntest_rate_limit{user=\"b\"} 2\n"
+	if got := output(labelled); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	single := NewGaugeFunc("test_lowest", "Lowest.", "", func() map[string]float64 {
+		return map[string]float64{"": 42}
+	})
+	want = "# HELP test_lowest Lowest.\n# TYPE test_lowest gauge\ntest_lowest 42\n"
+	if got := output(single); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestHistogramVec(t *testing.T) {
+	h := NewHistogramVec("test_duration_seconds", "Duration.", []float64{0.1, 1}, "job")
+	h.Observe(0.05, "poll")
+	h.Observe(0.5, "poll")
+	h.Observe(3, "poll")
+
+	want := `# HELP test_duration_seconds Duration.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{job="poll",le="0.1"} 1
+test_duration_seconds_bucket{job="poll",le="1"} 2
+test_duration_seconds_bucket{job="poll",le="+Inf"} 3
+test_duration_seconds_sum{job="poll"} 3.55
+test_duration_seconds_count{job="poll"} 3
+`
+	if got := output(h); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestWriteSortsByName(t *testing.T) {
+	var b bytes.Buffer
+	Write(&b)
+
+	var names []string
+	for _, line := range strings.Split(b.String(), "\n") {
+		if strings.HasPrefix(line, "# TYPE ") {
+			names = append(names, strings.Fields(line)[2])
+		}
+	}
+
+	for i := 1; i < len(names); i++ {
+		if names[i-1] >= names[i] {
+			t.Errorf("%s written before %s", names[i-1], names[i])
+		}
+	}
+}
+
+func TestWrongLabelCountPanics(t *testing.T) {
+	c := NewCounterVec("test_panics_total", "Panics.", "a")
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Inc without label values did not panic")
+		}
+	}()
+	c.Inc()
+}
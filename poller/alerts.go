@@ -0,0 +1,208 @@
+package poller
+
+import (
+	"context"
+	"log/slog"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	database "github.com/ad/go-githublistener/db"
+	ghapi "github.com/ad/go-githublistener/ghapi"
+	logging "github.com/ad/go-githublistener/logging"
+	templates "github.com/ad/go-githublistener/templates"
+)
+
+// AlertMe is replaced with github login of the alert owner
+const AlertMe = "@me"
+
+// sentAlertsTTL is how long delivered alerts are remembered
+const sentAlertsTTL = 30 * 24 * time.Hour
+
+// alertEvent is a commit, pull request or release checked against alerts
+type alertEvent struct {
+	key  string
+	data templates.Alert
+}
+
+// AlertKeyword returns text an alert looks for
+func AlertKeyword(pattern, login string) string {
+	if strings.EqualFold(pattern, AlertMe) {
+		return "@" + login
+	}
+
+	return pattern
+}
+
+// alertRegexp matches keyword as a whole word ignoring case
+func alertRegexp(keyword string) (*regexp.Regexp, error) {
+	return regexp.Compile(`(?i)(^|\W)` + regexp.QuoteMeta(keyword) + `($|\W)`)
+}
+
+func commitAlertEvents(repoName string, commits []*ghapi.CommitItem) []*alertEvent {
+	var events []*alertEvent
+
+	for _, commit := range commits {
+		c := templates.NewCommit(repoName, commit)
+		events = append(events, &alertEvent{
+			key:  "commit:" + repoName + ":" + commit.SHA,
+			data: templates.Alert{Repo: repoName, Kind: "commit", Title: c.Title, URL: c.URL, Author: c.Author, Text: c.Body, Date: c.Date},
+		})
+	}
+
+	return events
+}
+
+// alertCommits checks new commits of a subscription against alerts of
+// everybody watching the repo
+func (p *Poller) alertCommits(ctx context.Context, item *database.UsersReposResult, commits []*ghapi.CommitItem) {
+	alerts, err := database.GetRepoAlerts(ctx, p.DB, item.RepoID)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to get alerts", logging.Err(err))
+		return
+	}
+
+	if len(alerts) > 0 {
+		p.alert(ctx, alerts, commitAlertEvents(item.RepoName, commits))
+	}
+}
+
+// checkAlerts looks for pull requests and releases matching alerts, every
+// repo is checked once per StaleAfter whatever number of alerts it has
+func (p *Poller) checkAlerts(ctx context.Context) error {
+	now := p.Clock.Now()
+
+	if err := database.DeleteSentAlerts(ctx, p.DB, now.Add(-sentAlertsTTL)); err != nil {
+		return err
+	}
+
+	alerts, err := database.GetStaleRepoAlerts(ctx, p.DB, now.Add(-p.StaleAfter))
+	if err != nil {
+		return err
+	}
+
+	byRepo := make(map[int64][]*database.RepoAlert)
+	var repos []int64
+	for _, alert := range alerts {
+		if _, ok := byRepo[alert.RepoID]; !ok {
+			repos = append(repos, alert.RepoID)
+		}
+		byRepo[alert.RepoID] = append(byRepo[alert.RepoID], alert)
+	}
+
+	for _, repoID := range repos {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		repoAlerts := byRepo[repoID]
+		first := repoAlerts[0]
+		ctx := logging.With(ctx, logging.KeyRepo, first.RepoName)
+
+		// overlap with the previous check, sent alerts are not repeated
+		since := first.CheckedAt.Add(-p.StaleAfter)
+
+		var events []*alertEvent
+
+		pulls, err := p.Github.GetGithubRepoPulls(ctx, first.Token, first.RepoName)
+		if err != nil {
+			slog.ErrorContext(ctx, "failed to get pull requests", logging.Err(err))
+			continue
+		}
+		for _, pull := range pulls {
+			if pull.CreatedAt.After(since) {
+				events = append(events, &alertEvent{
+					key:  "pr:" + first.RepoName + ":" + strconv.Itoa(pull.Number),
+					data: templates.Alert{Repo: first.RepoName, Kind: "pull request", Title: pull.Title, URL: pull.HTMLUrl, Author: pull.User.Login, Text: pull.Body, Date: pull.CreatedAt},
+				})
+			}
+		}
+
+		releases, err := p.Github.GetGithubRepoReleases(ctx, first.Token, first.RepoName)
+		if err != nil {
+			slog.ErrorContext(ctx, "failed to get releases", logging.Err(err))
+			continue
+		}
+		for _, release := range releases {
+			date := release.PublishedAt
+			if date.IsZero() {
+				date = release.CreatedAt
+			}
+
+			title := release.Name
+			if title == "" {
+				title = release.TagName
+			}
+
+			if date.After(since) {
+				events = append(events, &alertEvent{
+					key:  "release:" + first.RepoName + ":" + strconv.FormatInt(release.ID, 10),
+					data: templates.Alert{Repo: first.RepoName, Kind: "release", Title: title, URL: release.HTMLUrl, Author: release.Author.Login, Text: release.Body, Date: date},
+				})
+			}
+		}
+
+		p.alert(ctx, repoAlerts, events)
+
+		if err := database.SetAlertsCheckedAt(ctx, p.DB, repoID, now); err != nil {
+			slog.ErrorContext(ctx, "failed to update alerts check time", logging.Err(err))
+		}
+	}
+
+	return nil
+}
+
+// alert sends matching events to alert owners, each alert about an event
+// is delivered once even if the repo is polled for several subscriptions.
+// Alerts ignore quiet hours, mutes and pauses, they are meant to be urgent
+func (p *Poller) alert(ctx context.Context, alerts []*database.RepoAlert, events []*alertEvent) {
+	for _, alert := range alerts {
+		ctx := logging.With(ctx, logging.KeyTelegramUser, alert.TelegramUserID, "alert", alert.ID)
+		keyword := AlertKeyword(alert.Pattern, alert.UserName)
+
+		re, err := alertRegexp(keyword)
+		if err != nil {
+			slog.ErrorContext(ctx, "wrong alert pattern", logging.Err(err))
+			continue
+		}
+
+		chatID, err := strconv.ParseInt(alert.TelegramUserID, 10, 64)
+		if err != nil {
+			slog.ErrorContext(ctx, "wrong telegram user id", logging.Err(err))
+			continue
+		}
+
+		for _, event := range events {
+			// alerts don't look into the past
+			if event.data.Date.Before(alert.CreatedAt) {
+				continue
+			}
+
+			if !re.MatchString(event.data.Title) && !re.MatchString(event.data.Text) {
+				continue
+			}
+
+			if sent, err := database.MarkAlertSent(ctx, p.DB, alert.ID, event.key); err != nil || !sent {
+				if err != nil {
+					slog.ErrorContext(ctx, "failed to mark alert sent", logging.Err(err))
+				}
+				continue
+			}
+
+			data := event.data
+			data.Keyword = keyword
+
+			settings := &database.TelegramUser{TelegramUserID: alert.TelegramUserID, Format: alert.Format, Timezone: alert.Timezone}
+			text, err := p.render(templates.EventAlert, settings, &data)
+			if err != nil {
+				slog.ErrorContext(ctx, "failed to render alert", logging.Err(err))
+				continue
+			}
+
+			if err := p.send(ctx, templates.EventAlert, p.Renderer.Message(chatID, text)); err != nil {
+				slog.ErrorContext(ctx, "failed to send alert", logging.Err(err))
+			}
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package poller
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock ...
+type Clock interface {
+	Now() time.Time
+}
+
+// SystemClock returns wall-clock time
+type SystemClock struct{}
+
+// Now ...
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+// FakeClock is a manually driven clock for tests and replays
+type FakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewFakeClock ...
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+// Now ...
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+// Set ...
+func (c *FakeClock) Set(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = now
+}
+
+// Advance ...
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+}
@@ -0,0 +1,308 @@
+package poller
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	database "github.com/ad/go-githublistener/db"
+	ghapi "github.com/ad/go-githublistener/ghapi"
+	logging "github.com/ad/go-githublistener/logging"
+	templates "github.com/ad/go-githublistener/templates"
+
+	cron "github.com/robfig/cron/v3"
+	tgbotapi "gopkg.in/telegram-bot-api.v4"
+)
+
+// Delivery modes of a subscription, empty means immediate
+const (
+	DeliveryImmediate = "immediate"
+	DeliveryPush      = "push"
+	DeliveryHourly    = "hourly"
+	DeliveryDaily     = "daily"
+)
+
+// Deliveries lists every delivery mode
+var Deliveries = []string{DeliveryImmediate, DeliveryPush, DeliveryHourly, DeliveryDaily}
+
+// DefaultDigestTime is used when digest time was not chosen, hourly
+// digests use only its minutes
+const DefaultDigestTime = "09:00"
+
+// IsDelivery ...
+func IsDelivery(delivery string) bool {
+	for _, item := range Deliveries {
+		if item == delivery {
+			return true
+		}
+	}
+
+	return false
+}
+
+// DigestSchedule returns when digests of a subscription are sent in time
+// zone tz, nil for modes delivering without delay
+func DigestSchedule(delivery, at, tz string) (cron.Schedule, error) {
+	if delivery != DeliveryHourly && delivery != DeliveryDaily {
+		return nil, nil
+	}
+
+	if at == "" {
+		at = DefaultDigestTime
+	}
+
+	t, err := time.Parse("15:04", at)
+	if err != nil {
+		return nil, fmt.Errorf("wrong digest time %q, use HH:MM", at)
+	}
+
+	spec := ""
+	if tz != "" {
+		spec = "CRON_TZ=" + tz + " "
+	}
+
+	if delivery == DeliveryHourly {
+		return cron.ParseStandard(spec + fmt.Sprintf("%d * * * *", t.Minute()))
+	}
+
+	return cron.ParseStandard(spec + fmt.Sprintf("%d %d * * *", t.Minute(), t.Hour()))
+}
+
+// deliver sends new commits of a subscription according to its delivery
+// mode, private subscriptions are held during quiet hours of the user
+func (p *Poller) deliver(ctx context.Context, item *database.UsersReposResult, chatID int64, commits []*ghapi.CommitItem) {
+	if item.ChatID == 0 && item.Settings().IsQuiet(p.Clock.Now()) {
+		p.queue(ctx, item, commits, database.PendingQuiet)
+		return
+	}
+
+	switch item.Delivery {
+	case DeliveryHourly, DeliveryDaily:
+		p.queue(ctx, item, commits, database.PendingDigest)
+	case DeliveryPush:
+		if len(commits) > 1 {
+			p.sendPush(ctx, item, chatID, commits)
+			return
+		}
+		fallthrough
+	default:
+		for _, commit := range commits {
+			p.sendCommit(ctx, item, chatID, commit)
+		}
+	}
+}
+
+// queue stores commits until the next digest of the subscription
+func (p *Poller) queue(ctx context.Context, item *database.UsersReposResult, commits []*ghapi.CommitItem, reason string) {
+	now := p.Clock.Now()
+
+	// oldest first, so digests list commits in the order they were made
+	for i := len(commits) - 1; i >= 0; i-- {
+		commit := templates.NewCommit(item.RepoName, commits[i])
+
+		if err := database.AddPendingNotification(ctx, p.DB, &database.PendingNotification{
+			UserRepoID: item.ID,
+			SHA:        commit.SHA,
+			Author:     commit.Author,
+			Title:      commit.Title,
+			URL:        commit.URL,
+			Date:       commit.Date,
+			Reason:     reason,
+			CreatedAt:  now,
+		}); err != nil {
+			slog.ErrorContext(ctx, "failed to queue commit", logging.Err(err))
+		}
+	}
+}
+
+func (p *Poller) sendPush(ctx context.Context, item *database.UsersReposResult, chatID int64, commits []*ghapi.CommitItem) {
+	push := &templates.Push{
+		Repo:       item.RepoName,
+		CompareURL: pushCompareURL(item.RepoName, commits),
+	}
+	for _, commit := range commits {
+		push.Commits = append(push.Commits, templates.NewCommit(item.RepoName, commit))
+	}
+
+	text, err := p.render(templates.EventPush, item.Settings(), push)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to render push", logging.Err(err))
+		return
+	}
+
+	msg := p.Renderer.Message(chatID, text)
+	if row, err := p.subscriptionRow(item); err == nil {
+		msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+			row,
+			tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonURL("Open compare", push.CompareURL)),
+		)
+	} else {
+		slog.ErrorContext(ctx, "failed to build buttons", logging.Err(err))
+	}
+	if err := p.send(ctx, templates.EventPush, msg); err != nil {
+		slog.ErrorContext(ctx, "failed to send push", logging.Err(err))
+	}
+}
+
+// pushCompareURL compares the parent of the oldest commit with the newest
+// one, github lists commits newest first
+func pushCompareURL(repoName string, commits []*ghapi.CommitItem) string {
+	newest, oldest := commits[0], commits[len(commits)-1]
+	if len(oldest.Parents) == 0 {
+		return newest.HTMLUrl
+	}
+
+	return "https://github.com/" + repoName + "/compare/" + oldest.Parents[0].SHA + "..." + newest.SHA
+}
+
+// digestBatch collects due notifications of one chat
+type digestBatch struct {
+	chatID   int64
+	settings *database.TelegramUser
+	ids      []int64
+	digest   templates.Digest
+	repos    map[string]*templates.DigestRepo
+}
+
+var digestPeriods = map[string]string{
+	DeliveryHourly: "Hourly digest",
+	DeliveryDaily:  "Daily digest",
+}
+
+// digestPeriod names the summary a held notification goes into
+func digestPeriod(item *database.PendingNotification) string {
+	switch item.Reason {
+	case database.PendingMuted:
+		return "Missed while muted"
+	case database.PendingQuiet:
+		return "Missed during quiet hours"
+	}
+
+	if period := digestPeriods[item.Delivery]; period != "" {
+		return period
+	}
+
+	return "Missed during quiet hours"
+}
+
+// Digest sends queued commits whose digest time has come, commits held
+// during quiet hours or a mute are sent as a summary once they end
+func (p *Poller) Digest(ctx context.Context) error {
+	if err := database.DeleteOrphanPendingNotifications(ctx, p.DB); err != nil {
+		return err
+	}
+
+	items, err := database.GetPendingNotifications(ctx, p.DB)
+	if err != nil {
+		return err
+	}
+
+	now := p.Clock.Now()
+
+	type key struct {
+		chatID int64
+		period string
+	}
+
+	batches := make(map[key]*digestBatch)
+	var order []key
+
+	for _, item := range items {
+		ctx := logging.With(ctx, logging.KeyRepo, item.RepoName, logging.KeyTelegramUser, item.TelegramUserID)
+
+		settings := item.Settings()
+		if item.MutedUntil.After(now) || item.ChatID == 0 && settings.IsQuiet(now) {
+			continue
+		}
+
+		if item.Reason != database.PendingMuted {
+			schedule, err := DigestSchedule(item.Delivery, item.DigestTime, settings.Timezone)
+			if err != nil {
+				slog.ErrorContext(ctx, "wrong digest schedule", logging.Err(err))
+				continue
+			}
+
+			if schedule != nil && schedule.Next(item.CreatedAt).After(now) {
+				continue
+			}
+		}
+
+		chatID, err := chatOf(item.ChatID, item.TelegramUserID)
+		if err != nil {
+			slog.ErrorContext(ctx, "wrong notification destination", logging.Err(err))
+			continue
+		}
+
+		k := key{chatID, digestPeriod(item)}
+		batch, ok := batches[k]
+		if !ok {
+			batch = &digestBatch{
+				chatID:   chatID,
+				settings: settings,
+				digest:   templates.Digest{Period: k.period},
+				repos:    make(map[string]*templates.DigestRepo),
+			}
+			batches[k] = batch
+			order = append(order, k)
+		}
+
+		repo, ok := batch.repos[item.RepoName]
+		if !ok {
+			repo = &templates.DigestRepo{Repo: item.RepoName}
+			batch.repos[item.RepoName] = repo
+			batch.digest.Repos = append(batch.digest.Repos, repo)
+		}
+
+		repo.Commits = append(repo.Commits, pendingCommit(item))
+		batch.ids = append(batch.ids, item.ID)
+	}
+
+	for _, k := range order {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		p.sendDigest(ctx, batches[k])
+	}
+
+	return nil
+}
+
+func (p *Poller) sendDigest(ctx context.Context, batch *digestBatch) {
+	ctx = logging.With(ctx, logging.KeyChat, batch.chatID, "period", batch.digest.Period)
+
+	text, err := p.render(templates.EventDigest, batch.settings, &batch.digest)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to render digest", logging.Err(err))
+		return
+	}
+
+	if err := p.send(ctx, templates.EventDigest, p.Renderer.Message(batch.chatID, text)); err != nil {
+		slog.ErrorContext(ctx, "failed to send digest", logging.Err(err))
+		return
+	}
+
+	if err := database.DeletePendingNotifications(ctx, p.DB, batch.ids); err != nil {
+		slog.ErrorContext(ctx, "failed to delete sent notifications", logging.Err(err))
+	}
+}
+
+func pendingCommit(item *database.PendingNotification) *templates.Commit {
+	short := item.SHA
+	if len(short) > ShortSHA {
+		short = short[:ShortSHA]
+	}
+
+	return &templates.Commit{
+		Repo:      item.RepoName,
+		SHA:       item.SHA,
+		ShortSHA:  short,
+		URL:       item.URL,
+		Author:    item.Author,
+		AuthorURL: "https://github.com/" + item.Author,
+		Title:     item.Title,
+		Message:   item.Title,
+		Date:      item.Date,
+	}
+}
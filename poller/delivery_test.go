@@ -0,0 +1,52 @@
+package poller
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDigestSchedule(t *testing.T) {
+	from := time.Date(2026, 3, 2, 10, 15, 0, 0, time.UTC)
+
+	tests := []struct {
+		delivery string
+		at       string
+		tz       string
+		want     time.Time
+		wantErr  bool
+	}{
+		{DeliveryHourly, "", "", time.Date(2026, 3, 2, 11, 0, 0, 0, time.UTC), false},
+		{DeliveryHourly, "09:45", "", time.Date(2026, 3, 2, 10, 45, 0, 0, time.UTC), false},
+		{DeliveryDaily, "", "", time.Date(2026, 3, 3, 9, 0, 0, 0, time.UTC), false},
+		{DeliveryDaily, "18:30", "", time.Date(2026, 3, 2, 18, 30, 0, 0, time.UTC), false},
+		// 09:30 in Berlin is 08:30 UTC in winter
+		{DeliveryDaily, "09:30", "Europe/Berlin", time.Date(2026, 3, 3, 8, 30, 0, 0, time.UTC), false},
+		{DeliveryDaily, "9:30pm", "", time.Time{}, true},
+		{DeliveryDaily, "25:00", "", time.Time{}, true},
+		{DeliveryDaily, "09:00", "Nowhere/Town", time.Time{}, true},
+	}
+
+	for _, tt := range tests {
+		schedule, err := DigestSchedule(tt.delivery, tt.at, tt.tz)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("DigestSchedule(%q, %q, %q) error = %v, want error %t", tt.delivery, tt.at, tt.tz, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+
+		if got := schedule.Next(from); !got.Equal(tt.want) {
+			t.Errorf("DigestSchedule(%q, %q, %q).Next(%s) = %s, want %s", tt.delivery, tt.at, tt.tz, from, got.UTC(), tt.want)
+		}
+	}
+}
+
+func TestDigestScheduleImmediate(t *testing.T) {
+	for _, delivery := range []string{"", DeliveryImmediate, DeliveryPush} {
+		schedule, err := DigestSchedule(delivery, "09:00", "")
+		if schedule != nil || err != nil {
+			t.Errorf("DigestSchedule(%q) = %v, %v, want no schedule", delivery, schedule, err)
+		}
+	}
+}
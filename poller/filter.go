@@ -0,0 +1,201 @@
+package poller
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+
+	database "github.com/ad/go-githublistener/db"
+	ghapi "github.com/ad/go-githublistener/ghapi"
+	logging "github.com/ad/go-githublistener/logging"
+)
+
+// Rules are compiled commit filters of a subscription
+type Rules struct {
+	authors  ruleSet
+	paths    ruleSet
+	messages ruleSet
+}
+
+type ruleSet struct {
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+}
+
+// matches reports whether any of values matches any of patterns
+func matches(patterns []*regexp.Regexp, values ...string) bool {
+	for _, re := range patterns {
+		for _, value := range values {
+			if re.MatchString(value) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// CompileFilter validates filter pattern, authors and paths are globs where
+// * does not cross a slash and ** does, messages are regular expressions
+func CompileFilter(kind, pattern string) (*regexp.Regexp, error) {
+	switch kind {
+	case database.FilterAuthor:
+		return globRegexp("(?i)", pattern)
+	case database.FilterPath:
+		return globRegexp("", pattern)
+	case database.FilterMessage:
+		return regexp.Compile(pattern)
+	}
+
+	return nil, fmt.Errorf("unknown filter %s, use author, path or message", kind)
+}
+
+func globRegexp(flags, glob string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString(flags + "^")
+
+	for i := 0; i < len(glob); i++ {
+		switch {
+		case strings.HasPrefix(glob[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case glob[i] == '*':
+			b.WriteString("[^/]*")
+		case glob[i] == '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+
+	// a directory matches everything below it
+	if strings.HasSuffix(glob, "/") {
+		b.WriteString(".*")
+	}
+
+	b.WriteString("$")
+
+	return regexp.Compile(b.String())
+}
+
+// NewRules compiles filters
+func NewRules(filters []*database.Filter) (*Rules, error) {
+	rules := &Rules{}
+
+	for _, filter := range filters {
+		re, err := CompileFilter(filter.Kind, filter.Pattern)
+		if err != nil {
+			return nil, err
+		}
+
+		var set *ruleSet
+		switch filter.Kind {
+		case database.FilterAuthor:
+			set = &rules.authors
+		case database.FilterPath:
+			set = &rules.paths
+		default:
+			set = &rules.messages
+		}
+
+		if filter.Action == database.FilterInclude {
+			set.include = append(set.include, re)
+		} else {
+			set.exclude = append(set.exclude, re)
+		}
+	}
+
+	return rules, nil
+}
+
+// NeedsFiles reports whether rules look at changed files, the commit list
+// endpoint does not return them
+func (r *Rules) NeedsFiles() bool {
+	return len(r.paths.include) > 0 || len(r.paths.exclude) > 0
+}
+
+// Match reports whether a commit passes the rules: it must match at least
+// one include rule of every kind that has them, must not match author or
+// message exclude rules and must change something outside of excluded paths
+func (r *Rules) Match(commit *ghapi.CommitItem) bool {
+	authors := []string{commit.Commit.Author.Name}
+	if commit.Author != nil && commit.Author.Login != "" {
+		authors = append(authors, commit.Author.Login)
+	}
+
+	if len(r.authors.include) > 0 && !matches(r.authors.include, authors...) {
+		return false
+	}
+	if matches(r.authors.exclude, authors...) {
+		return false
+	}
+
+	message := commit.Commit.Message
+	if len(r.messages.include) > 0 && !matches(r.messages.include, message) {
+		return false
+	}
+	if matches(r.messages.exclude, message) {
+		return false
+	}
+
+	var files []string
+	for _, file := range commit.Files {
+		files = append(files, file.Filename)
+	}
+
+	if len(r.paths.include) > 0 && !matches(r.paths.include, files...) {
+		return false
+	}
+
+	if len(r.paths.exclude) > 0 && len(files) > 0 {
+		for _, file := range files {
+			if !matches(r.paths.exclude, file) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return true
+}
+
+// filter drops commits rejected by filters of the subscription, commits
+// are kept when filters can't be evaluated
+func (p *Poller) filter(ctx context.Context, item *database.UsersReposResult, commits []*ghapi.CommitItem) []*ghapi.CommitItem {
+	filters, err := database.GetFilters(ctx, p.DB, item.UserID, item.ChatID, item.RepoID)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to get filters", logging.Err(err))
+		return commits
+	}
+
+	if len(filters) == 0 {
+		return commits
+	}
+
+	rules, err := NewRules(filters)
+	if err != nil {
+		slog.ErrorContext(ctx, "wrong filters", logging.Err(err))
+		return commits
+	}
+
+	var kept []*ghapi.CommitItem
+	for _, commit := range commits {
+		if rules.NeedsFiles() && commit.Files == nil {
+			full, err := p.Github.GetGithubCommit(ctx, item.Token, item.RepoName, commit.SHA)
+			if err != nil {
+				slog.ErrorContext(ctx, "failed to get commit files", "sha", commit.SHA, logging.Err(err))
+				kept = append(kept, commit)
+				continue
+			}
+			commit.Files = full.Files
+		}
+
+		if rules.Match(commit) {
+			kept = append(kept, commit)
+		}
+	}
+
+	return kept
+}
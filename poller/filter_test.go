@@ -0,0 +1,157 @@
+package poller
+
+import (
+	"testing"
+
+	database "github.com/ad/go-githublistener/db"
+	ghapi "github.com/ad/go-githublistener/ghapi"
+)
+
+func TestCompileFilterGlobs(t *testing.T) {
+	tests := []struct {
+		kind    string
+		pattern string
+		value   string
+		want    bool
+	}{
+		{database.FilterPath, "src/*.go", "src/main.go", true},
+		{database.FilterPath, "src/*.go", "src/pkg/main.go", false},
+		{database.FilterPath, "src/**", "src/pkg/main.go", true},
+		{database.FilterPath, "src/**/*.go", "src/pkg/main.go", true},
+		{database.FilterPath, "docs/", "docs/a/b.md", true},
+		{database.FilterPath, "docs/", "docs", false},
+		{database.FilterPath, "?.md", "a.md", true},
+		{database.FilterPath, "?.md", "ab.md", false},
+		{database.FilterPath, "a.md", "aXmd", false},
+		{database.FilterPath, "README.md", "readme.md", false},
+		{database.FilterAuthor, "dependabot*", "Dependabot[bot]", true},
+		{database.FilterAuthor, "dependabot*", "renovate[bot]", false},
+		{database.FilterAuthor, "octocat", "octocat2", false},
+		{database.FilterMessage, `\[skip notify\]`, "docs [skip notify]", true},
+		{database.FilterMessage, `^WIP`, "not WIP", false},
+	}
+
+	for _, tt := range tests {
+		re, err := CompileFilter(tt.kind, tt.pattern)
+		if err != nil {
+			t.Fatalf("CompileFilter(%s, %q): %v", tt.kind, tt.pattern, err)
+		}
+		if got := re.MatchString(tt.value); got != tt.want {
+			t.Errorf("%s %q matches %q = %t, want %t", tt.kind, tt.pattern, tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestCompileFilterErrors(t *testing.T) {
+	tests := []struct {
+		kind    string
+		pattern string
+	}{
+		{"branch", "main"},
+		{database.FilterMessage, "("},
+	}
+
+	for _, tt := range tests {
+		if _, err := CompileFilter(tt.kind, tt.pattern); err == nil {
+			t.Errorf("CompileFilter(%s, %q) succeeded, want error", tt.kind, tt.pattern)
+		}
+	}
+}
+
+func TestRulesMatch(t *testing.T) {
+	commit := func(author, login, message string, files ...string) *ghapi.CommitItem {
+		c := &ghapi.CommitItem{}
+		c.Commit.Author.Name = author
+		c.Commit.Message = message
+		if login != "" {
+			c.Author = &ghapi.Account{Login: login}
+		}
+		for _, file := range files {
+			c.Files = append(c.Files, ghapi.File{Filename: file})
+		}
+		return c
+	}
+	filter := func(kind, action, pattern string) *database.Filter {
+		return &database.Filter{Kind: kind, Action: action, Pattern: pattern}
+	}
+
+	tests := []struct {
+		name    string
+		filters []*database.Filter
+		commit  *ghapi.CommitItem
+		want    bool
+	}{
+		{
+			name:   "no rules",
+			commit: commit("Octo Cat", "octocat", "fix"),
+			want:   true,
+		},
+		{
+			name:    "excluded login",
+			filters: []*database.Filter{filter(database.FilterAuthor, database.FilterExclude, "dependabot*")},
+			commit:  commit("Bot", "dependabot[bot]", "bump"),
+			want:    false,
+		},
+		{
+			name:    "included author name",
+			filters: []*database.Filter{filter(database.FilterAuthor, database.FilterInclude, "octo*")},
+			commit:  commit("Octo Cat", "", "fix"),
+			want:    true,
+		},
+		{
+			name:    "not included author",
+			filters: []*database.Filter{filter(database.FilterAuthor, database.FilterInclude, "octo*")},
+			commit:  commit("Hubot", "hubot", "fix"),
+			want:    false,
+		},
+		{
+			name:    "excluded message",
+			filters: []*database.Filter{filter(database.FilterMessage, database.FilterExclude, `\[skip notify\]`)},
+			commit:  commit("Octo Cat", "octocat", "docs [skip notify]"),
+			want:    false,
+		},
+		{
+			name:    "included path",
+			filters: []*database.Filter{filter(database.FilterPath, database.FilterInclude, "src/**")},
+			commit:  commit("Octo Cat", "octocat", "fix", "README.md", "src/main.go"),
+			want:    true,
+		},
+		{
+			name:    "not included path",
+			filters: []*database.Filter{filter(database.FilterPath, database.FilterInclude, "src/**")},
+			commit:  commit("Octo Cat", "octocat", "fix", "README.md"),
+			want:    false,
+		},
+		{
+			name:    "only excluded paths",
+			filters: []*database.Filter{filter(database.FilterPath, database.FilterExclude, "*.md")},
+			commit:  commit("Octo Cat", "octocat", "docs", "README.md", "CHANGELOG.md"),
+			want:    false,
+		},
+		{
+			name:    "some paths outside exclude",
+			filters: []*database.Filter{filter(database.FilterPath, database.FilterExclude, "*.md")},
+			commit:  commit("Octo Cat", "octocat", "fix", "README.md", "main.go"),
+			want:    true,
+		},
+		{
+			name: "every kind must pass",
+			filters: []*database.Filter{
+				filter(database.FilterAuthor, database.FilterInclude, "octocat"),
+				filter(database.FilterPath, database.FilterInclude, "src/**"),
+			},
+			commit: commit("Octo Cat", "octocat", "fix", "docs/a.md"),
+			want:   false,
+		},
+	}
+
+	for _, tt := range tests {
+		rules, err := NewRules(tt.filters)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got := rules.Match(tt.commit); got != tt.want {
+			t.Errorf("%s: Match = %t, want %t", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package poller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"sort"
+	"strings"
+
+	database "github.com/ad/go-githublistener/db"
+	ghapi "github.com/ad/go-githublistener/ghapi"
+	logging "github.com/ad/go-githublistener/logging"
+)
+
+// SyncOwner links repos of a watched owner that are not archived and match
+// the watch pattern, and unlinks repos that were archived or deleted
+func (p *Poller) SyncOwner(ctx context.Context, watch *database.OwnerWatch) (added, removed []string, err error) {
+	repos, err := p.Github.GetGithubOwnerRepos(ctx, watch.Token, watch.Owner, watch.Kind == database.OwnerOrg)
+	truncated := errors.Is(err, ghapi.ErrTruncated)
+	if err != nil && !truncated {
+		return nil, nil, err
+	}
+	if truncated {
+		slog.WarnContext(ctx, "owner has too many repos, none are unlinked", "owner", watch.Owner, "listed", len(repos))
+	}
+
+	var re *regexp.Regexp
+	if watch.Pattern != "" {
+		// repo names are case insensitive like logins
+		if re, err = CompileFilter(database.FilterAuthor, watch.Pattern); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	wanted := make(map[string]*ghapi.Repo)
+	for _, repo := range repos {
+		if repo.Archived || re != nil && !re.MatchString(repo.Name) {
+			continue
+		}
+		wanted[repo.FullName] = repo
+	}
+
+	links, err := database.GetSourceLinks(ctx, p.DB, watch.UserID, watch.ChatID, watch.Source())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	linked := make(map[string]bool)
+	for _, link := range links {
+		// a repo missing from a truncated list may still exist
+		if _, ok := wanted[link.RepoName]; ok || truncated {
+			linked[link.RepoName] = true
+			continue
+		}
+
+		if err := database.DeleteUserRepoLink(ctx, p.DB, link); err != nil {
+			return added, removed, err
+		}
+		removed = append(removed, link.RepoName)
+	}
+
+	// repos removed with /delete in a private chat stay removed
+	skip := make(map[string]bool)
+	if watch.ChatID == 0 {
+		removedRepos, err := database.GetRemovedRepos(ctx, p.DB, watch.UserID)
+		if err != nil {
+			return added, removed, err
+		}
+		for _, repo := range removedRepos {
+			skip[strings.ToLower(repo.RepoName)] = true
+		}
+	}
+
+	user := &database.GithubUser{ID: watch.UserID, Name: watch.Name}
+
+	for name, repo := range wanted {
+		if linked[name] || skip[strings.ToLower(name)] {
+			continue
+		}
+
+		dbrepo, err := database.AddRepoIfNotExist(ctx, p.DB, &database.GithubRepo{Name: repo.Name, RepoName: repo.FullName})
+		if err != nil && err.Error() != database.AlreadyExists {
+			return added, removed, err
+		}
+
+		// start from now, history of a new repo is not news
+		if err := database.AddRepoLinkFrom(ctx, p.DB, user, dbrepo, watch.ChatID, p.Clock.Now(), watch.Source()); err != nil {
+			if err.Error() != database.AlreadyExists {
+				return added, removed, err
+			}
+			continue
+		}
+		added = append(added, name)
+	}
+
+	sort.Strings(added)
+	sort.Strings(removed)
+
+	return added, removed, nil
+}
+
+// syncOwners runs SyncOwner for every watch and reports changes
+func (p *Poller) syncOwners(ctx context.Context) error {
+	watches, err := database.GetOwnerWatches(ctx, p.DB)
+	if err != nil {
+		return err
+	}
+
+	for _, watch := range watches {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		ctx := logging.With(ctx, "owner", watch.Owner, logging.KeyTelegramUser, watch.TelegramUserID, logging.KeyChat, watch.ChatID)
+
+		added, removed, err := p.SyncOwner(ctx, watch)
+		if err != nil {
+			slog.ErrorContext(ctx, "failed to sync owner", logging.Err(err))
+			continue
+		}
+
+		if len(added) == 0 && len(removed) == 0 {
+			continue
+		}
+
+		chatID, err := chatOf(watch.ChatID, watch.TelegramUserID)
+		if err != nil {
+			slog.ErrorContext(ctx, "wrong owner watch destination", logging.Err(err))
+			continue
+		}
+
+		if err := p.send(ctx, "owner_report", p.Renderer.Message(chatID, p.OwnerReport(watch.Owner, added, removed))); err != nil {
+			slog.ErrorContext(ctx, "failed to send owner report", logging.Err(err))
+		}
+	}
+
+	return nil
+}
+
+// OwnerReport describes repos added and removed by an owner sync
+func (p *Poller) OwnerReport(owner string, added, removed []string) string {
+	return p.changesReport(owner, added, removed, "repos archived or deleted")
+}
+
+// changesReport lists added and removed repos under a bold title
+func (p *Poller) changesReport(title string, added, removed []string, removedLabel string) string {
+	r := p.Renderer
+
+	links := func(names []string) string {
+		list := make([]string, len(names))
+		for i, name := range names {
+			list[i] = r.RepoLink(name)
+		}
+		return strings.Join(list, r.Escape(", "))
+	}
+
+	lines := []string{r.Bold(title) + r.Escape(":")}
+	if len(added) > 0 {
+		lines = append(lines, r.Escape(fmt.Sprintf("%d new repos watched: ", len(added)))+links(added))
+	}
+	if len(removed) > 0 {
+		lines = append(lines, r.Escape(fmt.Sprintf("%d %s: ", len(removed), removedLabel))+links(removed))
+	}
+	if len(added) == 0 && len(removed) == 0 {
+		lines = append(lines, r.Escape("no repos found"))
+	}
+
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,71 @@
+package poller
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	database "github.com/ad/go-githublistener/db"
+	ghapi "github.com/ad/go-githublistener/ghapi"
+)
+
+func TestSyncOwnerKeepsRemovedRepos(t *testing.T) {
+	now := time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC)
+
+	db := openTestDB(t)
+	removedID := subscribe(t, db, "acme/removed", now)
+	if _, err := db.Exec(`DELETE FROM users_repos WHERE repo_id = ?`, removedID); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.AddRemovedRepo(db, 1, removedID); err != nil {
+		t.Fatal(err)
+	}
+
+	github := &fakeGithub{owners: map[string][]*ghapi.Repo{"acme": {
+		{Name: "api", FullName: "acme/api"},
+		{Name: "removed", FullName: "acme/removed"},
+		{Name: "old", FullName: "acme/old", Archived: true},
+	}}}
+
+	p := New(db, github, &fakeSender{})
+	p.Clock = NewFakeClock(now)
+
+	watch := &database.OwnerWatch{UserID: 1, Owner: "acme", Kind: database.OwnerOrg, Name: "Octo Cat", TelegramUserID: "42", Token: "token"}
+	if err := database.AddOwnerWatch(db, watch); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		added, removed, err := p.SyncOwner(context.Background(), watch)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := []string{"acme/api"}
+		if i > 0 {
+			want = nil
+		}
+		if !reflect.DeepEqual(added, want) || len(removed) != 0 {
+			t.Errorf("sync %d added %v removed %v, want added %v", i+1, added, removed, want)
+		}
+	}
+
+	links, err := database.GetSourceLinks(context.Background(), db, 1, 0, watch.Source())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(links) != 1 || links[0].RepoName != "acme/api" {
+		t.Errorf("linked %d repos, want only acme/api", len(links))
+	}
+
+	// the removed repo is linked for a group watching the same owner
+	group := &database.OwnerWatch{UserID: 1, ChatID: -100, Owner: "acme", Kind: database.OwnerOrg, Name: "Octo Cat", TelegramUserID: "42", Token: "token"}
+	added, _, err := p.SyncOwner(context.Background(), group)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"acme/api", "acme/removed"}; !reflect.DeepEqual(added, want) {
+		t.Errorf("group sync added %v, want %v", added, want)
+	}
+}
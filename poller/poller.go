@@ -0,0 +1,481 @@
+package poller
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	database "github.com/ad/go-githublistener/db"
+	ghapi "github.com/ad/go-githublistener/ghapi"
+	logging "github.com/ad/go-githublistener/logging"
+	metrics "github.com/ad/go-githublistener/metrics"
+	telegram "github.com/ad/go-githublistener/telegram"
+	templates "github.com/ad/go-githublistener/templates"
+	tracing "github.com/ad/go-githublistener/tracing"
+
+	sql "github.com/lazada/sqle"
+	tgbotapi "gopkg.in/telegram-bot-api.v4"
+)
+
+// DefaultStaleAfter is how long a subscription rests between two polls
+const DefaultStaleAfter = 15 * time.Minute
+
+// DefaultWorkers ...
+const DefaultWorkers = 8
+
+// forgetPollsAfter drops poll times of subscriptions not polled for this
+// long, every subscription is polled each StaleAfter so they are gone
+const forgetPollsAfter = 24 * time.Hour
+
+// Callback actions of notification buttons
+const (
+	ActionMute    = "m"
+	ActionUnwatch = "u"
+	ActionDiff    = "d"
+)
+
+// ShortSHA is the commit hash length used in callback data and digests
+const ShortSHA = templates.ShortSHA
+
+// Github is the subset of ghapi.Client used by the poller
+type Github interface {
+	GetGithubUserSourceRepos(ctx context.Context, code, username, source string) ([]*ghapi.Repo, error)
+	GetGithubUserRepoCommits(ctx context.Context, item *database.UsersReposResult) ([]*ghapi.CommitItem, error)
+	GetGithubCommit(ctx context.Context, code, reponame, sha string) (*ghapi.CommitItem, error)
+	GetGithubRepoPulls(ctx context.Context, code, reponame string) ([]*ghapi.PullRequest, error)
+	GetGithubRepoReleases(ctx context.Context, code, reponame string) ([]*ghapi.Release, error)
+	GetGithubOwnerRepos(ctx context.Context, code, owner string, org bool) ([]*ghapi.Repo, error)
+}
+
+// Sender ...
+type Sender interface {
+	Send(c tgbotapi.Chattable) (tgbotapi.Message, error)
+}
+
+// Poller checks watched repositories for new commits and keeps
+// subscriptions in sync with github
+type Poller struct {
+	DB     *sql.DB
+	Github Github
+	Bot    Sender
+	Clock  Clock
+	Signer *telegram.Signer
+
+	Renderer  telegram.Renderer
+	Templates *templates.Set
+
+	StaleAfter time.Duration
+	Workers    int
+
+	// RepoLabels adds per repo poll metrics, off by default as they expose
+	// names of private repos
+	RepoLabels bool
+
+	// polling keeps PollNow from racing Tick over the same cursors
+	polling    sync.Mutex
+	mu         sync.Mutex
+	lastTick   TickStats
+	lastPolled map[int64]polled
+}
+
+// polled is the last poll of a subscription
+type polled struct {
+	at   time.Time
+	repo string
+}
+
+// TickStats describes the last finished Tick
+type TickStats struct {
+	Started       time.Time
+	Duration      time.Duration
+	Subscriptions int
+}
+
+// New ...
+func New(db *sql.DB, github Github, bot Sender) *Poller {
+	return &Poller{
+		DB:         db,
+		Github:     github,
+		Bot:        bot,
+		Clock:      SystemClock{},
+		Renderer:   telegram.DefaultRenderer,
+		Templates:  templates.Must(templates.Load("", telegram.DefaultRenderer)),
+		StaleAfter: DefaultStaleAfter,
+		Workers:    DefaultWorkers,
+	}
+}
+
+// Tick polls every subscription not checked during the last StaleAfter,
+// checks pull requests and releases for alerts and returns once all of
+// them are processed
+func (p *Poller) Tick(ctx context.Context) error {
+	slog.DebugContext(ctx, "check commits started")
+
+	p.polling.Lock()
+	started := p.Clock.Now()
+
+	usersRepos, err := database.GetUserRepos(ctx, p.DB, p.Clock.Now().Add(-p.StaleAfter))
+	if err != nil {
+		p.polling.Unlock()
+		return err
+	}
+
+	p.each(ctx, usersRepos, p.pollRepo)
+	p.polling.Unlock()
+
+	p.forgetPolls()
+
+	p.mu.Lock()
+	p.lastTick = TickStats{Started: started, Duration: p.Clock.Now().Sub(started), Subscriptions: len(usersRepos)}
+	p.mu.Unlock()
+
+	return p.checkAlerts(ctx)
+}
+
+// forgetPolls drops poll times and repo series of deleted subscriptions
+func (p *Poller) forgetPolls() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.Clock.Now()
+	gone := make(map[string]bool)
+	for id, last := range p.lastPolled {
+		if now.Sub(last.at) > forgetPollsAfter {
+			delete(p.lastPolled, id)
+			gone[last.repo] = true
+		}
+	}
+
+	// other subscriptions may still poll the repo
+	for _, last := range p.lastPolled {
+		delete(gone, last.repo)
+	}
+
+	for repo := range gone {
+		metrics.RepoPollLag.Delete(repo)
+		metrics.RepoPollDuration.Delete(repo)
+	}
+}
+
+// LastTick ...
+func (p *Poller) LastTick() TickStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.lastTick
+}
+
+// PollNow polls every subscription to a repo without waiting for StaleAfter
+// and returns how many were polled
+func (p *Poller) PollNow(ctx context.Context, repoID int64) (int, error) {
+	p.polling.Lock()
+	defer p.polling.Unlock()
+
+	usersRepos, err := database.GetRepoSubscriptions(ctx, p.DB, repoID)
+	if err != nil {
+		return 0, err
+	}
+
+	p.each(ctx, usersRepos, p.pollRepo)
+
+	return len(usersRepos), nil
+}
+
+// SyncRepos follows repos github users watch or stop watching, and repos
+// of watched organizations and users
+func (p *Poller) SyncRepos(ctx context.Context) error {
+	slog.DebugContext(ctx, "check repos started")
+
+	users, err := database.GetUsers(ctx, p.DB)
+	if err != nil {
+		return err
+	}
+
+	// SyncUser syncs every account of a telegram user at once
+	synced := make(map[string]bool)
+
+	for _, ghuser := range users {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if synced[ghuser.TelegramUserID] {
+			continue
+		}
+		synced[ghuser.TelegramUserID] = true
+
+		ctx := logging.With(ctx, logging.KeyTelegramUser, ghuser.TelegramUserID)
+
+		added, removed, err2 := p.SyncUser(ctx, ghuser)
+		if err2 != nil {
+			slog.ErrorContext(ctx, "failed to sync repos", logging.Err(err2))
+			continue
+		}
+
+		if len(added) == 0 && len(removed) == 0 {
+			continue
+		}
+
+		chatID, err3 := strconv.ParseInt(ghuser.TelegramUserID, 10, 64)
+		if err3 != nil {
+			slog.ErrorContext(ctx, "wrong telegram user id", logging.Err(err3))
+			continue
+		}
+
+		if err4 := p.send(ctx, "sources_report", p.Renderer.Message(chatID, p.SourcesReport(added, removed))); err4 != nil {
+			slog.ErrorContext(ctx, "failed to send sources report", logging.Err(err4))
+		}
+	}
+
+	return p.syncOwners(ctx)
+}
+
+// each runs fn for every item on at most Workers goroutines
+func (p *Poller) each(ctx context.Context, items []*database.UsersReposResult, fn func(context.Context, *database.UsersReposResult)) {
+	workers := p.Workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+
+	defer metrics.QueueDepth.Set(0)
+
+	for i, item := range items {
+		metrics.QueueDepth.Set(float64(len(items) - i))
+
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return
+		case sem <- struct{}{}:
+		}
+
+		wg.Add(1)
+		go func(item *database.UsersReposResult) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			fn(ctx, item)
+		}(item)
+	}
+
+	wg.Wait()
+}
+
+// destination returns chat to deliver notifications of a subscription to
+func destination(item *database.UsersReposResult) (int64, error) {
+	return chatOf(item.ChatID, item.TelegramUserID)
+}
+
+func chatOf(chatID int64, telegramUserID string) (int64, error) {
+	if chatID != 0 {
+		return chatID, nil
+	}
+
+	return strconv.ParseInt(telegramUserID, 10, 64)
+}
+
+// render formats a notification with the preset and time zone of the subscriber
+func (p *Poller) render(event string, settings *database.TelegramUser, data interface{}) (string, error) {
+	preset := settings.Format
+	if preset == "" {
+		preset = templates.DefaultPreset
+	}
+
+	return p.Templates.RenderIn(event, preset, data, settings.Location())
+}
+
+func (p *Poller) pollRepo(ctx context.Context, item *database.UsersReposResult) {
+	ctx = logging.With(ctx, logging.KeyRepo, item.RepoName, logging.KeyTelegramUser, item.TelegramUserID, "subscription", item.ID)
+
+	chatID, err := destination(item)
+	if err != nil {
+		slog.ErrorContext(ctx, "wrong subscription destination", logging.Err(err))
+		return
+	}
+
+	ctx, span := tracing.Start(ctx, "poll "+item.RepoName,
+		tracing.String("repo", item.RepoName),
+		tracing.Int("subscription", item.ID),
+	)
+	defer span.End()
+
+	start := p.Clock.Now()
+	p.mu.Lock()
+	if last, ok := p.lastPolled[item.ID]; ok {
+		lag := start.Sub(last.at)
+		metrics.PollLag.Observe(lag.Seconds())
+		if p.RepoLabels {
+			metrics.RepoPollLag.Set(lag.Seconds(), item.RepoName)
+		}
+		span.SetAttr(tracing.Int("poll.lag_ms", lag.Milliseconds()))
+	}
+	if p.lastPolled == nil {
+		p.lastPolled = make(map[int64]polled)
+	}
+	p.lastPolled[item.ID] = polled{at: start, repo: item.RepoName}
+	p.mu.Unlock()
+
+	commits, err := p.Github.GetGithubUserRepoCommits(ctx, item)
+	duration := p.Clock.Now().Sub(start)
+	metrics.PollDuration.Observe(duration.Seconds())
+	if p.RepoLabels {
+		metrics.RepoPollDuration.Set(duration.Seconds(), item.RepoName)
+	}
+	if err != nil {
+		span.SetError(err)
+		slog.ErrorContext(ctx, "failed to get commits", logging.Err(err))
+		if err.Error() == database.RepoNotFound {
+			p.removeRepo(ctx, item, chatID)
+		}
+		return
+	}
+
+	span.SetAttr(tracing.Int("commits", int64(len(commits))))
+
+	if len(commits) == 0 {
+		return
+	}
+
+	for _, commit := range commits {
+		if commit.Commit.Author.Date.After(item.UpdatedAt) {
+			item.UpdatedAt = commit.Commit.Author.Date
+		}
+
+		if commit.Commit.Committer.Date.After(item.UpdatedAt) {
+			item.UpdatedAt = commit.Commit.Committer.Date
+		}
+	}
+
+	p.alertCommits(ctx, item, commits)
+
+	// muted subscriptions keep advancing the cursor so unmuting does not
+	// bring old commits back, filters are skipped when nothing is kept
+	muted := item.MutedUntil.After(p.Clock.Now())
+	if !muted || item.MuteSummary {
+		commits = p.filter(ctx, item, commits)
+
+		switch {
+		case len(commits) == 0:
+			slog.DebugContext(ctx, "all new commits filtered out")
+		case !muted:
+			p.deliver(ctx, item, chatID, commits)
+		default:
+			p.queue(ctx, item, commits, database.PendingMuted)
+		}
+	}
+
+	if err := database.UpdateUserRepoLink(ctx, p.DB, item); err != nil {
+		span.SetError(err)
+		slog.ErrorContext(ctx, "failed to update subscription", logging.Err(err))
+	}
+}
+
+// send delivers a notification counting it by reason
+func (p *Poller) send(ctx context.Context, reason string, c tgbotapi.Chattable) error {
+	_, span := tracing.StartChild(ctx, tracing.KindClient, "telegram send", tracing.String("reason", reason))
+	defer span.End()
+
+	_, err := p.Bot.Send(c)
+	metrics.Notifications.Inc(reason, metrics.Status(err))
+	span.SetError(err)
+
+	return err
+}
+
+func (p *Poller) sendCommit(ctx context.Context, item *database.UsersReposResult, chatID int64, commit *ghapi.CommitItem) {
+	text, err := p.render(templates.EventCommit, item.Settings(), templates.NewCommit(item.RepoName, commit))
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to render commit", logging.Err(err))
+		return
+	}
+
+	msg := p.Renderer.Message(chatID, text)
+	if keyboard, err := p.commitKeyboard(item, commit); err == nil {
+		msg.ReplyMarkup = keyboard
+	} else {
+		slog.ErrorContext(ctx, "failed to build buttons", logging.Err(err))
+	}
+	if err := p.send(ctx, templates.EventCommit, msg); err != nil {
+		slog.ErrorContext(ctx, "failed to send commit", logging.Err(err))
+	}
+}
+
+func (p *Poller) removeRepo(ctx context.Context, item *database.UsersReposResult, chatID int64) {
+	if err := database.DeleteUserRepoLink(ctx, p.DB, item); err != nil {
+		slog.ErrorContext(ctx, "failed to remove subscription", logging.Err(err))
+		return
+	}
+
+	slog.InfoContext(ctx, "subscription to a missing repo removed")
+
+	text, err := p.render(templates.EventRepoRemoved, item.Settings(), &templates.RepoRemoved{Repo: item.RepoName, Reason: "not found"})
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to render repo removal", logging.Err(err))
+		return
+	}
+
+	msg := p.Renderer.Message(chatID, text)
+	if err := p.send(ctx, templates.EventRepoRemoved, msg); err != nil {
+		slog.ErrorContext(ctx, "failed to send repo removal", logging.Err(err))
+	}
+}
+
+// commitKeyboard builds notification buttons, callback data carries the
+// subscription id so it stays within telegram limits
+func (p *Poller) commitKeyboard(item *database.UsersReposResult, commit *ghapi.CommitItem) (tgbotapi.InlineKeyboardMarkup, error) {
+	var keyboard tgbotapi.InlineKeyboardMarkup
+
+	row, err := p.subscriptionRow(item)
+	if err != nil {
+		return keyboard, err
+	}
+
+	sha := commit.SHA
+	if len(sha) > ShortSHA {
+		sha = sha[:ShortSHA]
+	}
+
+	diff, err := p.Signer.Sign(ActionDiff, strconv.FormatInt(item.ID, 10), sha)
+	if err != nil {
+		return keyboard, err
+	}
+
+	return tgbotapi.NewInlineKeyboardMarkup(
+		row,
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("Show diff stats", diff),
+			tgbotapi.NewInlineKeyboardButtonURL("Open compare", commit.CompareURL(item.RepoName)),
+		),
+	), nil
+}
+
+// subscriptionRow returns mute and unwatch buttons of a subscription
+func (p *Poller) subscriptionRow(item *database.UsersReposResult) ([]tgbotapi.InlineKeyboardButton, error) {
+	if p.Signer == nil {
+		return nil, fmt.Errorf("no callback signer configured")
+	}
+
+	id := strconv.FormatInt(item.ID, 10)
+
+	mute, err := p.Signer.Sign(ActionMute, id)
+	if err != nil {
+		return nil, err
+	}
+	unwatch, err := p.Signer.Sign(ActionUnwatch, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("Mute repo 1h", mute),
+		tgbotapi.NewInlineKeyboardButtonData("Unwatch", unwatch),
+	), nil
+}
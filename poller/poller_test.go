@@ -0,0 +1,296 @@
+package poller
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	database "github.com/ad/go-githublistener/db"
+	ghapi "github.com/ad/go-githublistener/ghapi"
+	telegram "github.com/ad/go-githublistener/telegram"
+
+	sql "github.com/lazada/sqle"
+	tgbotapi "gopkg.in/telegram-bot-api.v4"
+)
+
+// fakeGithub returns canned commits and repos and records polled repos
+// and fetched commits
+type fakeGithub struct {
+	mu      sync.Mutex
+	commits map[string][]*ghapi.CommitItem
+	owners  map[string][]*ghapi.Repo
+	polled  []string
+	fetched []string
+}
+
+func (g *fakeGithub) GetGithubUserSourceRepos(ctx context.Context, code, username, source string) ([]*ghapi.Repo, error) {
+	return nil, nil
+}
+
+func (g *fakeGithub) GetGithubUserRepoCommits(ctx context.Context, item *database.UsersReposResult) ([]*ghapi.CommitItem, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.polled = append(g.polled, item.RepoName)
+	commits := g.commits[item.RepoName]
+	delete(g.commits, item.RepoName)
+
+	return commits, nil
+}
+
+func (g *fakeGithub) GetGithubCommit(ctx context.Context, code, reponame, sha string) (*ghapi.CommitItem, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.fetched = append(g.fetched, sha)
+
+	return &ghapi.CommitItem{SHA: sha, Files: []ghapi.File{{Filename: "src/main.go"}}}, nil
+}
+
+func (g *fakeGithub) GetGithubRepoPulls(ctx context.Context, code, reponame string) ([]*ghapi.PullRequest, error) {
+	return nil, nil
+}
+
+func (g *fakeGithub) GetGithubRepoReleases(ctx context.Context, code, reponame string) ([]*ghapi.Release, error) {
+	return nil, nil
+}
+
+func (g *fakeGithub) GetGithubOwnerRepos(ctx context.Context, code, owner string, org bool) ([]*ghapi.Repo, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.owners[owner], nil
+}
+
+// takePolled returns repos polled since the last call, sorted
+func (g *fakeGithub) takePolled() []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	polled := g.polled
+	g.polled = nil
+	sort.Strings(polled)
+
+	return polled
+}
+
+// fakeSender records sent messages
+type fakeSender struct {
+	mu   sync.Mutex
+	sent []tgbotapi.Chattable
+}
+
+func (s *fakeSender) Send(c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sent = append(s.sent, c)
+
+	return tgbotapi.Message{}, nil
+}
+
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, err := database.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+// subscribe adds a subscription of telegram user 42 checked last at
+// updated and returns its repo id
+func subscribe(t *testing.T, db *sql.DB, repo string, updated time.Time) int64 {
+	t.Helper()
+
+	if _, err := db.Exec(`INSERT OR IGNORE INTO github_users (id, name, user_name, token, telegram_user_id) VALUES (1, "Octo Cat", "octocat", "token", 42)`); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := db.Exec(`INSERT INTO github_repos (name, repo_name) VALUES (?, ?)`, repo, repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repoID, err := res.LastInsertId()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.Exec(`INSERT INTO users_repos (user_id, repo_id, updated_at) VALUES (1, ?, ?)`, repoID, updated.UTC()); err != nil {
+		t.Fatal(err)
+	}
+
+	return repoID
+}
+
+func commitAt(sha string, date time.Time) *ghapi.CommitItem {
+	commit := &ghapi.CommitItem{SHA: sha, HTMLUrl: "https://github.com/octo/stale/commit/" + sha}
+	commit.Commit.Message = "fix things"
+	commit.Commit.Author = ghapi.Author{Name: "octocat", Date: date}
+	commit.Commit.Committer = ghapi.Committer{Name: "octocat", Date: date}
+
+	return commit
+}
+
+func TestTickPollsStaleSubscriptions(t *testing.T) {
+	now := time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC)
+
+	db := openTestDB(t)
+	subscribe(t, db, "octo/stale", now.Add(-time.Hour))
+	subscribe(t, db, "octo/fresh", now.Add(-5*time.Minute))
+
+	github := &fakeGithub{commits: map[string][]*ghapi.CommitItem{
+		"octo/stale": {commitAt("0123456789abcdef0123456789abcdef01234567", now.Add(-10*time.Minute))},
+	}}
+	bot := &fakeSender{}
+	clock := NewFakeClock(now)
+
+	p := New(db, github, bot)
+	p.Clock = clock
+	p.Signer = telegram.NewSigner("secret")
+
+	if err := p.Tick(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := github.takePolled(), []string{"octo/stale"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("polled %v, want %v", got, want)
+	}
+	if len(bot.sent) != 1 {
+		t.Errorf("sent %d messages, want 1", len(bot.sent))
+	}
+	if stats := p.LastTick(); stats.Subscriptions != 1 || !stats.Started.Equal(now) || stats.Duration != 0 {
+		t.Errorf("last tick %+v, want 1 subscription started at %s by the fake clock", stats, now)
+	}
+
+	// the stale cursor moved to the commit, nothing is due until StaleAfter
+	// passes again
+	if err := p.Tick(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := github.takePolled(); len(got) != 0 {
+		t.Errorf("polled %v right after a tick, want none", got)
+	}
+
+	clock.Advance(p.StaleAfter)
+	if err := p.Tick(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := github.takePolled(), []string{"octo/fresh", "octo/stale"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("polled %v after %s, want %v", got, p.StaleAfter, want)
+	}
+}
+
+func TestTickSkipsFiltersOfMutedSubscriptions(t *testing.T) {
+	now := time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC)
+
+	db := openTestDB(t)
+	repoID := subscribe(t, db, "octo/stale", now.Add(-time.Hour))
+	if _, err := db.Exec(`UPDATE users_repos SET muted_until = ? WHERE repo_id = ?`, now.Add(time.Hour), repoID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO filters (user_id, repo_id, kind, action, pattern) VALUES (1, ?, ?, ?, "src/**")`, repoID, database.FilterPath, database.FilterInclude); err != nil {
+		t.Fatal(err)
+	}
+
+	github := &fakeGithub{commits: map[string][]*ghapi.CommitItem{
+		"octo/stale": {commitAt("0123456789abcdef0123456789abcdef01234567", now.Add(-10*time.Minute))},
+	}}
+	bot := &fakeSender{}
+
+	p := New(db, github, bot)
+	p.Clock = NewFakeClock(now)
+	p.Signer = telegram.NewSigner("secret")
+
+	if err := p.Tick(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(github.fetched) != 0 {
+		t.Errorf("fetched files of %v for a muted subscription", github.fetched)
+	}
+	if len(bot.sent) != 0 {
+		t.Errorf("sent %d messages to a muted subscription", len(bot.sent))
+	}
+
+	// the cursor still moves past the muted commits
+	github.takePolled()
+	if err := p.Tick(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := github.takePolled(); len(got) != 0 {
+		t.Errorf("polled %v again, want the cursor moved", got)
+	}
+}
+
+func TestTickMutedSummary(t *testing.T) {
+	now := time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC)
+
+	for _, summary := range []bool{true, false} {
+		db := openTestDB(t)
+		repoID := subscribe(t, db, "octo/stale", now.Add(-time.Hour))
+		if _, err := database.MuteSubscriptions(db, 1, 0, repoID, now.Add(time.Hour), summary); err != nil {
+			t.Fatal(err)
+		}
+
+		github := &fakeGithub{commits: map[string][]*ghapi.CommitItem{
+			"octo/stale": {
+				commitAt("0123456789abcdef0123456789abcdef01234567", now.Add(-20*time.Minute)),
+				commitAt("1123456789abcdef0123456789abcdef01234567", now.Add(-10*time.Minute)),
+			},
+		}}
+		bot := &fakeSender{}
+		clock := NewFakeClock(now)
+
+		p := New(db, github, bot)
+		p.Clock = clock
+		p.Signer = telegram.NewSigner("secret")
+
+		if err := p.Tick(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		pending, err := database.GetPendingNotifications(context.Background(), db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wantQueued, wantSent := 0, 0
+		if summary {
+			wantQueued, wantSent = 2, 1
+		}
+		if len(pending) != wantQueued {
+			t.Fatalf("summary %t: queued %d commits, want %d", summary, len(pending), wantQueued)
+		}
+		for _, n := range pending {
+			if n.Reason != database.PendingMuted {
+				t.Errorf("summary %t: queued %s for %q, want %q", summary, n.SHA, n.Reason, database.PendingMuted)
+			}
+		}
+
+		// nothing is sent until the mute ends, then the summary
+		if err := p.Digest(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if len(bot.sent) != 0 {
+			t.Errorf("summary %t: sent %d messages while muted", summary, len(bot.sent))
+		}
+
+		clock.Advance(time.Hour)
+		if err := p.Digest(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if len(bot.sent) != wantSent {
+			t.Errorf("summary %t: sent %d messages after the mute, want %d", summary, len(bot.sent), wantSent)
+		}
+		if left, err := database.GetPendingNotifications(context.Background(), db); err != nil || len(left) != 0 {
+			t.Errorf("summary %t: %d commits still queued after the mute, %v", summary, len(left), err)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package poller
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sort"
+
+	database "github.com/ad/go-githublistener/db"
+	ghapi "github.com/ad/go-githublistener/ghapi"
+)
+
+// SyncUser links repos from the sources the user chose except ones removed
+// with /delete, and unlinks repos that left every source. Other github
+// accounts of the same telegram user are synced together, a repo listed by
+// any of them stays linked
+func (p *Poller) SyncUser(ctx context.Context, ghuser *database.GithubUser) (added, removed []string, err error) {
+	accounts, err := database.GetGithubAccounts(p.DB, ghuser.TelegramUserID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// ghuser may carry settings not saved yet
+	for i, account := range accounts {
+		if account.ID == ghuser.ID {
+			accounts[i] = ghuser
+		}
+	}
+
+	return p.syncAccounts(ctx, accounts)
+}
+
+// listing is the first account and source listing a repo
+type listing struct {
+	account *database.GithubUser
+	source  string
+	repo    *ghapi.Repo
+}
+
+func (p *Poller) syncAccounts(ctx context.Context, accounts []*database.GithubUser) (added, removed []string, err error) {
+	if len(accounts) == 0 {
+		return nil, nil, nil
+	}
+
+	var repos []*listing
+	found := make(map[string]*listing)
+	// repos by account and source
+	listed := make(map[int64]map[string]map[string]bool)
+	// a repo missing from a truncated list may still be listed, nothing is
+	// unlinked then
+	truncated := false
+
+	for _, account := range accounts {
+		listed[account.ID] = make(map[string]map[string]bool)
+
+		for _, source := range account.SourceList() {
+			items, err := p.Github.GetGithubUserSourceRepos(ctx, account.Token, account.UserName, source)
+			if errors.Is(err, ghapi.ErrTruncated) {
+				slog.WarnContext(ctx, "too many repos, none are unlinked", "github_user", account.UserName, "source", source, "listed", len(items))
+				truncated = true
+			} else if err != nil {
+				return nil, nil, err
+			}
+
+			listed[account.ID][source] = make(map[string]bool)
+			for _, repo := range items {
+				listed[account.ID][source][repo.FullName] = true
+				if _, ok := found[repo.FullName]; !ok {
+					found[repo.FullName] = &listing{account: account, source: source, repo: repo}
+					repos = append(repos, found[repo.FullName])
+				}
+			}
+		}
+	}
+
+	removedRepos, err := database.GetRemovedRepos(ctx, p.DB, accounts[0].ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	skip := make(map[string]bool)
+	for _, repo := range removedRepos {
+		if _, ok := found[repo.RepoName]; ok || truncated {
+			skip[repo.RepoName] = true
+			continue
+		}
+
+		// gone from github sources of every account as well, adding it
+		// there again should link it
+		if err := database.DeleteRemovedRepo(ctx, p.DB, repo.UserID, repo.RepoID); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	for _, account := range accounts {
+		links, err := database.GetSyncedLinks(ctx, p.DB, account.ID)
+		if err != nil {
+			return added, removed, err
+		}
+
+		for _, link := range links {
+			if listed[link.UserID][link.Source][link.RepoName] || truncated {
+				continue
+			}
+
+			// e.g. unstarred but still watched, maybe by another account
+			if l, ok := found[link.RepoName]; ok {
+				if err := database.SetLinkSource(ctx, p.DB, link.ID, l.account.ID, l.source); err != nil {
+					return added, removed, err
+				}
+				continue
+			}
+
+			if err := database.DeleteUserRepoLink(ctx, p.DB, link); err != nil {
+				return added, removed, err
+			}
+			removed = append(removed, link.RepoName)
+		}
+	}
+
+	for _, l := range repos {
+		if skip[l.repo.FullName] {
+			continue
+		}
+
+		dbrepo, err := database.AddRepoIfNotExist(ctx, p.DB, &database.GithubRepo{Name: l.repo.Name, RepoName: l.repo.FullName})
+		if err != nil && err.Error() != database.AlreadyExists {
+			return added, removed, err
+		}
+
+		if err := database.AddRepoLinkFrom(ctx, p.DB, l.account, dbrepo, 0, l.repo.UpdatedAt, l.source); err != nil {
+			if err.Error() != database.AlreadyExists {
+				return added, removed, err
+			}
+			continue
+		}
+		added = append(added, l.repo.FullName)
+	}
+
+	sort.Strings(added)
+	sort.Strings(removed)
+
+	return added, removed, nil
+}
+
+// SourcesReport describes repos added and removed by SyncUser
+func (p *Poller) SourcesReport(added, removed []string) string {
+	return p.changesReport("Github", added, removed, "repos removed from your sources")
+}
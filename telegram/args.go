@@ -0,0 +1,51 @@
+package telegram
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var repoNameRe = regexp.MustCompile(`^([\w,\-,\_]+)\/([\w,\-,\_]+)$`)
+
+// IsRepoName checks owner/repo format
+func IsRepoName(s string) bool {
+	return repoNameRe.MatchString(s)
+}
+
+// Fields splits arguments on whitespace
+func Fields(raw string) ([]string, error) {
+	return strings.Fields(raw), nil
+}
+
+// RawArg passes the whole argument string as a single optional argument
+func RawArg(raw string) ([]string, error) {
+	if raw == "" {
+		return nil, nil
+	}
+
+	return []string{raw}, nil
+}
+
+// RepoArg expects owner/repo as the first argument
+func RepoArg(raw string) ([]string, error) {
+	args := strings.Fields(raw)
+	if len(args) == 0 || !IsRepoName(args[0]) {
+		return nil, fmt.Errorf("wrong repo format, try username/reponame instead")
+	}
+
+	return args, nil
+}
+
+var ownerNameRe = regexp.MustCompile(`^[\w\-]+$`)
+
+// OwnerArg requires a github organization or user login as the first argument
+func OwnerArg(raw string) ([]string, error) {
+	args := strings.Fields(raw)
+	if len(args) == 0 || !ownerNameRe.MatchString(strings.TrimPrefix(args[0], "@")) {
+		return nil, fmt.Errorf("wrong owner format, try an organization or user login instead")
+	}
+	args[0] = strings.TrimPrefix(args[0], "@")
+
+	return args, nil
+}
@@ -0,0 +1,44 @@
+package telegram
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	tgbotapi "gopkg.in/telegram-bot-api.v4"
+)
+
+// IsGroup reports whether chat is a group or supergroup
+func IsGroup(chat *tgbotapi.Chat) bool {
+	return chat != nil && (chat.IsGroup() || chat.IsSuperGroup())
+}
+
+// ResolveChat looks up a chat by @username or numeric id
+func ResolveChat(bot *Bot, ref string) (tgbotapi.Chat, error) {
+	config := tgbotapi.ChatConfig{}
+
+	if id, err := strconv.ParseInt(ref, 10, 64); err == nil {
+		config.ChatID = id
+	} else if strings.HasPrefix(ref, "@") {
+		config.SuperGroupUsername = ref
+	} else {
+		return tgbotapi.Chat{}, fmt.Errorf("wrong chat format, try @channel or chat id instead")
+	}
+
+	chat, err := bot.GetChat(config)
+	if err != nil {
+		return chat, fmt.Errorf("chat %s not found, add bot to it first", ref)
+	}
+
+	return chat, nil
+}
+
+// IsChatAdmin reports whether user is creator or administrator of chat
+func IsChatAdmin(bot *Bot, chatID int64, userID int) (bool, error) {
+	member, err := bot.GetChatMember(tgbotapi.ChatConfigWithUser{ChatID: chatID, UserID: userID})
+	if err != nil {
+		return false, err
+	}
+
+	return member.IsCreator() || member.IsAdministrator(), nil
+}
@@ -0,0 +1,129 @@
+package telegram
+
+import (
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"strconv"
+	"sync"
+	"time"
+
+	database "github.com/ad/go-githublistener/db"
+	logging "github.com/ad/go-githublistener/logging"
+
+	sql "github.com/lazada/sqle"
+)
+
+// Logging logs every command with its duration and error
+func Logging() Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(c *Context) error {
+			start := time.Now()
+			err := next(c)
+
+			if err != nil {
+				slog.ErrorContext(c.Context(), "command failed", "duration", time.Since(start), logging.Err(err))
+			} else {
+				slog.DebugContext(c.Context(), "command done", "duration", time.Since(start))
+			}
+
+			return err
+		}
+	}
+}
+
+// Recover turns handler panics into errors
+func Recover() Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(c *Context) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					slog.ErrorContext(c.Context(), "command panicked", "panic", r, "stack", string(debug.Stack()))
+					_ = c.deny("internal error, try again later")
+					err = fmt.Errorf("panic: %v", r)
+				}
+			}()
+
+			return next(c)
+		}
+	}
+}
+
+// UserLookup loads the linked github user of the message author
+func UserLookup(db *sql.DB) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(c *Context) error {
+			if c.UserID() != 0 {
+				if user, err := database.GetGithubUserFromDB(db, strconv.Itoa(c.UserID())); err == nil {
+					c.User = user
+					c.With("github_user", user.UserName)
+				} else if err.Error() != database.UserNotFound {
+					return err
+				}
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// RateLimit allows at most limit commands per user within window
+func RateLimit(limit int, window time.Duration) Middleware {
+	type bucket struct {
+		start time.Time
+		count int
+	}
+
+	var mu sync.Mutex
+	buckets := make(map[int]*bucket)
+
+	return func(next HandlerFunc) HandlerFunc {
+		return func(c *Context) error {
+			now := time.Now()
+
+			mu.Lock()
+			for id, b := range buckets {
+				if now.Sub(b.start) >= window {
+					delete(buckets, id)
+				}
+			}
+			b, ok := buckets[c.UserID()]
+			if !ok {
+				b = &bucket{start: now}
+				buckets[c.UserID()] = b
+			}
+			b.count++
+			count := b.count
+			mu.Unlock()
+
+			if count > limit {
+				if count == limit+1 {
+					return c.deny("too many commands, slow down")
+				}
+				return nil
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// Banned ignores commands and button presses of banned telegram users
+func Banned(db *sql.DB) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(c *Context) error {
+			if c.UserID() != 0 && !c.Router.Admins[c.UserID()] {
+				banned, err := database.IsBanned(db, strconv.Itoa(c.UserID()))
+				if err != nil {
+					return err
+				}
+				if banned {
+					slog.DebugContext(c.Context(), "command from a banned user ignored")
+					return c.Answer("")
+				}
+			}
+
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,20 @@
+package telegram
+
+import (
+	"regexp"
+
+	logging "github.com/ad/go-githublistener/logging"
+)
+
+// Redacted replaces secrets in logged messages
+const Redacted = logging.Redacted
+
+// /start carries the github access token from the oauth redirect
+var startArgRe = regexp.MustCompile(`(?is)^(/start(?:group)?(?:@\w+)?)\s+\S.*$`)
+
+// Redact removes access tokens from message text before it is logged
+func Redact(text string) string {
+	text = startArgRe.ReplaceAllString(text, "$1 "+Redacted)
+
+	return logging.Redact(text)
+}
@@ -0,0 +1,181 @@
+package telegram
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+
+	tgbotapi "gopkg.in/telegram-bot-api.v4"
+)
+
+// Mode supported by Renderer
+type Mode string
+
+// Parse modes
+const (
+	ModeHTML       Mode = "HTML"
+	ModeMarkdownV2 Mode = "MarkdownV2"
+)
+
+// ParseMode validates parse mode name, the legacy Markdown mode is rejected
+// as it escapes differently from MarkdownV2
+func ParseMode(s string) (Mode, error) {
+	switch strings.ToLower(s) {
+	case "", "html":
+		return ModeHTML, nil
+	case "markdownv2":
+		return ModeMarkdownV2, nil
+	case "markdown":
+		return "", fmt.Errorf("legacy parse mode %q is not supported, use HTML or MarkdownV2", s)
+	}
+
+	return "", fmt.Errorf("unknown parse mode %q, use HTML or MarkdownV2", s)
+}
+
+// Renderer formats message text escaping every user provided value
+type Renderer struct {
+	Mode Mode
+}
+
+// DefaultRenderer ...
+var DefaultRenderer = Renderer{Mode: ModeHTML}
+
+var markdownV2Escaper = strings.NewReplacer(
+	`\`, `\\`, `_`, `\_`, `*`, `\*`, `[`, `\[`, `]`, `\]`, `(`, `\(`, `)`, `\)`,
+	`~`, `\~`, "`", "\\`", `>`, `\>`, `#`, `\#`, `+`, `\+`, `-`, `\-`, `=`, `\=`,
+	`|`, `\|`, `{`, `\{`, `}`, `\}`, `.`, `\.`, `!`, `\!`,
+)
+
+var markdownV2CodeEscaper = strings.NewReplacer(`\`, `\\`, "`", "\\`")
+
+var markdownV2URLEscaper = strings.NewReplacer(`\`, `\\`, `)`, `\)`)
+
+// Escape makes s safe to put into message text
+func (r Renderer) Escape(s string) string {
+	if r.Mode == ModeMarkdownV2 {
+		return markdownV2Escaper.Replace(s)
+	}
+
+	return html.EscapeString(s)
+}
+
+// Bold ...
+func (r Renderer) Bold(s string) string {
+	if r.Mode == ModeMarkdownV2 {
+		return "*" + r.Escape(s) + "*"
+	}
+
+	return "<b>" + r.Escape(s) + "</b>"
+}
+
+// Italic ...
+func (r Renderer) Italic(s string) string {
+	if r.Mode == ModeMarkdownV2 {
+		return "_" + r.Escape(s) + "_"
+	}
+
+	return "<i>" + r.Escape(s) + "</i>"
+}
+
+// Code ...
+func (r Renderer) Code(s string) string {
+	if r.Mode == ModeMarkdownV2 {
+		return "`" + markdownV2CodeEscaper.Replace(s) + "`"
+	}
+
+	return "<code>" + r.Escape(s) + "</code>"
+}
+
+// Pre ...
+func (r Renderer) Pre(s string) string {
+	if r.Mode == ModeMarkdownV2 {
+		return "```\n" + markdownV2CodeEscaper.Replace(s) + "\n```"
+	}
+
+	return "<pre>" + r.Escape(s) + "</pre>"
+}
+
+// Link ...
+func (r Renderer) Link(text, url string) string {
+	if r.Mode == ModeMarkdownV2 {
+		return "[" + r.Escape(text) + "](" + markdownV2URLEscaper.Replace(url) + ")"
+	}
+
+	return `<a href="` + html.EscapeString(url) + `">` + r.Escape(text) + "</a>"
+}
+
+// RepoLink links owner/repo to its github page
+func (r Renderer) RepoLink(repoName string) string {
+	return r.Link(repoName, "https://github.com/"+repoName)
+}
+
+// Message creates a formatted message, text must be built with the renderer
+func (r Renderer) Message(chatID int64, text string) tgbotapi.MessageConfig {
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ParseMode = string(r.Mode)
+	msg.DisableWebPagePreview = true
+
+	return msg
+}
+
+// Plain converts formatted text back to plain text
+func Plain(text string, mode string) string {
+	switch Mode(mode) {
+	case ModeHTML:
+		return stripHTML(text)
+	case ModeMarkdownV2:
+		return stripMarkdownV2(text)
+	}
+
+	return text
+}
+
+var (
+	htmlLinkRe = regexp.MustCompile(`(?s)<a href="([^"]*)">(.*?)</a>`)
+	htmlTagRe  = regexp.MustCompile(`</?[a-zA-Z][^>]*>`)
+)
+
+func stripHTML(text string) string {
+	text = htmlLinkRe.ReplaceAllStringFunc(text, func(link string) string {
+		m := htmlLinkRe.FindStringSubmatch(link)
+		if m[2] == m[1] {
+			return m[2]
+		}
+		return m[2] + " (" + m[1] + ")"
+	})
+	text = htmlTagRe.ReplaceAllString(text, "")
+
+	return html.UnescapeString(text)
+}
+
+func stripMarkdownV2(text string) string {
+	var b strings.Builder
+
+	for i := 0; i < len(text); i++ {
+		switch ch := text[i]; ch {
+		case '\\':
+			if i+1 < len(text) {
+				i++
+				b.WriteByte(text[i])
+			}
+		case '*', '_', '~', '|', '`', '[':
+		case ']':
+			if i+1 < len(text) && text[i+1] == '(' {
+				// copy link url verbatim
+				b.WriteString(" (")
+				for i += 2; i < len(text) && text[i] != ')'; i++ {
+					if text[i] == '\\' && i+1 < len(text) {
+						i++
+					}
+					b.WriteByte(text[i])
+				}
+				b.WriteByte(')')
+			}
+		default:
+			b.WriteByte(ch)
+		}
+	}
+
+	return b.String()
+}
@@ -0,0 +1,72 @@
+package telegram
+
+import "testing"
+
+func TestParseMode(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Mode
+		wantErr bool
+	}{
+		{"", ModeHTML, false},
+		{"HTML", ModeHTML, false},
+		{"html", ModeHTML, false},
+		{"MarkdownV2", ModeMarkdownV2, false},
+		{"markdownv2", ModeMarkdownV2, false},
+		{"Markdown", "", true},
+		{"markdown", "", true},
+		{"text", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseMode(tt.in)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("ParseMode(%q) = %q, %v, want %q, error %t", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestEscape(t *testing.T) {
+	tests := []struct {
+		mode Mode
+		in   string
+		want string
+	}{
+		{ModeHTML, "plain text", "plain text"},
+		{ModeHTML, `<b>a & "b"</b>`, "&lt;b&gt;a &amp; &#34;b&#34;&lt;/b&gt;"},
+		{ModeMarkdownV2, "plain text", "plain text"},
+		{ModeMarkdownV2, "v1.2-rc_1 (fix) [x]!", `v1\.2\-rc\_1 \(fix\) \[x\]\!`},
+		{ModeMarkdownV2, "*_~`>#+=|{}", "\\*\\_\\~\\`\\>\\#\\+\\=\\|\\{\\}"},
+		{ModeMarkdownV2, `a\b`, `a\\b`},
+	}
+
+	for _, tt := range tests {
+		if got := (Renderer{Mode: tt.mode}).Escape(tt.in); got != tt.want {
+			t.Errorf("%s Escape(%q) = %q, want %q", tt.mode, tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestPlainReversesRenderer(t *testing.T) {
+	const text = `fix <a> & [b] (c) v1.2_x *y*`
+
+	for _, mode := range []Mode{ModeHTML, ModeMarkdownV2} {
+		r := Renderer{Mode: mode}
+
+		tests := []struct {
+			in   string
+			want string
+		}{
+			{r.Escape(text), text},
+			{r.Bold(text), text},
+			{r.Code("a`b\\c"), "a`b\\c"},
+			{r.Link(text, "https://example.com/a_(b)"), text + " (https://example.com/a_(b))"},
+		}
+
+		for _, tt := range tests {
+			if got := Plain(tt.in, string(mode)); got != tt.want {
+				t.Errorf("%s Plain(%q) = %q, want %q", mode, tt.in, got, tt.want)
+			}
+		}
+	}
+}
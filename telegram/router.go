@@ -0,0 +1,512 @@
+package telegram
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strconv"
+	"strings"
+
+	database "github.com/ad/go-githublistener/db"
+	logging "github.com/ad/go-githublistener/logging"
+	metrics "github.com/ad/go-githublistener/metrics"
+	tracing "github.com/ad/go-githublistener/tracing"
+
+	tgbotapi "gopkg.in/telegram-bot-api.v4"
+)
+
+// Auth is the access level a command requires
+type Auth int
+
+// Access levels
+const (
+	AuthNone Auth = iota
+	AuthUser
+	// AuthChatAdmin additionally requires admin rights when used in a group
+	AuthChatAdmin
+	// AuthAdmin is for bot operators listed in Router.Admins, a linked
+	// github account is not needed
+	AuthAdmin
+)
+
+// HandlerFunc ...
+type HandlerFunc func(c *Context) error
+
+// Middleware wraps a HandlerFunc
+type Middleware func(HandlerFunc) HandlerFunc
+
+// ArgsParser splits and validates raw command arguments
+type ArgsParser func(raw string) ([]string, error)
+
+// Handler describes a single bot command
+type Handler struct {
+	Name        string
+	Description string
+	Usage       string
+	Args        ArgsParser
+	Auth        Auth
+	Hidden      bool
+	Aliases     []string
+	Handle      HandlerFunc
+}
+
+// Context is passed to every handler, for button presses Callback is set
+// and Message is the message carrying the keyboard
+type Context struct {
+	Bot      *Bot
+	Router   *Router
+	Update   tgbotapi.Update
+	Message  *tgbotapi.Message
+	Callback *tgbotapi.CallbackQuery
+	Handler  *Handler
+	Command  string
+	RawArgs  string
+	Args     []string
+	User     *database.GithubUser
+
+	ctx      context.Context
+	answered bool
+}
+
+// Context returns context of the update, it carries log fields of the
+// user, chat and command
+func (c *Context) Context() context.Context {
+	if c.ctx == nil {
+		return context.Background()
+	}
+
+	return c.ctx
+}
+
+// Background returns a copy of c for work that outlives the handler, its
+// context keeps log fields, is never canceled and carries a new span the
+// caller ends
+func (c *Context) Background(name string, attrs ...tracing.Attr) (*Context, *tracing.Span) {
+	ctx, span := tracing.Start(context.WithoutCancel(c.Context()), name, attrs...)
+
+	bg := *c
+	bg.ctx = ctx
+
+	return &bg, span
+}
+
+// With adds log fields to records logged with Context
+func (c *Context) With(args ...any) {
+	c.ctx = logging.With(c.Context(), args...)
+}
+
+// UserID returns telegram id of the message author or the user who pressed a button
+func (c *Context) UserID() int {
+	if c.Callback != nil {
+		return c.Callback.From.ID
+	}
+
+	if c.Message == nil || c.Message.From == nil {
+		return 0
+	}
+
+	return c.Message.From.ID
+}
+
+// Answer acknowledges a button press, text is shown as a toast
+func (c *Context) Answer(text string) error {
+	if c.Callback == nil || c.answered {
+		return nil
+	}
+	c.answered = true
+
+	_, span := tracing.StartChild(c.Context(), tracing.KindClient, "telegram answerCallbackQuery")
+	defer span.End()
+
+	_, err := c.Bot.AnswerCallbackQuery(tgbotapi.NewCallback(c.Callback.ID, text))
+	metrics.TelegramRequests.Inc("AnswerCallbackQuery", metrics.Status(err))
+	span.SetError(err)
+
+	return err
+}
+
+// Arg returns i-th parsed argument or empty string
+func (c *Context) Arg(i int) string {
+	if i < len(c.Args) {
+		return c.Args[i]
+	}
+
+	return ""
+}
+
+// Send ...
+func (c *Context) Send(msg tgbotapi.Chattable) error {
+	_, span := tracing.StartChild(c.Context(), tracing.KindClient, "telegram send", tracing.String("reason", "reply"))
+	defer span.End()
+
+	_, err := c.Bot.Send(msg)
+	span.SetError(err)
+
+	return err
+}
+
+// Reply sends plain text as a reply to the current message
+func (c *Context) Reply(text string) error {
+	msg := tgbotapi.NewMessage(c.Message.Chat.ID, text)
+	msg.ReplyToMessageID = c.Message.MessageID
+
+	return c.Send(msg)
+}
+
+// ReplyFormatted sends text built with c.Bot.Renderer as a reply to the current message
+func (c *Context) ReplyFormatted(text string) error {
+	msg := c.Bot.Renderer.Message(c.Message.Chat.ID, text)
+	msg.ReplyToMessageID = c.Message.MessageID
+
+	return c.Send(msg)
+}
+
+// Edit replaces text and keyboard of the message carrying the pressed button
+func (c *Context) Edit(text string, keyboard *tgbotapi.InlineKeyboardMarkup) error {
+	edit := tgbotapi.NewEditMessageText(c.Message.Chat.ID, c.Message.MessageID, text)
+	edit.ParseMode = string(c.Bot.Renderer.Mode)
+	edit.DisableWebPagePreview = true
+	edit.ReplyMarkup = keyboard
+
+	return c.Send(edit)
+}
+
+// Router dispatches commands and button presses to registered handlers
+type Router struct {
+	bot        *Bot
+	handlers   map[string]*Handler
+	callbacks  map[string]*Handler
+	order      []*Handler
+	help       *Handler
+	middleware []Middleware
+
+	// Signer verifies callback data of inline buttons
+	Signer *Signer
+
+	// Unauthorized is sent when a command needs a linked github account
+	Unauthorized string
+	// Unknown is sent for unregistered commands
+	Unknown string
+
+	// Admins are telegram ids allowed to run AuthAdmin handlers
+	Admins map[int]bool
+}
+
+// NewRouter ...
+func NewRouter(bot *Bot) *Router {
+	r := &Router{
+		bot:          bot,
+		handlers:     make(map[string]*Handler),
+		callbacks:    make(map[string]*Handler),
+		Unauthorized: "type /start",
+		Unknown:      "I don't know that command",
+	}
+
+	r.help = &Handler{
+		Name:        "help",
+		Description: "list available commands",
+		Handle: func(c *Context) error {
+			return c.Reply(r.Help())
+		},
+	}
+
+	return r
+}
+
+// Use appends middleware, the first one added is the outermost
+func (r *Router) Use(mw ...Middleware) {
+	r.middleware = append(r.middleware, mw...)
+}
+
+// Handle registers a command, replacing an existing one with the same name
+func (r *Router) Handle(h Handler) {
+	handler := &h
+
+	if old, ok := r.handlers[h.Name]; ok {
+		for i, item := range r.order {
+			if item == old {
+				r.order = append(r.order[:i], r.order[i+1:]...)
+				break
+			}
+		}
+	}
+
+	r.order = append(r.order, handler)
+	r.handlers[h.Name] = handler
+	for _, alias := range h.Aliases {
+		r.handlers[alias] = handler
+	}
+}
+
+// HandleCallback registers a handler for signed inline button data with the given action
+func (r *Router) HandleCallback(h Handler) {
+	r.callbacks[h.Name] = &h
+}
+
+// Button builds an inline button carrying signed callback data
+func (r *Router) Button(text, action string, args ...string) (tgbotapi.InlineKeyboardButton, error) {
+	data, err := r.Signer.Sign(action, args...)
+	if err != nil {
+		return tgbotapi.InlineKeyboardButton{}, err
+	}
+
+	return tgbotapi.NewInlineKeyboardButtonData(text, data), nil
+}
+
+// Pager builds Prev/Next buttons for page of pages, pressing a button
+// calls action with args followed by the new page number
+func (r *Router) Pager(page, pages int, action string, args ...string) (*tgbotapi.InlineKeyboardMarkup, error) {
+	if pages < 2 {
+		return nil, nil
+	}
+
+	var row []tgbotapi.InlineKeyboardButton
+	if page > 0 {
+		button, err := r.Button("‹ Prev", action, append(args, strconv.Itoa(page-1))...)
+		if err != nil {
+			return nil, err
+		}
+		row = append(row, button)
+	}
+	if page < pages-1 {
+		button, err := r.Button("Next ›", action, append(args, strconv.Itoa(page+1))...)
+		if err != nil {
+			return nil, err
+		}
+		row = append(row, button)
+	}
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(row)
+
+	return &keyboard, nil
+}
+
+// Paginate groups lines into pages of at most perPage lines that fit into a single message
+func Paginate(lines []string, perPage int) [][]string {
+	var pages [][]string
+	var page []string
+	length := 0
+
+	for _, line := range lines {
+		if len(page) > 0 && (len(page) >= perPage || length+TextLength(line)+1 > MaxMessageLength-256) {
+			pages = append(pages, page)
+			page, length = nil, 0
+		}
+		page = append(page, line)
+		length += TextLength(line) + 1
+	}
+
+	if len(page) > 0 {
+		pages = append(pages, page)
+	}
+
+	return pages
+}
+
+// Dispatch routes a command message or a button press to its handler
+func (r *Router) Dispatch(update tgbotapi.Update) {
+	var c *Context
+
+	switch {
+	case update.CallbackQuery != nil:
+		c = r.callbackContext(update)
+	case update.Message != nil && update.Message.IsCommand():
+		c = &Context{
+			Bot:     r.bot,
+			Router:  r,
+			Update:  update,
+			Message: update.Message,
+			Command: update.Message.Command(),
+			RawArgs: strings.TrimSpace(update.Message.CommandArguments()),
+		}
+		c.Handler = r.lookup(c.Command)
+	}
+
+	if c == nil {
+		return
+	}
+
+	c.With(logging.KeyTelegramUser, c.UserID(), logging.KeyCommand, c.Command)
+	if c.Message != nil && c.Message.Chat != nil && !c.Message.Chat.IsPrivate() {
+		c.With(logging.KeyChat, c.Message.Chat.ID)
+	}
+
+	// unknown commands share one span name to keep names bounded
+	name := "telegram unknown"
+	if c.Handler != nil {
+		name = "telegram /" + c.Command
+	}
+	ctx, span := tracing.StartKind(c.Context(), tracing.KindServer, name,
+		tracing.String("command", c.Command),
+		tracing.Bool("callback", c.Callback != nil),
+	)
+	defer span.End()
+	c.ctx = ctx
+
+	handle := r.serve
+	for i := len(r.middleware) - 1; i >= 0; i-- {
+		handle = r.middleware[i](handle)
+	}
+
+	// failed commands are logged by the Logging middleware
+	if err := handle(c); err != nil {
+		span.SetError(err)
+	}
+
+	if err := c.Answer(""); err != nil {
+		slog.ErrorContext(c.Context(), "failed to answer callback", logging.Err(err))
+	}
+}
+
+func (r *Router) callbackContext(update tgbotapi.Update) *Context {
+	query := update.CallbackQuery
+
+	c := &Context{
+		Bot:      r.bot,
+		Router:   r,
+		Update:   update,
+		Message:  query.Message,
+		Callback: query,
+	}
+
+	if r.Signer == nil || query.Message == nil {
+		_ = c.Answer("")
+		return nil
+	}
+
+	action, args, err := r.Signer.Verify(query.Data)
+	if err != nil {
+		slog.Error("wrong callback data", logging.KeyTelegramUser, query.From.ID, logging.Err(err))
+		_ = c.Answer("this button is not valid anymore")
+		return nil
+	}
+
+	c.Command = action
+	c.Args = args
+	c.Handler = r.callbacks[action]
+
+	return c
+}
+
+func (r *Router) lookup(name string) *Handler {
+	if h, ok := r.handlers[name]; ok {
+		return h
+	}
+
+	if name == r.help.Name {
+		return r.help
+	}
+
+	return nil
+}
+
+// deny tells user why the handler was not run
+func (c *Context) deny(text string) error {
+	if c.Callback != nil {
+		return c.Answer(text)
+	}
+
+	return c.Reply(text)
+}
+
+func (r *Router) serve(c *Context) error {
+	if c.Handler == nil {
+		return c.deny(r.Unknown)
+	}
+
+	if c.Handler.Auth == AuthAdmin {
+		// look like an unknown command to everyone else
+		if !r.Admins[c.UserID()] {
+			return c.deny(r.Unknown)
+		}
+	} else if c.Handler.Auth >= AuthUser && c.User == nil {
+		return c.deny(r.Unauthorized)
+	}
+
+	if c.Handler.Auth == AuthChatAdmin && IsGroup(c.Message.Chat) {
+		admin, err := IsChatAdmin(c.Bot, c.Message.Chat.ID, c.UserID())
+		if err != nil {
+			return err
+		}
+		if !admin {
+			return c.deny("only chat admins can do that")
+		}
+	}
+
+	if c.Callback == nil && c.Handler.Args != nil {
+		args, err := c.Handler.Args(c.RawArgs)
+		if err != nil {
+			text := err.Error()
+			if c.Handler.Usage != "" {
+				text += "\nusage: /" + c.Handler.Name + " " + c.Handler.Usage
+			}
+			return c.Reply(text)
+		}
+		c.Args = args
+	}
+
+	return c.Handler.Handle(c)
+}
+
+// Help builds command list from the handler table
+func (r *Router) Help() string {
+	var lines []string
+
+	for _, h := range r.visible() {
+		line := "/" + h.Name
+		if h.Usage != "" {
+			line += " " + h.Usage
+		}
+		if h.Description != "" {
+			line += " - " + h.Description
+		}
+		lines = append(lines, line)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// RegisterCommands publishes the handler table with setMyCommands
+func (r *Router) RegisterCommands() error {
+	type botCommand struct {
+		Command     string `json:"command"`
+		Description string `json:"description"`
+	}
+
+	var commands []botCommand
+	for _, h := range r.visible() {
+		description := h.Description
+		if description == "" {
+			description = h.Name
+		}
+		commands = append(commands, botCommand{Command: h.Name, Description: description})
+	}
+
+	data, err := json.Marshal(commands)
+	if err != nil {
+		return err
+	}
+
+	if _, err := r.bot.MakeRequest("setMyCommands", url.Values{"commands": {string(data)}}); err != nil {
+		return fmt.Errorf("setMyCommands: %s", err)
+	}
+
+	return nil
+}
+
+func (r *Router) visible() []*Handler {
+	var result []*Handler
+	for _, h := range r.order {
+		if !h.Hidden {
+			result = append(result, h)
+		}
+	}
+
+	if _, ok := r.handlers["help"]; !ok {
+		result = append(result, r.help)
+	}
+
+	return result
+}
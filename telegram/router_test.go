@@ -0,0 +1,243 @@
+package telegram
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	database "github.com/ad/go-githublistener/db"
+	logging "github.com/ad/go-githublistener/logging"
+
+	tgbotapi "gopkg.in/telegram-bot-api.v4"
+)
+
+type roundTripFunc func(r *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+// sentTexts records text of messages and callback answers sent by a bot
+type sentTexts struct {
+	mu    sync.Mutex
+	texts []string
+}
+
+func (s *sentTexts) take() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	texts := s.texts
+	s.texts = nil
+
+	return texts
+}
+
+// testBot returns a bot that answers every api request with success
+func testBot(t *testing.T) (*Bot, *sentTexts) {
+	t.Helper()
+
+	sent := &sentTexts{}
+	client := &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+
+		sent.mu.Lock()
+		sent.texts = append(sent.texts, r.PostForm.Get("text"))
+		sent.mu.Unlock()
+
+		body := `{"ok":true,"result":{"message_id":2,"date":0,"chat":{"id":1,"type":"private"}}}`
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(body)), Header: make(http.Header)}, nil
+	})}
+
+	return &Bot{BotAPI: &tgbotapi.BotAPI{Token: "test", Client: client}, Renderer: DefaultRenderer}, sent
+}
+
+// commandUpdate is a private message of user with a command
+func commandUpdate(userID int, text string) tgbotapi.Update {
+	command := strings.Fields(text)[0]
+
+	return tgbotapi.Update{Message: &tgbotapi.Message{
+		MessageID: 1,
+		From:      &tgbotapi.User{ID: userID},
+		Chat:      &tgbotapi.Chat{ID: int64(userID), Type: "private"},
+		Text:      text,
+		Entities:  &[]tgbotapi.MessageEntity{{Type: "bot_command", Length: len(command)}},
+	}}
+}
+
+func TestDispatchParsesCommand(t *testing.T) {
+	bot, sent := testBot(t)
+	r := NewRouter(bot)
+
+	var got []string
+	r.Handle(Handler{
+		Name:    "filter",
+		Aliases: []string{"f"},
+		Args:    Fields,
+		Handle: func(c *Context) error {
+			got = append([]string{c.Command}, c.Args...)
+			return nil
+		},
+	})
+	r.Handle(Handler{
+		Name:  "add",
+		Usage: "owner/repo",
+		Args:  RepoArg,
+		Handle: func(c *Context) error {
+			t.Errorf("/add ran with wrong arguments %v", c.Args)
+			return nil
+		},
+	})
+
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"/filter octo/repo  include path src/**", []string{"filter", "octo/repo", "include", "path", "src/**"}},
+		{"/filter@listener_bot octo/repo exclude author bot", []string{"filter", "octo/repo", "exclude", "author", "bot"}},
+		{"/f@listener_bot", []string{"f"}},
+	}
+
+	for _, tt := range tests {
+		got = nil
+		r.Dispatch(commandUpdate(1, tt.text))
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Dispatch(%q) ran with %q, want %q", tt.text, got, tt.want)
+		}
+	}
+	if texts := sent.take(); len(texts) != 0 {
+		t.Errorf("sent %q, want nothing", texts)
+	}
+
+	r.Dispatch(commandUpdate(1, "/add@listener_bot octo"))
+	if texts, want := sent.take(), []string{"wrong repo format, try username/reponame instead\nusage: /add owner/repo"}; !reflect.DeepEqual(texts, want) {
+		t.Errorf("sent %q for wrong arguments, want %q", texts, want)
+	}
+
+	r.Dispatch(commandUpdate(1, "/missing@listener_bot now"))
+	if texts, want := sent.take(), []string{r.Unknown}; !reflect.DeepEqual(texts, want) {
+		t.Errorf("sent %q for an unknown command, want %q", texts, want)
+	}
+}
+
+func TestDispatchAuth(t *testing.T) {
+	bot, sent := testBot(t)
+	r := NewRouter(bot)
+	r.Admins = map[int]bool{7: true}
+
+	db, err := database.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := database.BanTelegramUser(db, "13"); err != nil {
+		t.Fatal(err)
+	}
+	r.Use(Banned(db))
+
+	var ran []string
+	handle := func(c *Context) error {
+		ran = append(ran, c.Command)
+		return nil
+	}
+	r.Handle(Handler{Name: "list", Auth: AuthUser, Handle: handle})
+	r.Handle(Handler{Name: "stats", Auth: AuthAdmin, Handle: handle})
+	r.Handle(Handler{Name: "about", Handle: handle})
+
+	tests := []struct {
+		userID int
+		text   string
+		ran    bool
+		reply  string
+	}{
+		{1, "/about", true, ""},
+		{1, "/list", false, r.Unauthorized},
+		{1, "/stats", false, r.Unknown},
+		{7, "/stats", true, ""},
+		{13, "/about", false, ""},
+	}
+
+	for _, tt := range tests {
+		ran = nil
+		r.Dispatch(commandUpdate(tt.userID, tt.text))
+
+		if got := len(ran) == 1; got != tt.ran {
+			t.Errorf("user %d %s ran = %t, want %t", tt.userID, tt.text, got, tt.ran)
+		}
+
+		var want []string
+		if tt.reply != "" {
+			want = []string{tt.reply}
+		}
+		if texts := sent.take(); !reflect.DeepEqual(texts, want) {
+			t.Errorf("user %d %s sent %q, want %q", tt.userID, tt.text, texts, want)
+		}
+	}
+}
+
+func TestRateLimitRefills(t *testing.T) {
+	bot, sent := testBot(t)
+	const window = 50 * time.Millisecond
+
+	ran := 0
+	handle := RateLimit(2, window)(func(c *Context) error {
+		ran++
+		return nil
+	})
+	run := func(userID int) {
+		update := commandUpdate(userID, "/list")
+		if err := handle(&Context{Bot: bot, Update: update, Message: update.Message}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := 0; i < 4; i++ {
+		run(1)
+	}
+	if ran != 2 {
+		t.Errorf("ran %d of 4 commands, want 2", ran)
+	}
+	// only the first rejected command gets an answer
+	if texts, want := sent.take(), []string{"too many commands, slow down"}; !reflect.DeepEqual(texts, want) {
+		t.Errorf("sent %q, want %q", texts, want)
+	}
+
+	// other users have their own limit
+	run(2)
+	if ran != 3 {
+		t.Errorf("ran %d commands, want a command of another user to run", ran)
+	}
+
+	time.Sleep(window)
+	run(1)
+	if ran != 4 {
+		t.Errorf("ran %d commands, want the limit refilled after %s", ran, window)
+	}
+}
+
+func TestContextBackground(t *testing.T) {
+	ctx, cancel := context.WithCancel(logging.With(context.Background(), logging.KeyCommand, "broadcast"))
+	c := &Context{Command: "broadcast", ctx: ctx}
+
+	bg, span := c.Background("broadcast")
+	defer span.End()
+	cancel()
+
+	if err := bg.Context().Err(); err != nil {
+		t.Errorf("background context ended with the command: %v", err)
+	}
+	if attrs := logging.Attrs(bg.Context()); len(attrs) != 1 || attrs[0].Value.String() != "broadcast" {
+		t.Errorf("background log fields %v, want the command", attrs)
+	}
+	if bg == c || bg.Command != c.Command {
+		t.Errorf("Background returned %p of %p, want a copy", bg, c)
+	}
+}
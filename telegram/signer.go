@@ -0,0 +1,66 @@
+package telegram
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// MaxCallbackData is the telegram limit for callback_data
+const MaxCallbackData = 64
+
+const callbackSeparator = ":"
+
+// Signer signs callback data so buttons can't be forged
+type Signer struct {
+	key []byte
+}
+
+// NewSigner ...
+func NewSigner(secret string) *Signer {
+	return &Signer{key: []byte(secret)}
+}
+
+// Sign joins action and args and appends a truncated hmac
+func (s *Signer) Sign(action string, args ...string) (string, error) {
+	for _, arg := range append([]string{action}, args...) {
+		if strings.Contains(arg, callbackSeparator) {
+			return "", fmt.Errorf("callback argument %q contains %q", arg, callbackSeparator)
+		}
+	}
+
+	payload := strings.Join(append([]string{action}, args...), callbackSeparator)
+	data := payload + callbackSeparator + s.mac(payload)
+
+	if len(data) > MaxCallbackData {
+		return "", fmt.Errorf("callback data %q is too long", data)
+	}
+
+	return data, nil
+}
+
+// Verify checks the signature and returns action with its args
+func (s *Signer) Verify(data string) (string, []string, error) {
+	i := strings.LastIndex(data, callbackSeparator)
+	if i < 0 {
+		return "", nil, fmt.Errorf("unsigned callback data")
+	}
+
+	payload, mac := data[:i], data[i+1:]
+	if !hmac.Equal([]byte(mac), []byte(s.mac(payload))) {
+		return "", nil, fmt.Errorf("bad callback signature")
+	}
+
+	parts := strings.Split(payload, callbackSeparator)
+
+	return parts[0], parts[1:], nil
+}
+
+func (s *Signer) mac(payload string) string {
+	h := hmac.New(sha256.New, s.key)
+	_, _ = h.Write([]byte(payload))
+
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil)[:8])
+}
@@ -0,0 +1,85 @@
+package telegram
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSignerRoundTrip(t *testing.T) {
+	s := NewSigner("secret")
+
+	tests := []struct {
+		action string
+		args   []string
+	}{
+		{"m", []string{"12"}},
+		{"d", []string{"12", "0123456"}},
+		{"x", []string{}},
+	}
+
+	for _, tt := range tests {
+		data, err := s.Sign(tt.action, tt.args...)
+		if err != nil {
+			t.Fatalf("Sign(%q, %q): %v", tt.action, tt.args, err)
+		}
+
+		action, args, err := s.Verify(data)
+		if err != nil {
+			t.Fatalf("Verify(%q): %v", data, err)
+		}
+		if action != tt.action || !reflect.DeepEqual(args, tt.args) {
+			t.Errorf("Verify(%q) = %q, %q, want %q, %q", data, action, args, tt.action, tt.args)
+		}
+	}
+}
+
+func TestSignerSignErrors(t *testing.T) {
+	s := NewSigner("secret")
+
+	tests := []struct {
+		name   string
+		action string
+		args   []string
+	}{
+		{"separator in action", "a:b", nil},
+		{"separator in arg", "m", []string{"1:2"}},
+		{"too long", "m", []string{strings.Repeat("x", MaxCallbackData)}},
+	}
+
+	for _, tt := range tests {
+		if data, err := s.Sign(tt.action, tt.args...); err == nil {
+			t.Errorf("%s: Sign = %q, want error", tt.name, data)
+		}
+	}
+}
+
+func TestSignerVerifyRejects(t *testing.T) {
+	s := NewSigner("secret")
+
+	valid, err := s.Sign("m", "12")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewSigner("other").Sign("m", "12")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"unsigned", "m"},
+		{"other key", other},
+		{"changed arg", strings.Replace(valid, "m:12", "m:13", 1)},
+		{"changed action", strings.Replace(valid, "m:12", "u:12", 1)},
+		{"empty mac", "m:12:"},
+	}
+
+	for _, tt := range tests {
+		if action, args, err := s.Verify(tt.data); err == nil {
+			t.Errorf("%s: Verify(%q) = %q, %q, want error", tt.name, tt.data, action, args)
+		}
+	}
+}
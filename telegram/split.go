@@ -0,0 +1,234 @@
+package telegram
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// MaxMessageLength is the telegram limit for message text
+const MaxMessageLength = 4096
+
+// TextLength counts text the way telegram does, in UTF-16 code units
+func TextLength(s string) int {
+	n := 0
+	for _, r := range s {
+		if r > 0xFFFF {
+			n += 2
+		} else {
+			n++
+		}
+	}
+
+	return n
+}
+
+// atom is the smallest piece of formatted text that can't be split
+type atom struct {
+	text  string
+	open  string // entity opened by this atom
+	close string // entity name closed by this atom
+}
+
+// Split breaks formatted text into chunks of at most limit, preferring
+// line boundaries and closing entities at the end of every chunk and
+// reopening them at the start of the next one
+func (r Renderer) Split(text string, limit int) []string {
+	if TextLength(text) <= limit {
+		return []string{text}
+	}
+
+	atoms := r.atoms(text)
+
+	var chunks []string
+	var stack []string
+
+	for i := 0; i < len(atoms); {
+		cur := r.opening(stack)
+		curStack := append([]string(nil), stack...)
+
+		breakAt, breakCur, breakStack := -1, "", []string(nil)
+
+		j := i
+		for ; j < len(atoms); j++ {
+			next := r.apply(curStack, atoms[j])
+			if j > i && TextLength(cur)+TextLength(atoms[j].text)+TextLength(r.closing(next)) > limit {
+				break
+			}
+
+			cur += atoms[j].text
+			curStack = next
+
+			if atoms[j].text == "\n" {
+				breakAt, breakCur, breakStack = j+1, cur, curStack
+			}
+		}
+
+		if j < len(atoms) && breakAt > i {
+			j, cur, curStack = breakAt, breakCur, breakStack
+		}
+
+		// keep closing tags right after the break in this chunk, their
+		// length is already reserved
+		for ; r.Mode == ModeHTML && j < len(atoms) && atoms[j].close != "" && len(curStack) > 0; j++ {
+			cur += atoms[j].text
+			curStack = r.apply(curStack, atoms[j])
+		}
+
+		if chunk := strings.TrimRight(cur, "\n") + r.closing(curStack); strings.TrimSpace(Plain(chunk, string(r.Mode))) != "" {
+			chunks = append(chunks, chunk)
+		}
+
+		stack, i = curStack, j
+	}
+
+	return chunks
+}
+
+var (
+	htmlTagAtomRe    = regexp.MustCompile(`^<(/?)([a-zA-Z0-9-]+)[^>]*>`)
+	htmlEntityAtomRe = regexp.MustCompile(`^&#?[a-zA-Z0-9]+;`)
+	mdLinkAtomRe     = regexp.MustCompile(`^\[(?:\\.|[^\]\\])*\]\((?:\\.|[^)\\])*\)`)
+	mdCodeAtomRe     = regexp.MustCompile("^`(?:\\\\.|[^`\\\\])*`")
+)
+
+func (r Renderer) atoms(text string) []atom {
+	var atoms []atom
+
+	for len(text) > 0 {
+		var a atom
+
+		switch r.Mode {
+		case ModeHTML:
+			if m := htmlTagAtomRe.FindStringSubmatch(text); m != nil {
+				a.text = m[0]
+				if m[1] == "/" {
+					a.close = strings.ToLower(m[2])
+				} else {
+					a.open = m[0]
+				}
+			} else if m := htmlEntityAtomRe.FindString(text); m != "" {
+				a.text = m
+			}
+		case ModeMarkdownV2:
+			switch {
+			case strings.HasPrefix(text, "```"):
+				a.text = "```"
+				a.open = "```"
+				a.close = "```"
+			case text[0] == '\\' && len(text) > 1:
+				_, size := utf8.DecodeRuneInString(text[1:])
+				a.text = text[:1+size]
+			case text[0] == '[':
+				a.text = mdLinkAtomRe.FindString(text)
+			case text[0] == '`':
+				a.text = mdCodeAtomRe.FindString(text)
+			case strings.ContainsRune("*_~|", rune(text[0])):
+				a.text = text[:1]
+				a.open = a.text
+				a.close = a.text
+			}
+		}
+
+		if a.text == "" {
+			_, size := utf8.DecodeRuneInString(text)
+			a = atom{text: text[:size]}
+		}
+
+		atoms = append(atoms, a)
+		text = text[len(a.text):]
+	}
+
+	return atoms
+}
+
+// apply returns entity stack after the atom
+func (r Renderer) apply(stack []string, a atom) []string {
+	if a.open == "" && a.close == "" {
+		return stack
+	}
+
+	if a.close != "" {
+		for i := len(stack) - 1; i >= 0; i-- {
+			if r.entityName(stack[i]) == a.close {
+				return append(append([]string(nil), stack[:i]...), stack[i+1:]...)
+			}
+		}
+	}
+
+	if a.open != "" {
+		return append(append([]string(nil), stack...), a.open)
+	}
+
+	return stack
+}
+
+func (r Renderer) entityName(open string) string {
+	if r.Mode == ModeHTML {
+		if m := htmlTagAtomRe.FindStringSubmatch(open); m != nil {
+			return strings.ToLower(m[2])
+		}
+	}
+
+	return open
+}
+
+// opening returns markup reopening entities left open by the previous chunk
+func (r Renderer) opening(stack []string) string {
+	var b strings.Builder
+
+	for _, open := range stack {
+		b.WriteString(open)
+		if r.Mode == ModeMarkdownV2 && open == "```" {
+			b.WriteString("\n")
+		}
+	}
+
+	return b.String()
+}
+
+// closing returns markup closing every open entity
+func (r Renderer) closing(stack []string) string {
+	var b strings.Builder
+
+	for i := len(stack) - 1; i >= 0; i-- {
+		switch {
+		case r.Mode == ModeHTML:
+			b.WriteString("</" + r.entityName(stack[i]) + ">")
+		case stack[i] == "```":
+			b.WriteString("\n```")
+		default:
+			b.WriteString(stack[i])
+		}
+	}
+
+	return b.String()
+}
+
+// Truncate escapes text and cuts it to max characters adding a link to the full version
+func (r Renderer) Truncate(text string, max int, moreURL string) string {
+	if TextLength(text) <= max {
+		return r.Escape(text)
+	}
+
+	cut := 0
+	n := 0
+	for i, ch := range text {
+		if ch > 0xFFFF {
+			n += 2
+		} else {
+			n++
+		}
+		if n > max {
+			break
+		}
+		cut = i + utf8.RuneLen(ch)
+	}
+
+	short := strings.TrimRight(text[:cut], " \n")
+	if moreURL == "" {
+		return r.Escape(short + "…")
+	}
+
+	return r.Escape(short) + " " + r.Link("…more", moreURL)
+}
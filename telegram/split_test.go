@@ -0,0 +1,114 @@
+package telegram
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTextLength(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int
+	}{
+		{"", 0},
+		{"abc", 3},
+		{"привет", 6},
+		{"👍", 2},
+	}
+
+	for _, tt := range tests {
+		if got := TextLength(tt.in); got != tt.want {
+			t.Errorf("TextLength(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		name  string
+		mode  Mode
+		text  string
+		limit int
+		want  []string
+	}{
+		{
+			name:  "fits",
+			mode:  ModeHTML,
+			text:  "<b>short</b>",
+			limit: 20,
+			want:  []string{"<b>short</b>"},
+		},
+		{
+			name:  "line boundaries",
+			mode:  ModeHTML,
+			text:  "line one\nline two\nline three",
+			limit: 18,
+			want:  []string{"line one\nline two", "line three"},
+		},
+		{
+			name:  "reopens html tags",
+			mode:  ModeHTML,
+			text:  "<b>aaaa\nbbbb</b>",
+			limit: 12,
+			want:  []string{"<b>aaaa</b>", "<b>bbbb</b>"},
+		},
+		{
+			name:  "keeps html entities whole",
+			mode:  ModeHTML,
+			text:  "a&amp;b&amp;c",
+			limit: 7,
+			want:  []string{"a&amp;b", "&amp;c"},
+		},
+		{
+			name:  "reopens markdown entities",
+			mode:  ModeMarkdownV2,
+			text:  "*aaaa\nbbbb*",
+			limit: 7,
+			want:  []string{"*aaaa*", "*bbbb*"},
+		},
+		{
+			name:  "keeps markdown escapes whole",
+			mode:  ModeMarkdownV2,
+			text:  `ab\.cd`,
+			limit: 3,
+			want:  []string{"ab", `\.c`, "d"},
+		},
+	}
+
+	for _, tt := range tests {
+		got := (Renderer{Mode: tt.mode}).Split(tt.text, tt.limit)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: Split(%q, %d) = %q, want %q", tt.name, tt.text, tt.limit, got, tt.want)
+		}
+	}
+}
+
+func TestSplitRespectsLimit(t *testing.T) {
+	for _, mode := range []Mode{ModeHTML, ModeMarkdownV2} {
+		r := Renderer{Mode: mode}
+
+		var lines []string
+		for i := 0; i < 200; i++ {
+			lines = append(lines, r.Bold("repo")+" "+r.Link("owner/repo_"+strings.Repeat("x", i%7), "https://github.com/owner/repo"))
+		}
+		text := strings.Join(lines, "\n")
+
+		chunks := r.Split(text, 300)
+		if len(chunks) < 2 {
+			t.Fatalf("%s: got %d chunks, want several", mode, len(chunks))
+		}
+
+		var plain []string
+		for _, chunk := range chunks {
+			if n := TextLength(chunk); n > 300 {
+				t.Errorf("%s: chunk of %d characters, limit is 300", mode, n)
+			}
+			plain = append(plain, Plain(chunk, string(mode)))
+		}
+
+		if got, want := strings.Join(plain, "\n"), Plain(text, string(mode)); got != want {
+			t.Errorf("%s: chunks lost text:\n%s\nwant:\n%s", mode, got, want)
+		}
+	}
+}
@@ -3,16 +3,156 @@ package telegram
 import (
 	"context"
 	"fmt"
+	"log/slog"
 	"net"
 	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	logging "github.com/ad/go-githublistener/logging"
+	metrics "github.com/ad/go-githublistener/metrics"
 
-	dlog "github.com/amoghe/distillog"
 	"golang.org/x/net/proxy"
 	tgbotapi "gopkg.in/telegram-bot-api.v4"
 )
 
+// Bot wraps telegram api, every message sent through it that fails to
+// parse is resent as plain text
+type Bot struct {
+	*tgbotapi.BotAPI
+	Renderer Renderer
+
+	mu          sync.Mutex
+	lastUpdates time.Time
+}
+
+// GetUpdatesChan long polls telegram for updates like tgbotapi does,
+// remembering when getUpdates last succeeded
+func (b *Bot) GetUpdatesChan(config tgbotapi.UpdateConfig) (tgbotapi.UpdatesChannel, error) {
+	ch := make(chan tgbotapi.Update, b.Buffer)
+
+	go func() {
+		for {
+			updates, err := b.GetUpdates(config)
+			metrics.TelegramRequests.Inc("GetUpdates", metrics.Status(err))
+			if err != nil {
+				slog.Error("failed to get updates, retrying in 3 seconds", logging.Err(err))
+				time.Sleep(3 * time.Second)
+
+				continue
+			}
+
+			b.mu.Lock()
+			b.lastUpdates = time.Now()
+			b.mu.Unlock()
+
+			for _, update := range updates {
+				if update.UpdateID >= config.Offset {
+					config.Offset = update.UpdateID + 1
+					ch <- update
+				}
+			}
+		}
+	}()
+
+	return ch, nil
+}
+
+// LastUpdates returns when getUpdates last succeeded
+func (b *Bot) LastUpdates() time.Time {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.lastUpdates
+}
+
+// Send splits messages longer than telegram allows and falls back to
+// plain text when formatting can't be parsed
+func (b *Bot) Send(c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	if config, ok := c.(tgbotapi.MessageConfig); ok && TextLength(config.Text) > MaxMessageLength {
+		return b.sendChunks(config)
+	}
+
+	return b.send(c)
+}
+
+// sendChunks sends long text as several messages, reply goes to the first
+// one and keyboard to the last one
+func (b *Bot) sendChunks(config tgbotapi.MessageConfig) (tgbotapi.Message, error) {
+	var msg tgbotapi.Message
+
+	chunks := Renderer{Mode: Mode(config.ParseMode)}.Split(config.Text, MaxMessageLength)
+	for i, chunk := range chunks {
+		part := config
+		part.Text = chunk
+		if i > 0 {
+			part.ReplyToMessageID = 0
+		}
+		if i < len(chunks)-1 {
+			part.ReplyMarkup = nil
+		}
+
+		var err error
+		if msg, err = b.send(part); err != nil {
+			return msg, err
+		}
+	}
+
+	return msg, nil
+}
+
+func (b *Bot) send(c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	msg, err := b.apiSend(c)
+	if err == nil || !IsParseError(err) {
+		return msg, err
+	}
+
+	switch config := c.(type) {
+	case tgbotapi.MessageConfig:
+		if config.ParseMode == "" {
+			return msg, err
+		}
+		slog.Warn("message formatting rejected, resending as plain text", logging.Err(err))
+		config.Text = Plain(config.Text, config.ParseMode)
+		config.ParseMode = ""
+		return b.apiSend(config)
+	case tgbotapi.EditMessageTextConfig:
+		if config.ParseMode == "" {
+			return msg, err
+		}
+		slog.Warn("message formatting rejected, resending as plain text", logging.Err(err))
+		config.Text = Plain(config.Text, config.ParseMode)
+		config.ParseMode = ""
+		return b.apiSend(config)
+	}
+
+	return msg, err
+}
+
+// apiSend calls telegram counting results by method
+func (b *Bot) apiSend(c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	msg, err := b.BotAPI.Send(c)
+	metrics.TelegramRequests.Inc(method(c), metrics.Status(err))
+
+	return msg, err
+}
+
+// method names a chattable for metrics, e.g. Message or EditMessageText
+func method(c tgbotapi.Chattable) string {
+	name := fmt.Sprintf("%T", c)
+	name = name[strings.LastIndex(name, ".")+1:]
+
+	return strings.TrimSuffix(name, "Config")
+}
+
+// IsParseError reports whether telegram rejected message formatting
+func IsParseError(err error) bool {
+	return strings.Contains(err.Error(), "can't parse entities")
+}
+
 // InitTelegram ...
-func InitTelegram(token, proxyHost, proxyPort, proxyUser, proxyPassword string, debug bool) (bot *tgbotapi.BotAPI, err error) {
+func InitTelegram(token, proxyHost, proxyPort, proxyUser, proxyPassword string, debug bool) (*Bot, error) {
 	var tr http.Transport
 
 	if proxyHost != "" {
@@ -33,14 +173,14 @@ func InitTelegram(token, proxyHost, proxyPort, proxyUser, proxyPassword string,
 		}
 	}
 
-	bot, err = tgbotapi.NewBotAPIWithClient(token, &http.Client{Transport: &tr})
+	api, err := tgbotapi.NewBotAPIWithClient(token, &http.Client{Transport: &tr})
 	if err != nil {
 		return nil, err
 	}
 
-	bot.Debug = debug
+	api.Debug = debug
 
-	dlog.Debugf("Authorized on account @%s", bot.Self.UserName)
+	slog.Debug("authorized on telegram", "account", api.Self.UserName)
 
-	return bot, nil
+	return &Bot{BotAPI: api, Renderer: DefaultRenderer}, nil
 }
@@ -0,0 +1,507 @@
+package templates
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"text/template/parse"
+	"time"
+
+	ghapi "github.com/ad/go-githublistener/ghapi"
+	telegram "github.com/ad/go-githublistener/telegram"
+)
+
+// Event types
+const (
+	EventCommit      = "commit"
+	EventRelease     = "release"
+	EventPullRequest = "pr"
+	EventRepoRemoved = "repo_removed"
+	EventPush        = "push"
+	EventDigest      = "digest"
+	EventAlert       = "alert"
+)
+
+// Presets users can choose with /format
+const (
+	PresetCompact  = "compact"
+	PresetDetailed = "detailed"
+)
+
+// DefaultPreset keeps notifications in the format used before presets existed
+const DefaultPreset = PresetDetailed
+
+// ShortSHA is the commit hash length shown in compact notifications
+const ShortSHA = 12
+
+// Events ...
+var Events = []string{EventCommit, EventPush, EventDigest, EventRelease, EventPullRequest, EventRepoRemoved, EventAlert}
+
+// Presets ...
+var Presets = []string{PresetCompact, PresetDetailed}
+
+// defaults are overridden by definitions with the same name from the
+// operator templates file
+const defaults = `
+{{- define "commit.compact" -}}
+{{repo .Repo}}: {{link .ShortSHA .URL}} {{.Title}} ({{.Author}})
+{{- end -}}
+
+{{- define "commit.detailed" -}}
+{{repo .Repo}} was updated by {{link .Author .AuthorURL}} with new commit({{link .SHA .URL}}):
+{{truncate .Message 1000 .URL}}
+{{- end -}}
+
+{{- define "push.compact" -}}
+{{repo .Repo}}: {{len .Commits}} new commits ({{link "compare" .CompareURL}})
+{{- range .Commits}}
+{{link .ShortSHA .URL}} {{.Title}}
+{{- end -}}
+{{- end -}}
+
+{{- define "push.detailed" -}}
+{{repo .Repo}} received {{len .Commits}} new commits ({{link "compare" .CompareURL}}):
+{{- range .Commits}}
+{{link .ShortSHA .URL}} {{.Title}} ({{.Author}})
+{{- end -}}
+{{- end -}}
+
+{{- define "digest.compact" -}}
+{{.Period}}:
+{{- range .Repos}}
+{{repo .Repo}}: {{len .Commits}} new commits
+{{- end -}}
+{{- end -}}
+
+{{- define "digest.detailed" -}}
+{{.Period}}:
+{{- range .Repos}}
+
+{{repo .Repo}}:
+{{- range .Commits}}
+{{link .ShortSHA .URL}} {{.Title}} ({{.Author}})
+{{- end -}}
+{{- end -}}
+{{- end -}}
+
+{{- define "release.compact" -}}
+{{repo .Repo}}: release {{link .Tag .URL}}
+{{- end -}}
+
+{{- define "release.detailed" -}}
+{{repo .Repo}} published release {{link .Name .URL}} ({{.Tag}}) by {{.Author}}
+{{- if .Body}}
+{{truncate .Body 1000 .URL}}
+{{- end -}}
+{{- end -}}
+
+{{- define "pr.compact" -}}
+{{repo .Repo}}: PR {{link (printf "#%d" .Number) .URL}} {{.Title}}
+{{- end -}}
+
+{{- define "pr.detailed" -}}
+{{repo .Repo}} pull request {{link (printf "#%d" .Number) .URL}} {{.State}} by {{.Author}}:
+{{bold .Title}}
+{{- if .Body}}
+{{truncate .Body 500 .URL}}
+{{- end -}}
+{{- end -}}
+
+{{- define "alert.compact" -}}
+{{bold "Alert"}} {{.Keyword}} in {{repo .Repo}}: {{link .Title .URL}}
+{{- end -}}
+
+{{- define "alert.detailed" -}}
+{{bold (printf "Alert: %s" .Keyword)}}
+{{.Kind}} in {{repo .Repo}} by {{.Author}}:
+{{link .Title .URL}}
+{{- if .Text}}
+{{truncate .Text 500 .URL}}
+{{- end -}}
+{{- end -}}
+
+{{- define "repo_removed.compact" -}}
+{{repo .Repo}} removed: {{.Reason}}
+{{- end -}}
+
+{{- define "repo_removed.detailed" -}}
+repo {{repo .Repo}} {{.Reason}}, removed
+{{- end -}}
+`
+
+// Markup is already formatted text that must not be escaped again
+type Markup string
+
+// Commit ...
+type Commit struct {
+	Repo       string
+	SHA        string
+	ShortSHA   string
+	URL        string
+	CompareURL string
+	Author     string
+	AuthorURL  string
+	Message    string
+	Title      string
+	Body       string
+	Date       time.Time
+}
+
+// Push lists commits found by a single poll of a repo
+type Push struct {
+	Repo       string
+	CompareURL string
+	Commits    []*Commit
+}
+
+// Digest summarizes queued commits of several repos
+type Digest struct {
+	Period string
+	Repos  []*DigestRepo
+}
+
+// DigestRepo ...
+type DigestRepo struct {
+	Repo    string
+	Commits []*Commit
+}
+
+// Release ...
+type Release struct {
+	Repo   string
+	Tag    string
+	Name   string
+	URL    string
+	Author string
+	Body   string
+	Date   time.Time
+}
+
+// PullRequest ...
+type PullRequest struct {
+	Repo   string
+	Number int
+	Title  string
+	URL    string
+	Author string
+	State  string
+	Body   string
+	Date   time.Time
+}
+
+// Alert is a commit, pull request or release matching a keyword
+type Alert struct {
+	Keyword string
+	Repo    string
+	Kind    string
+	Title   string
+	URL     string
+	Author  string
+	Text    string
+	Date    time.Time
+}
+
+// RepoRemoved ...
+type RepoRemoved struct {
+	Repo   string
+	Reason string
+}
+
+// Set holds parsed notification templates
+type Set struct {
+	tmpl     *template.Template
+	renderer telegram.Renderer
+
+	// byZone caches a clone bound to the date funcs of each time zone,
+	// keyed by name as time.LoadLocation returns a new pointer every call
+	mu     sync.Mutex
+	byZone map[string]*template.Template
+}
+
+// Load parses built-in templates and overrides them with definitions from
+// path if it is not empty, literal text and values are escaped for the
+// renderer mode unless produced by formatting functions
+func Load(path string, r telegram.Renderer) (*Set, error) {
+	s := &Set{renderer: r}
+
+	tmpl, err := template.New("notifications").Funcs(s.funcs(time.UTC)).Parse(defaults)
+	if err != nil {
+		return nil, err
+	}
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		if tmpl, err = tmpl.Parse(string(data)); err != nil {
+			return nil, fmt.Errorf("%s: %s", path, err)
+		}
+	}
+
+	for _, t := range tmpl.Templates() {
+		if t.Tree != nil && t.Tree.Root != nil {
+			s.escapeTree(t.Tree, t.Tree.Root)
+		}
+	}
+
+	for _, event := range Events {
+		if tmpl.Lookup(Name(event, PresetCompact)) == nil {
+			return nil, fmt.Errorf("template %s is not defined", Name(event, PresetCompact))
+		}
+	}
+
+	s.tmpl = tmpl
+
+	return s, nil
+}
+
+// Must panics if templates failed to load
+func Must(s *Set, err error) *Set {
+	if err != nil {
+		panic(err)
+	}
+
+	return s
+}
+
+// Name returns template name for event and preset
+func Name(event, preset string) string {
+	return event + "." + preset
+}
+
+// IsEvent ...
+func IsEvent(event string) bool {
+	for _, item := range Events {
+		if item == event {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IsPreset ...
+func IsPreset(preset string) bool {
+	for _, item := range Presets {
+		if item == preset {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Names lists every defined template
+func (s *Set) Names() []string {
+	var names []string
+	for _, t := range s.tmpl.Templates() {
+		if strings.Contains(t.Name(), ".") {
+			names = append(names, t.Name())
+		}
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Render executes template of event in preset falling back to compact
+func (s *Set) Render(event, preset string, data interface{}) (string, error) {
+	return s.RenderIn(event, preset, data, time.UTC)
+}
+
+// RenderIn is Render with dates shown in loc
+func (s *Set) RenderIn(event, preset string, data interface{}, loc *time.Location) (string, error) {
+	tmpl, err := s.in(loc)
+	if err != nil {
+		return "", err
+	}
+
+	t := tmpl.Lookup(Name(event, preset))
+	if t == nil {
+		t = tmpl.Lookup(Name(event, PresetCompact))
+	}
+	if t == nil {
+		return "", fmt.Errorf("no template for %s", event)
+	}
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// in returns templates showing dates in loc
+func (s *Set) in(loc *time.Location) (*template.Template, error) {
+	if loc == time.UTC {
+		return s.tmpl, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if tmpl, ok := s.byZone[loc.String()]; ok {
+		return tmpl, nil
+	}
+
+	tmpl, err := s.tmpl.Clone()
+	if err != nil {
+		return nil, err
+	}
+	tmpl.Funcs(s.funcs(loc))
+
+	if s.byZone == nil {
+		s.byZone = make(map[string]*template.Template)
+	}
+	s.byZone[loc.String()] = tmpl
+
+	return tmpl, nil
+}
+
+func (s *Set) funcs(loc *time.Location) template.FuncMap {
+	r := s.renderer
+
+	return template.FuncMap{
+		"esc": func(v interface{}) Markup {
+			if m, ok := v.(Markup); ok {
+				return m
+			}
+			return Markup(r.Escape(fmt.Sprint(v)))
+		},
+		"link": func(text interface{}, url string) Markup {
+			return Markup(r.Link(fmt.Sprint(text), url))
+		},
+		"repo": func(name string) Markup {
+			return Markup(r.RepoLink(name))
+		},
+		"bold": func(v interface{}) Markup {
+			return Markup(r.Bold(fmt.Sprint(v)))
+		},
+		"italic": func(v interface{}) Markup {
+			return Markup(r.Italic(fmt.Sprint(v)))
+		},
+		"code": func(v interface{}) Markup {
+			return Markup(r.Code(fmt.Sprint(v)))
+		},
+		"pre": func(v interface{}) Markup {
+			return Markup(r.Pre(fmt.Sprint(v)))
+		},
+		"truncate": func(text string, max int, url string) Markup {
+			return Markup(r.Truncate(text, max, url))
+		},
+		"date": func(t time.Time) string {
+			return t.In(loc).Format("2006-01-02 15:04")
+		},
+	}
+}
+
+// escapeTree escapes literal text and pipes every printed value through esc
+func (s *Set) escapeTree(tree *parse.Tree, node parse.Node) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			s.escapeTree(tree, child)
+		}
+	case *parse.TextNode:
+		n.Text = []byte(s.renderer.Escape(string(n.Text)))
+	case *parse.ActionNode:
+		if len(n.Pipe.Decl) > 0 {
+			return
+		}
+		esc := parse.NewIdentifier("esc").SetTree(tree).SetPos(n.Pos)
+		n.Pipe.Cmds = append(n.Pipe.Cmds, &parse.CommandNode{
+			NodeType: parse.NodeCommand,
+			Pos:      n.Pos,
+			Args:     []parse.Node{esc},
+		})
+	case *parse.IfNode:
+		s.escapeTree(tree, n.List)
+		s.escapeTree(tree, n.ElseList)
+	case *parse.RangeNode:
+		s.escapeTree(tree, n.List)
+		s.escapeTree(tree, n.ElseList)
+	case *parse.WithNode:
+		s.escapeTree(tree, n.List)
+		s.escapeTree(tree, n.ElseList)
+	}
+}
+
+// NewCommit builds template data of a commit notification
+func NewCommit(repoName string, commit *ghapi.CommitItem) *Commit {
+	title, body := commit.Commit.Message, ""
+	if i := strings.Index(title, "\n"); i >= 0 {
+		title, body = title[:i], strings.TrimSpace(title[i+1:])
+	}
+
+	short := commit.SHA
+	if len(short) > ShortSHA {
+		short = short[:ShortSHA]
+	}
+
+	return &Commit{
+		Repo:       repoName,
+		SHA:        commit.SHA,
+		ShortSHA:   short,
+		URL:        commit.HTMLUrl,
+		CompareURL: commit.CompareURL(repoName),
+		Author:     commit.Commit.Author.Name,
+		AuthorURL:  "https://github.com/" + commit.Commit.Author.Name,
+		Message:    commit.Commit.Message,
+		Title:      title,
+		Body:       body,
+		Date:       commit.Commit.Author.Date,
+	}
+}
+
+// SampleCommit is used by /preview
+func SampleCommit() *Commit {
+	message := "Fix *markdown* [escaping] in notifications\n\nCommit messages with_underscores and <tags> are rendered safely."
+
+	return &Commit{
+		Repo:       "octocat/Hello-World",
+		SHA:        "7fd1a60b01f91b314f59955a4e4d4e80d8edf11d",
+		ShortSHA:   "7fd1a60b01f9",
+		URL:        "https://github.com/octocat/Hello-World/commit/7fd1a60b01f91b314f59955a4e4d4e80d8edf11d",
+		CompareURL: "https://github.com/octocat/Hello-World/compare/553c2077f0edc3d5dc5d17262f6aa498e69d6f8e...7fd1a60b01f91b314f59955a4e4d4e80d8edf11d",
+		Author:     "The Octocat",
+		AuthorURL:  "https://github.com/octocat",
+		Message:    message,
+		Title:      "Fix *markdown* [escaping] in notifications",
+		Body:       "Commit messages with_underscores and <tags> are rendered safely.",
+		Date:       time.Date(2012, 3, 6, 23, 6, 50, 0, time.UTC),
+	}
+}
+
+// Sample returns sample data for event
+func Sample(event string) interface{} {
+	switch event {
+	case EventRelease:
+		return &Release{Repo: "octocat/Hello-World", Tag: "v1.0.0", Name: "v1.0.0 [stable]", URL: "https://github.com/octocat/Hello-World/releases/tag/v1.0.0", Author: "octocat", Body: "Description of the *release*", Date: time.Date(2013, 2, 27, 19, 35, 32, 0, time.UTC)}
+	case EventPullRequest:
+		return &PullRequest{Repo: "octocat/Hello-World", Number: 1347, Title: "Amazing new feature", URL: "https://github.com/octocat/Hello-World/pull/1347", Author: "octocat", State: "opened", Body: "Please pull these awesome changes in!", Date: time.Date(2011, 1, 26, 19, 1, 12, 0, time.UTC)}
+	case EventPush:
+		commit := SampleCommit()
+		second := *commit
+		second.SHA, second.ShortSHA, second.Title = "553c2077f0edc3d5dc5d17262f6aa498e69d6f8e", "553c2077f0ed", "Add README"
+		return &Push{Repo: commit.Repo, CompareURL: commit.CompareURL, Commits: []*Commit{commit, &second}}
+	case EventDigest:
+		commit := SampleCommit()
+		return &Digest{Period: "Daily digest", Repos: []*DigestRepo{{Repo: commit.Repo, Commits: []*Commit{commit}}, {Repo: "octocat/Spoon-Knife", Commits: []*Commit{{Repo: "octocat/Spoon-Knife", SHA: "d0dd1f61b33d64e29d8bc1372a94ef6a2fee76a9", ShortSHA: "d0dd1f61b33d", URL: "https://github.com/octocat/Spoon-Knife/commit/d0dd1f61b33d64e29d8bc1372a94ef6a2fee76a9", Author: "The Octocat", Title: "Pointing to the guide for forking"}}}}}
+	case EventAlert:
+		return &Alert{Keyword: "CVE", Repo: "octocat/Hello-World", Kind: "pull request", Title: "Fix CVE-2024-0001 in parser", URL: "https://github.com/octocat/Hello-World/pull/1348", Author: "octocat", Text: "Backport of the security fix"}
+	case EventRepoRemoved:
+		return &RepoRemoved{Repo: "octocat/Hello-World", Reason: "not found"}
+	}
+
+	return SampleCommit()
+}
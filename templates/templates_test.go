@@ -0,0 +1,78 @@
+package templates
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	telegram "github.com/ad/go-githublistener/telegram"
+)
+
+func loadZoneTemplates(t *testing.T) *Set {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "templates.tmpl")
+	if err := os.WriteFile(path, []byte(`{{define "commit.zone"}}{{.Title}} {{date .Date}}{{end}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := Load(path, telegram.DefaultRenderer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s
+}
+
+func TestRenderInZones(t *testing.T) {
+	s := loadZoneTemplates(t)
+	commit := &Commit{Title: "a < b", Date: time.Date(2026, 1, 15, 23, 30, 0, 0, time.UTC)}
+
+	tests := []struct {
+		zone string
+		want string
+	}{
+		{"UTC", "a &lt; b 2026-01-15 23:30"},
+		{"Europe/Berlin", "a &lt; b 2026-01-16 00:30"},
+		{"America/New_York", "a &lt; b 2026-01-15 18:30"},
+		// the cached Berlin templates are reused for a new location value
+		{"Europe/Berlin", "a &lt; b 2026-01-16 00:30"},
+	}
+
+	for _, tt := range tests {
+		loc, err := time.LoadLocation(tt.zone)
+		if err != nil {
+			t.Skipf("no time zone data: %v", err)
+		}
+
+		got, err := s.RenderIn(EventCommit, "zone", commit, loc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("RenderIn(%s) = %q, want %q", tt.zone, got, tt.want)
+		}
+	}
+
+	if n := len(s.byZone); n != 2 {
+		t.Errorf("cached %d zones, want 2", n)
+	}
+}
+
+func TestRenderFallsBackToCompact(t *testing.T) {
+	s := Must(Load("", telegram.DefaultRenderer))
+
+	got, err := s.Render(EventCommit, "missing", SampleCommit())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want, err := s.Render(EventCommit, PresetCompact, SampleCommit())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("Render(missing preset) = %q, want compact %q", got, want)
+	}
+}
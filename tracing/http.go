@@ -0,0 +1,68 @@
+package tracing
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// Transport traces outgoing requests, with Propagate set it passes the
+// trace to the server in the traceparent header
+type Transport struct {
+	Base http.RoundTripper
+	// Name returns span name of a request, method and path by default
+	Name func(r *http.Request) string
+	// Propagate sends trace ids to the server, leave it off for third party
+	// apis as ids of our traces are nobody else's business
+	Propagate bool
+}
+
+// RoundTrip ...
+func (t *Transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	name := r.Method + " " + r.URL.Path
+	if t.Name != nil {
+		name = t.Name(r)
+	}
+
+	// query strings are left out, they may carry secrets
+	ctx, span := StartKind(r.Context(), KindClient, name,
+		String("http.request.method", r.Method),
+		String("server.address", r.URL.Host),
+		String("url.path", r.URL.Path),
+	)
+	if span == nil {
+		return base.RoundTrip(r)
+	}
+	defer span.End()
+
+	if t.Propagate {
+		r = r.Clone(ctx)
+		r.Header.Set("traceparent", span.Traceparent())
+	}
+
+	res, err := base.RoundTrip(r)
+	if err != nil {
+		span.SetError(err)
+		return res, err
+	}
+
+	span.SetAttr(Int("http.response.status_code", int64(res.StatusCode)))
+	if id := res.Header.Get("X-GitHub-Request-Id"); id != "" {
+		span.SetAttr(String("github.request_id", id))
+	}
+	if res.StatusCode >= http.StatusInternalServerError {
+		span.SetError(errStatus(res.StatusCode))
+	}
+
+	return res, nil
+}
+
+type errStatus int
+
+func (e errStatus) Error() string {
+	return "http status " + strconv.Itoa(int(e))
+}
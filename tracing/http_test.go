@@ -0,0 +1,85 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// recorder keeps exported spans
+type recorder struct {
+	mu    sync.Mutex
+	spans []*Span
+}
+
+func (r *recorder) Export(span *Span) {
+	r.mu.Lock()
+	r.spans = append(r.spans, span)
+	r.mu.Unlock()
+}
+
+func (r *recorder) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+func TestTransportPropagation(t *testing.T) {
+	rec := &recorder{}
+	SetExporter(rec)
+	t.Cleanup(func() { SetExporter(nil) })
+
+	var mu sync.Mutex
+	var traceparent []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		traceparent = append(traceparent, r.Header.Get("traceparent"))
+		mu.Unlock()
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	for _, propagate := range []bool{false, true} {
+		client := http.Client{Transport: &Transport{Propagate: propagate}}
+
+		ctx, root := Start(context.Background(), "job")
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/repos?access_token=secret", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		root.End()
+	}
+
+	if traceparent[0] != "" {
+		t.Errorf("traceparent %q sent without Propagate", traceparent[0])
+	}
+	if !strings.HasPrefix(traceparent[1], "00-") || len(traceparent[1]) != 55 {
+		t.Errorf("traceparent = %q, want a W3C header", traceparent[1])
+	}
+
+	// client span, then its root, for each request
+	if len(rec.spans) != 4 {
+		t.Fatalf("exported %d spans, want 4", len(rec.spans))
+	}
+	client, root := rec.spans[2], rec.spans[3]
+	if client.ParentID != root.SpanID || client.TraceID != root.TraceID {
+		t.Error("client span is not a child of the request context span")
+	}
+	if want := client.Traceparent(); traceparent[1] != want {
+		t.Errorf("traceparent = %q, want %q", traceparent[1], want)
+	}
+	if client.Name != "GET /repos" || client.Error == "" {
+		t.Errorf("client span %q error %q, want GET /repos failed", client.Name, client.Error)
+	}
+	for _, attr := range client.Attrs() {
+		if s, ok := attr.Value.(string); ok && strings.Contains(s, "secret") {
+			t.Errorf("attribute %s leaks the query string: %q", attr.Key, s)
+		}
+	}
+}
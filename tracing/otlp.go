@@ -0,0 +1,345 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	logging "github.com/ad/go-githublistener/logging"
+)
+
+// Batching of the OTLP exporter
+const (
+	queueSize     = 2048
+	batchSize     = 256
+	flushInterval = 5 * time.Second
+)
+
+// Config of the OTLP/HTTP exporter
+type Config struct {
+	// Endpoint is the full url spans are posted to, e.g.
+	// http://localhost:4318/v1/traces, empty disables tracing
+	Endpoint    string
+	Headers     map[string]string
+	ServiceName string
+	Version     string
+}
+
+// ConfigFromEnv reads the standard OTEL_* variables:
+// OTEL_TRACES_EXPORTER (otlp or none), OTEL_EXPORTER_OTLP_TRACES_ENDPOINT,
+// OTEL_EXPORTER_OTLP_ENDPOINT, OTEL_EXPORTER_OTLP_HEADERS and
+// OTEL_SERVICE_NAME
+func ConfigFromEnv(serviceName, version string) (Config, error) {
+	config := Config{ServiceName: serviceName, Version: version}
+
+	if name := os.Getenv("OTEL_SERVICE_NAME"); name != "" {
+		config.ServiceName = name
+	}
+
+	switch exporter := os.Getenv("OTEL_TRACES_EXPORTER"); exporter {
+	case "", "otlp":
+	case "none":
+		return config, nil
+	default:
+		return config, fmt.Errorf("unsupported OTEL_TRACES_EXPORTER %q, use otlp or none", exporter)
+	}
+
+	config.Endpoint = os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+	if config.Endpoint == "" {
+		if base := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); base != "" {
+			config.Endpoint = strings.TrimSuffix(base, "/") + "/v1/traces"
+		}
+	}
+
+	if config.Endpoint != "" {
+		if u, err := url.Parse(config.Endpoint); err != nil || u.Scheme == "" || u.Host == "" {
+			return config, fmt.Errorf("wrong otlp endpoint %q", config.Endpoint)
+		}
+	}
+
+	headers, err := parseHeaders(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"))
+	if err != nil {
+		return config, err
+	}
+	config.Headers = headers
+
+	return config, nil
+}
+
+// parseHeaders reads comma separated key=value pairs with url encoded values
+func parseHeaders(s string) (map[string]string, error) {
+	headers := make(map[string]string)
+
+	for _, pair := range strings.Split(s, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("wrong OTEL_EXPORTER_OTLP_HEADERS entry %q, use key=value", pair)
+		}
+
+		value, err := url.QueryUnescape(strings.TrimSpace(value))
+		if err != nil {
+			return nil, err
+		}
+		headers[strings.TrimSpace(key)] = value
+	}
+
+	return headers, nil
+}
+
+// Setup installs an OTLP exporter when config has an endpoint, tracing
+// stays a no-op otherwise
+func Setup(config Config) {
+	if config.Endpoint == "" {
+		SetExporter(nil)
+		return
+	}
+
+	SetExporter(NewOTLPExporter(config))
+}
+
+// OTLPExporter posts batches of spans as OTLP/HTTP JSON
+type OTLPExporter struct {
+	config Config
+	client http.Client
+
+	spans chan *Span
+	flush chan chan struct{}
+	once  sync.Once
+	done  chan struct{}
+}
+
+// NewOTLPExporter starts an exporter, spans are dropped when the queue is full
+func NewOTLPExporter(config Config) *OTLPExporter {
+	e := &OTLPExporter{
+		config: config,
+		client: http.Client{Timeout: 10 * time.Second},
+		spans:  make(chan *Span, queueSize),
+		flush:  make(chan chan struct{}),
+		done:   make(chan struct{}),
+	}
+
+	go e.run()
+
+	return e
+}
+
+// Export queues a finished span
+func (e *OTLPExporter) Export(span *Span) {
+	select {
+	case e.spans <- span:
+	default:
+	}
+}
+
+// Shutdown sends queued spans and stops the exporter
+func (e *OTLPExporter) Shutdown(ctx context.Context) error {
+	flushed := make(chan struct{})
+
+	select {
+	case e.flush <- flushed:
+	case <-e.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case <-flushed:
+		e.once.Do(func() { close(e.done) })
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (e *OTLPExporter) run() {
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	var batch []*Span
+	send := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := e.send(batch); err != nil {
+			slog.Warn("failed to export spans", "count", len(batch), logging.Err(err))
+		}
+		batch = nil
+	}
+
+	for {
+		select {
+		case span := <-e.spans:
+			batch = append(batch, span)
+			if len(batch) >= batchSize {
+				send()
+			}
+		case <-ticker.C:
+			send()
+		case flushed := <-e.flush:
+			for len(e.spans) > 0 {
+				batch = append(batch, <-e.spans)
+			}
+			send()
+			close(flushed)
+		case <-e.done:
+			return
+		}
+	}
+}
+
+func (e *OTLPExporter) send(spans []*Span) error {
+	body, err := json.Marshal(e.request(spans))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, e.config.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range e.config.Headers {
+		req.Header.Set(key, value)
+	}
+
+	res, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = res.Body.Close() }()
+	_, _ = io.Copy(io.Discard, res.Body)
+
+	if res.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("collector answered %s", res.Status)
+	}
+
+	return nil
+}
+
+// OTLP JSON encoding, ids are hex and 64 bit integers are strings
+type (
+	otlpRequest struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+	otlpResourceSpans struct {
+		Resource   otlpResource     `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+	otlpResource struct {
+		Attributes []otlpAttr `json:"attributes"`
+	}
+	otlpScopeSpans struct {
+		Scope otlpScope  `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+	otlpScope struct {
+		Name    string `json:"name"`
+		Version string `json:"version,omitempty"`
+	}
+	otlpSpan struct {
+		TraceID           string     `json:"traceId"`
+		SpanID            string     `json:"spanId"`
+		ParentSpanID      string     `json:"parentSpanId,omitempty"`
+		Name              string     `json:"name"`
+		Kind              int        `json:"kind"`
+		StartTimeUnixNano string     `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string     `json:"endTimeUnixNano"`
+		Attributes        []otlpAttr `json:"attributes,omitempty"`
+		Status            otlpStatus `json:"status"`
+	}
+	otlpStatus struct {
+		Code    int    `json:"code"`
+		Message string `json:"message,omitempty"`
+	}
+	otlpAttr struct {
+		Key   string    `json:"key"`
+		Value otlpValue `json:"value"`
+	}
+	otlpValue struct {
+		StringValue *string  `json:"stringValue,omitempty"`
+		IntValue    *string  `json:"intValue,omitempty"`
+		DoubleValue *float64 `json:"doubleValue,omitempty"`
+		BoolValue   *bool    `json:"boolValue,omitempty"`
+	}
+)
+
+// OTLP status codes
+const (
+	statusUnset = 0
+	statusError = 2
+)
+
+func (e *OTLPExporter) request(spans []*Span) *otlpRequest {
+	scope := otlpScopeSpans{Scope: otlpScope{Name: "github.com/ad/go-githublistener", Version: e.config.Version}}
+
+	for _, span := range spans {
+		s := otlpSpan{
+			TraceID:           hex.EncodeToString(span.TraceID[:]),
+			SpanID:            hex.EncodeToString(span.SpanID[:]),
+			Name:              span.Name,
+			Kind:              span.Kind,
+			StartTimeUnixNano: strconv.FormatInt(span.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(span.Finish.UnixNano(), 10),
+			Status:            otlpStatus{Code: statusUnset},
+		}
+		if span.ParentID != [8]byte{} {
+			s.ParentSpanID = hex.EncodeToString(span.ParentID[:])
+		}
+		if span.Error != "" {
+			s.Status = otlpStatus{Code: statusError, Message: span.Error}
+		}
+		for _, attr := range span.Attrs() {
+			s.Attributes = append(s.Attributes, otlpAttribute(attr))
+		}
+
+		scope.Spans = append(scope.Spans, s)
+	}
+
+	return &otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource: otlpResource{Attributes: []otlpAttr{
+			otlpAttribute(String("service.name", e.config.ServiceName)),
+			otlpAttribute(String("service.version", e.config.Version)),
+		}},
+		ScopeSpans: []otlpScopeSpans{scope},
+	}}}
+}
+
+func otlpAttribute(attr Attr) otlpAttr {
+	var v otlpValue
+
+	switch value := attr.Value.(type) {
+	case string:
+		v.StringValue = &value
+	case int:
+		s := strconv.Itoa(value)
+		v.IntValue = &s
+	case int64:
+		s := strconv.FormatInt(value, 10)
+		v.IntValue = &s
+	case float64:
+		v.DoubleValue = &value
+	case bool:
+		v.BoolValue = &value
+	default:
+		s := fmt.Sprint(value)
+		v.StringValue = &s
+	}
+
+	return otlpAttr{Key: attr.Key, Value: v}
+}
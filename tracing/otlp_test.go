@@ -0,0 +1,173 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func testSpan() *Span {
+	span := &Span{
+		TraceID:  [16]byte{0x0a, 0xf7, 0x65, 0x19, 0x16, 0xcd, 0x43, 0xdd, 0x84, 0x48, 0xeb, 0x21, 0x1c, 0x80, 0x31, 0x9c},
+		SpanID:   [8]byte{0xb7, 0xad, 0x6b, 0x71, 0x69, 0x20, 0x33, 0x31},
+		ParentID: [8]byte{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7},
+		Name:     "poll octo/hello",
+		Kind:     KindClient,
+		Start:    time.Unix(1700000000, 123),
+		Finish:   time.Unix(1700000001, 456),
+	}
+	span.SetAttr(
+		String("repo", "octo/hello"),
+		Int("poll.lag_ms", 9007199254740993),
+		Bool("callback", true),
+		Attr{Key: "ratio", Value: 0.5},
+	)
+	span.SetError(errors.New("github api answered 502 Bad Gateway"))
+
+	return span
+}
+
+func TestOTLPRequestJSON(t *testing.T) {
+	e := &OTLPExporter{config: Config{ServiceName: "go-githublistener", Version: "1.2.3"}}
+	root := &Span{TraceID: [16]byte{1}, SpanID: [8]byte{2}, Name: "job", Kind: KindInternal, Start: time.Unix(0, 1), Finish: time.Unix(0, 2)}
+
+	got, err := json.Marshal(e.request([]*Span{testSpan(), root}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"resourceSpans":[{"resource":{"attributes":[` +
+		`{"key":"service.name","value":{"stringValue":"go-githublistener"}},` +
+		`{"key":"service.version","value":{"stringValue":"1.2.3"}}]},` +
+		`"scopeSpans":[{"scope":{"name":"github.com/ad/go-githublistener","version":"1.2.3"},"spans":[` +
+		`{"traceId":"0af7651916cd43dd8448eb211c80319c","spanId":"b7ad6b7169203331","parentSpanId":"00f067aa0ba902b7",` +
+		`"name":"poll octo/hello","kind":3,"startTimeUnixNano":"1700000000000000123","endTimeUnixNano":"1700000001000000456",` +
+		`"attributes":[{"key":"repo","value":{"stringValue":"octo/hello"}},` +
+		`{"key":"poll.lag_ms","value":{"intValue":"9007199254740993"}},` +
+		`{"key":"callback","value":{"boolValue":true}},` +
+		`{"key":"ratio","value":{"doubleValue":0.5}}],` +
+		`"status":{"code":2,"message":"github api answered 502 Bad Gateway"}},` +
+		`{"traceId":"01000000000000000000000000000000","spanId":"0200000000000000",` +
+		`"name":"job","kind":1,"startTimeUnixNano":"1","endTimeUnixNano":"2","status":{"code":0}}]}]}]}`
+
+	if string(got) != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestOTLPExporterPostsBatch(t *testing.T) {
+	type received struct {
+		header http.Header
+		body   map[string]interface{}
+	}
+	requests := make(chan received, 1)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		var body map[string]interface{}
+		if err := json.Unmarshal(b, &body); err != nil {
+			t.Errorf("body is not json: %v", err)
+		}
+		requests <- received{header: r.Header, body: body}
+	}))
+	defer server.Close()
+
+	e := NewOTLPExporter(Config{Endpoint: server.URL + "/v1/traces", Headers: map[string]string{"Authorization": "Bearer t"}, ServiceName: "svc"})
+	e.Export(testSpan())
+	e.Export(testSpan())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := e.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case r := <-requests:
+		if got := r.header.Get("Content-Type"); got != "application/json" {
+			t.Errorf("Content-Type = %q", got)
+		}
+		if got := r.header.Get("Authorization"); got != "Bearer t" {
+			t.Errorf("Authorization = %q", got)
+		}
+		spans := r.body["resourceSpans"].([]interface{})[0].(map[string]interface{})["scopeSpans"].([]interface{})[0].(map[string]interface{})["spans"].([]interface{})
+		if len(spans) != 2 {
+			t.Errorf("got %d spans in the batch, want 2", len(spans))
+		}
+	default:
+		t.Fatal("nothing was posted on shutdown")
+	}
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    Config
+		wantErr bool
+	}{
+		{
+			name: "disabled by default",
+			want: Config{ServiceName: "svc", Version: "v1", Headers: map[string]string{}},
+		},
+		{
+			name: "base endpoint",
+			env:  map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector:4318/"},
+			want: Config{Endpoint: "http://collector:4318/v1/traces", ServiceName: "svc", Version: "v1", Headers: map[string]string{}},
+		},
+		{
+			name: "traces endpoint wins",
+			env: map[string]string{
+				"OTEL_EXPORTER_OTLP_ENDPOINT":        "http://collector:4318",
+				"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT": "https://traces.example.com/otlp",
+				"OTEL_EXPORTER_OTLP_HEADERS":         "api-key=a%20b, x-team = bots",
+				"OTEL_SERVICE_NAME":                  "bot",
+			},
+			want: Config{Endpoint: "https://traces.example.com/otlp", ServiceName: "bot", Version: "v1", Headers: map[string]string{"api-key": "a b", "x-team": "bots"}},
+		},
+		{
+			name: "exporter none",
+			env:  map[string]string{"OTEL_TRACES_EXPORTER": "none", "OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector:4318"},
+			want: Config{ServiceName: "svc", Version: "v1"},
+		},
+		{
+			name:    "unsupported exporter",
+			env:     map[string]string{"OTEL_TRACES_EXPORTER": "jaeger"},
+			wantErr: true,
+		},
+		{
+			name:    "relative endpoint",
+			env:     map[string]string{"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT": "collector:4318"},
+			wantErr: true,
+		},
+		{
+			name:    "wrong headers",
+			env:     map[string]string{"OTEL_EXPORTER_OTLP_HEADERS": "api-key"},
+			wantErr: true,
+		},
+	}
+
+	vars := []string{"OTEL_SERVICE_NAME", "OTEL_TRACES_EXPORTER", "OTEL_EXPORTER_OTLP_ENDPOINT", "OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "OTEL_EXPORTER_OTLP_HEADERS"}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range vars {
+				t.Setenv(name, tt.env[name])
+			}
+
+			got, err := ConfigFromEnv("svc", "v1")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, want error %t", err, tt.wantErr)
+			}
+			if err == nil && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
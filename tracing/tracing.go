@@ -0,0 +1,201 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	logging "github.com/ad/go-githublistener/logging"
+)
+
+// Span kinds as numbered by OTLP
+const (
+	KindInternal = 1
+	KindServer   = 2
+	KindClient   = 3
+)
+
+// KeyTraceID is the log field carrying id of the current trace
+const KeyTraceID = "trace_id"
+
+// Attr is a span attribute, values are strings, ints, floats or bools
+type Attr struct {
+	Key   string
+	Value interface{}
+}
+
+// String ...
+func String(key, value string) Attr {
+	return Attr{Key: key, Value: value}
+}
+
+// Int ...
+func Int(key string, value int64) Attr {
+	return Attr{Key: key, Value: value}
+}
+
+// Bool ...
+func Bool(key string, value bool) Attr {
+	return Attr{Key: key, Value: value}
+}
+
+// Span is a timed operation of a trace, methods of a nil span do nothing
+// so callers don't check whether tracing is enabled
+type Span struct {
+	TraceID  [16]byte
+	SpanID   [8]byte
+	ParentID [8]byte
+	Name     string
+	Kind     int
+	Start    time.Time
+	Finish   time.Time
+	Error    string
+
+	mu    sync.Mutex
+	attrs []Attr
+	ended bool
+}
+
+// SetAttr adds attributes to the span
+func (s *Span) SetAttr(attrs ...Attr) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	s.attrs = append(s.attrs, attrs...)
+	s.mu.Unlock()
+}
+
+// SetError marks the span failed, a nil err is ignored
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+
+	s.mu.Lock()
+	s.Error = logging.Redact(err.Error())
+	s.mu.Unlock()
+}
+
+// End ends the span and hands it to the exporter, only the first call
+// counts
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.Finish = time.Now()
+	s.mu.Unlock()
+
+	if e := current(); e != nil {
+		e.Export(s)
+	}
+}
+
+// Attrs returns attributes of the span
+func (s *Span) Attrs() []Attr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Attr(nil), s.attrs...)
+}
+
+// Traceparent returns the W3C trace context header value of the span
+func (s *Span) Traceparent() string {
+	return "00-" + hex.EncodeToString(s.TraceID[:]) + "-" + hex.EncodeToString(s.SpanID[:]) + "-01"
+}
+
+type spanKey struct{}
+
+// FromContext returns the current span or nil
+func FromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+
+	return span
+}
+
+// Start begins an internal span, see StartKind
+func Start(ctx context.Context, name string, attrs ...Attr) (context.Context, *Span) {
+	return StartKind(ctx, KindInternal, name, attrs...)
+}
+
+// StartKind begins a span, a child of the span in ctx or a new trace
+// whose id is added to log fields. Without an exporter it returns ctx and
+// a nil span
+func StartKind(ctx context.Context, kind int, name string, attrs ...Attr) (context.Context, *Span) {
+	if current() == nil {
+		return ctx, nil
+	}
+
+	span := &Span{Name: name, Kind: kind, Start: time.Now(), attrs: attrs}
+	span.SpanID = newSpanID()
+
+	if parent := FromContext(ctx); parent != nil {
+		span.TraceID = parent.TraceID
+		span.ParentID = parent.SpanID
+	} else {
+		_, _ = rand.Read(span.TraceID[:])
+		ctx = logging.With(ctx, KeyTraceID, hex.EncodeToString(span.TraceID[:]))
+	}
+
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// StartChild begins a span only inside a trace, for frequent operations
+// like database queries that mean nothing on their own
+func StartChild(ctx context.Context, kind int, name string, attrs ...Attr) (context.Context, *Span) {
+	if FromContext(ctx) == nil {
+		return ctx, nil
+	}
+
+	return StartKind(ctx, kind, name, attrs...)
+}
+
+func newSpanID() [8]byte {
+	var id [8]byte
+	_, _ = rand.Read(id[:])
+
+	return id
+}
+
+// Exporter sends finished spans somewhere
+type Exporter interface {
+	Export(span *Span)
+	Shutdown(ctx context.Context) error
+}
+
+var exporter atomic.Value
+
+type exporterBox struct {
+	e Exporter
+}
+
+func current() Exporter {
+	box, _ := exporter.Load().(exporterBox)
+
+	return box.e
+}
+
+// SetExporter makes e receive every finished span, nil disables tracing
+func SetExporter(e Exporter) {
+	exporter.Store(exporterBox{e})
+}
+
+// Shutdown flushes spans of the current exporter
+func Shutdown(ctx context.Context) error {
+	if e := current(); e != nil {
+		return e.Shutdown(ctx)
+	}
+
+	return nil
+}